@@ -14,6 +14,7 @@ import (
 	"github.com/andro-kes/Chat/auth/internal/database"
 	"github.com/andro-kes/Chat/auth/internal/handlers"
 	"github.com/andro-kes/Chat/auth/internal/middlewares"
+	"github.com/andro-kes/Chat/auth/internal/repository"
 	"github.com/andro-kes/Chat/auth/internal/services"
 	"github.com/andro-kes/Chat/auth/logger"
 	"go.uber.org/zap"
@@ -58,7 +59,7 @@ func main() {
 		grpc.UnaryInterceptor(authgrpc.RecoverUnaryInterceptor()),
 	)
 
-	authService := authgrpc.NewAuthServiceServer(services.NewTokenService())
+	authService := authgrpc.NewAuthServiceServer(services.NewTokenService(), repository.NewUserRepo())
 	authgrpc.RegisterAuthServiceServer(grpcServer, authService)
 
 	go func() {
@@ -4,8 +4,11 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/andro-kes/Chat/auth/internal/models"
+	"github.com/andro-kes/Chat/auth/internal/repository"
 	"github.com/andro-kes/Chat/auth/internal/services"
 	"github.com/andro-kes/Chat/auth/logger"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -17,12 +20,17 @@ import (
 type authServiceServer struct {
 	UnimplementedAuthServiceServer
 	tokenService services.TokenService
+	userRepo     *repository.UserRepo
 }
 
+// maxUsersPerRequest — сколько пользователей можно запросить за один вызов GetUsers
+const maxUsersPerRequest = 100
+
 // NewAuthServiceServer создает новый экземпляр сервера gRPC.
-func NewAuthServiceServer(tokenService services.TokenService) *authServiceServer {
+func NewAuthServiceServer(tokenService services.TokenService, userRepo *repository.UserRepo) *authServiceServer {
 	return &authServiceServer{
 		tokenService: tokenService,
+		userRepo:     userRepo,
 	}
 }
 
@@ -46,6 +54,52 @@ func (ass *authServiceServer) GetUserId(ctx context.Context, t *TokenRequest) (*
 	return &UserIdResponse{UserId: userId}, nil
 }
 
+// GetUsers возвращает id и имена пользователей по их идентификаторам.
+// Несуществующие пользователи в ответ не попадают.
+func (ass *authServiceServer) GetUsers(ctx context.Context, req *UsersRequest) (*UsersResponse, error) {
+	if len(req.UserIds) > maxUsersPerRequest {
+		return nil, status.Errorf(codes.InvalidArgument, "Слишком много пользователей в запросе")
+	}
+
+	ids := make([]uuid.UUID, 0, len(req.UserIds))
+	for _, v := range req.UserIds {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Невалидный id пользователя")
+		}
+		ids = append(ids, id)
+	}
+
+	users, err := ass.userRepo.FindByIDs(ids)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Не удалось получить пользователей")
+	}
+
+	return usersResponse(users), nil
+}
+
+// GetUsersByUsername ищет пользователей по именам без учета регистра, например
+// для разбора @упоминаний. Имена не уникальны: на одно имя может прийти несколько пользователей.
+func (ass *authServiceServer) GetUsersByUsername(ctx context.Context, req *UsernamesRequest) (*UsersResponse, error) {
+	if len(req.Usernames) > maxUsersPerRequest {
+		return nil, status.Errorf(codes.InvalidArgument, "Слишком много пользователей в запросе")
+	}
+
+	users, err := ass.userRepo.FindByUsernames(req.Usernames)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Не удалось получить пользователей")
+	}
+	return usersResponse(users), nil
+}
+
+func usersResponse(users []models.User) *UsersResponse {
+	res := &UsersResponse{Users: make([]*User, 0, len(users))}
+	for _, u := range users {
+		res.Users = append(res.Users, &User{Id: u.ID.String(), Username: u.Username})
+	}
+	return res
+}
+
 // RecoverUnaryInterceptor - unary interceptor для перехвата паник в gRPC.
 func RecoverUnaryInterceptor() grpc.UnaryServerInterceptor {
 	return func(
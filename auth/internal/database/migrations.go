@@ -27,6 +27,7 @@ func makeMigrations(ctx context.Context, pool *pgxpool.Pool) {
             created_at TIMESTAMP NOT NULL DEFAULT NOW()
         );`,
         `CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);`,
+        `CREATE INDEX IF NOT EXISTS idx_users_username_lower ON users(lower(username));`,
         `CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens(user_id);`,
         `CREATE INDEX IF NOT EXISTS idx_refresh_tokens_token_id ON refresh_tokens(token_id);`,
     }
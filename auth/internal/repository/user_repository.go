@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/andro-kes/Chat/auth/internal/database"
@@ -68,4 +69,59 @@ func (dur *UserRepo) SetPassword(user *models.User) error {
 		return errors.New("не удалось обновить пароль")
 	}
 	return nil
-}
\ No newline at end of file
+}
+
+// FindByIDs возвращает неудаленных пользователей с переданными id.
+// Несуществующие id пропускаются.
+func (dur *UserRepo) FindByIDs(ids []uuid.UUID) ([]models.User, error) {
+	rows, err := dur.Pool.Query(
+		context.Background(),
+		"SELECT id, username FROM users WHERE id = ANY($1) AND deleted_at IS NULL",
+		ids,
+	)
+	if err != nil {
+		logger.Log.Error("Не удалось получить пользователей", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.ID, &user.Username); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// FindByUsernames возвращает неудаленных пользователей с переданными именами без учета регистра.
+// Имена не уникальны, поэтому одному имени может соответствовать несколько пользователей.
+func (dur *UserRepo) FindByUsernames(usernames []string) ([]models.User, error) {
+	lowered := make([]string, len(usernames))
+	for i, name := range usernames {
+		lowered[i] = strings.ToLower(name)
+	}
+
+	rows, err := dur.Pool.Query(
+		context.Background(),
+		"SELECT id, username FROM users WHERE lower(username) = ANY($1) AND deleted_at IS NULL",
+		lowered,
+	)
+	if err != nil {
+		logger.Log.Error("Не удалось найти пользователей по именам", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.ID, &user.Username); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
@@ -36,10 +36,38 @@ func main() {
 	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("./static/"))))
 
 	// Регистрируем маршруты
+	r.Handle("/presence", middlewares.RecoveryMiddleware(middlewares.AuthMiddleware(http.HandlerFunc(chatHandlers.GetPresence)))).Methods(http.MethodGet)
+	r.Handle("/direct/{user_id}/messages", middlewares.RecoveryMiddleware(middlewares.AuthMiddleware(http.HandlerFunc(chatHandlers.SendDirectMessage)))).Methods(http.MethodPost)
+	r.Handle("/scheduled", middlewares.RecoveryMiddleware(middlewares.AuthMiddleware(http.HandlerFunc(chatHandlers.GetScheduled)))).Methods(http.MethodGet)
+	r.Handle("/scheduled/{scheduled_id}", middlewares.RecoveryMiddleware(middlewares.AuthMiddleware(http.HandlerFunc(chatHandlers.EditScheduled)))).Methods(http.MethodPatch)
+	r.Handle("/scheduled/{scheduled_id}", middlewares.RecoveryMiddleware(middlewares.AuthMiddleware(http.HandlerFunc(chatHandlers.CancelScheduled)))).Methods(http.MethodDelete)
+	r.Handle("/search", middlewares.RecoveryMiddleware(middlewares.AuthMiddleware(http.HandlerFunc(chatHandlers.SearchMessages)))).Methods(http.MethodGet)
 	r.Handle("/{id}/connect", middlewares.RecoveryMiddleware(middlewares.AuthMiddleware(http.HandlerFunc(chatHandlers.ChatHandler)))).Methods(http.MethodGet)
 	r.Handle("/{id}", middlewares.RecoveryMiddleware(middlewares.AuthMiddleware(http.HandlerFunc(chatHandlers.ChatPageHandler)))).Methods(http.MethodGet)
 	r.Handle("/create", middlewares.RecoveryMiddleware(middlewares.AuthMiddleware(http.HandlerFunc(chatHandlers.CreateRoom)))).Methods(http.MethodPost)
 	r.Handle("/{id}/messages", middlewares.RecoveryMiddleware(middlewares.AuthMiddleware(http.HandlerFunc(chatHandlers.GetRoomMessages)))).Methods(http.MethodGet)
+	r.Handle("/{id}/messages/{message_id}", middlewares.RecoveryMiddleware(middlewares.AuthMiddleware(http.HandlerFunc(chatHandlers.EditMessage)))).Methods(http.MethodPatch)
+	r.Handle("/{id}/messages/{message_id}", middlewares.RecoveryMiddleware(middlewares.AuthMiddleware(http.HandlerFunc(chatHandlers.DeleteMessage)))).Methods(http.MethodDelete)
+	r.Handle("/{id}/messages/{message_id}/thread", middlewares.RecoveryMiddleware(middlewares.AuthMiddleware(http.HandlerFunc(chatHandlers.GetThread)))).Methods(http.MethodGet)
+	r.Handle("/{id}/messages/{message_id}/reactions", middlewares.RecoveryMiddleware(middlewares.AuthMiddleware(http.HandlerFunc(chatHandlers.AddReaction)))).Methods(http.MethodPost)
+	r.Handle("/{id}/messages/{message_id}/reactions/{emoji}", middlewares.RecoveryMiddleware(middlewares.AuthMiddleware(http.HandlerFunc(chatHandlers.RemoveReaction)))).Methods(http.MethodDelete)
+	r.Handle("/{id}/messages/{message_id}/pin", middlewares.RecoveryMiddleware(middlewares.AuthMiddleware(http.HandlerFunc(chatHandlers.PinMessage)))).Methods(http.MethodPost)
+	r.Handle("/{id}/messages/{message_id}/pin", middlewares.RecoveryMiddleware(middlewares.AuthMiddleware(http.HandlerFunc(chatHandlers.UnpinMessage)))).Methods(http.MethodDelete)
+	r.Handle("/{id}/pins", middlewares.RecoveryMiddleware(middlewares.AuthMiddleware(http.HandlerFunc(chatHandlers.GetPins)))).Methods(http.MethodGet)
+	r.Handle("/{id}/messages/{message_id}/edits", middlewares.RecoveryMiddleware(middlewares.AuthMiddleware(http.HandlerFunc(chatHandlers.GetMessageEdits)))).Methods(http.MethodGet)
+	r.Handle("/{id}/attachments", middlewares.RecoveryMiddleware(middlewares.AuthMiddleware(http.HandlerFunc(chatHandlers.UploadAttachment)))).Methods(http.MethodPost)
+	r.Handle("/{id}/attachments/{attachment_id}", middlewares.RecoveryMiddleware(middlewares.AuthMiddleware(http.HandlerFunc(chatHandlers.DownloadAttachment)))).Methods(http.MethodGet)
+	r.Handle("/{id}/members", middlewares.RecoveryMiddleware(middlewares.AuthMiddleware(http.HandlerFunc(chatHandlers.GetRoomMembers)))).Methods(http.MethodGet)
+	r.Handle("/{id}/members", middlewares.RecoveryMiddleware(middlewares.AuthMiddleware(http.HandlerFunc(chatHandlers.AddRoomMember)))).Methods(http.MethodPost)
+	r.Handle("/{id}/members/{user_id}", middlewares.RecoveryMiddleware(middlewares.AuthMiddleware(http.HandlerFunc(chatHandlers.RemoveRoomMember)))).Methods(http.MethodDelete)
+	r.Handle("/{id}/members/{user_id}/role", middlewares.RecoveryMiddleware(middlewares.AuthMiddleware(http.HandlerFunc(chatHandlers.SetMemberRole)))).Methods(http.MethodPut)
+	r.Handle("/{id}/owner", middlewares.RecoveryMiddleware(middlewares.AuthMiddleware(http.HandlerFunc(chatHandlers.TransferOwnership)))).Methods(http.MethodPost)
+	r.Handle("/{id}", middlewares.RecoveryMiddleware(middlewares.AuthMiddleware(http.HandlerFunc(chatHandlers.RenameRoom)))).Methods(http.MethodPatch)
+	r.Handle("/{id}", middlewares.RecoveryMiddleware(middlewares.AuthMiddleware(http.HandlerFunc(chatHandlers.DeleteRoom)))).Methods(http.MethodDelete)
+	r.Handle("/{id}/scheduled", middlewares.RecoveryMiddleware(middlewares.AuthMiddleware(http.HandlerFunc(chatHandlers.ScheduleMessage)))).Methods(http.MethodPost)
+	r.Handle("/{id}/ttl", middlewares.RecoveryMiddleware(middlewares.AuthMiddleware(http.HandlerFunc(chatHandlers.SetMessageTTL)))).Methods(http.MethodPut)
+	r.Handle("/{id}/read", middlewares.RecoveryMiddleware(middlewares.AuthMiddleware(http.HandlerFunc(chatHandlers.MarkRead)))).Methods(http.MethodPost)
+	r.Handle("/{id}/leave", middlewares.RecoveryMiddleware(middlewares.AuthMiddleware(http.HandlerFunc(chatHandlers.LeaveRoom)))).Methods(http.MethodPost)
 	r.Handle("/{id}/rooms", middlewares.RecoveryMiddleware(middlewares.AuthMiddleware(http.HandlerFunc(chatHandlers.GetUserRooms)))).Methods(http.MethodGet)
 	r.Handle("/", middlewares.RecoveryMiddleware(middlewares.AuthMiddleware(http.HandlerFunc(chatHandlers.MainPageHandler)))).Methods(http.MethodGet)
 	r.Handle("/ws/{id}", middlewares.RecoveryMiddleware(middlewares.AuthMiddleware(http.HandlerFunc(chatHandlers.ChatHandler)))).Methods(http.MethodGet)
@@ -72,6 +100,20 @@ func main() {
 		log.Printf("Server forced to shutdown: %v", err)
 	}
 
+	// Присутствие снимаем до остановки RabbitMQ, чтобы успеть разослать offline
+	if chatHandlers != nil && chatHandlers.Presence != nil {
+		chatHandlers.Presence.Stop()
+	}
+
+	// Планировщик публикует через RabbitMQ, поэтому останавливаем его раньше
+	if chatHandlers != nil && chatHandlers.Scheduler != nil {
+		chatHandlers.Scheduler.Stop()
+	}
+
+	if chatHandlers != nil && chatHandlers.Reaper != nil {
+		chatHandlers.Reaper.Stop()
+	}
+
 	if chatHandlers != nil && chatHandlers.RabbitManager != nil {
 		chatHandlers.RabbitManager.Stop()
 	}
@@ -2,24 +2,19 @@ package grpc
 
 import (
 	"context"
-	"time"
 	"os"
+	"sync"
+	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
 func Client(token string) (string, error) {
-	addr := os.Getenv("AUTH_GRPC_ADDR")
-	if addr == "" {
-		addr = "localhost:50051"
-	}
-
-	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := sharedConn()
 	if err != nil {
 		return "", err
 	}
-	defer conn.Close()
 
 	client := NewAuthServiceClient(conn)
 
@@ -32,4 +27,86 @@ func Client(token string) (string, error) {
 	}
 
 	return res.UserId, nil
-}
\ No newline at end of file
+}
+
+// Usernames возвращает имена пользователей по их id. Пользователей, которых
+// нет в сервисе авторизации, в результате нет.
+func Usernames(userIDs []string) (map[string]string, error) {
+	conn, err := sharedConn()
+	if err != nil {
+		return nil, err
+	}
+
+	client := NewAuthServiceClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	res, err := client.GetUsers(ctx, &UsersRequest{UserIds: userIDs})
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]string, len(res.Users))
+	for _, u := range res.Users {
+		names[u.Id] = u.Username
+	}
+	return names, nil
+}
+
+// UserIDsByUsername возвращает id пользователей с переданными именами (без учета регистра).
+// Имена не уникальны, поэтому на одно имя может прийти несколько id.
+func UserIDsByUsername(usernames []string) ([]string, error) {
+	conn, err := sharedConn()
+	if err != nil {
+		return nil, err
+	}
+
+	client := NewAuthServiceClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	res, err := client.GetUsersByUsername(ctx, &UsernamesRequest{Usernames: usernames})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(res.Users))
+	for i, u := range res.Users {
+		ids[i] = u.Id
+	}
+	return ids, nil
+}
+
+var (
+	connMu sync.Mutex
+	conn   *grpc.ClientConn
+)
+
+// sharedConn возвращает общее для всех вызовов соединение с сервисом авторизации.
+// Соединение создается при первом обращении и переподключается само, поэтому
+// держится всё время работы сервиса и не закрывается после запроса.
+func sharedConn() (*grpc.ClientConn, error) {
+	connMu.Lock()
+	defer connMu.Unlock()
+
+	if conn != nil {
+		return conn, nil
+	}
+	c, err := dial()
+	if err != nil {
+		return nil, err
+	}
+	conn = c
+	return conn, nil
+}
+
+func dial() (*grpc.ClientConn, error) {
+	addr := os.Getenv("AUTH_GRPC_ADDR")
+	if addr == "" {
+		addr = "localhost:50051"
+	}
+
+	return grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+}
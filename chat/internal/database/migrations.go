@@ -35,6 +35,144 @@ func makeMigrations(ctx context.Context, pool *pgxpool.Pool) {
         `CREATE INDEX IF NOT EXISTS idx_messages_room_id ON messages(room_id);`,
         `CREATE INDEX IF NOT EXISTS idx_messages_created_at ON messages(created_at);`,
         `CREATE INDEX IF NOT EXISTS idx_rooms_created_by ON rooms(created_by);`,
+        `ALTER TABLE rooms ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;`,
+        `CREATE INDEX IF NOT EXISTS idx_room_users_user_id ON room_users(user_id);`,
+        `ALTER TABLE room_users ADD COLUMN IF NOT EXISTS role VARCHAR(16) NOT NULL DEFAULT 'member';`,
+        // Комнатам, созданным до появления ролей, назначаем владельцем создателя
+        `UPDATE room_users ru SET role = 'owner'
+            FROM rooms r
+            WHERE ru.room_id = r.id AND ru.user_id = r.created_by
+            AND NOT EXISTS (SELECT 1 FROM room_users o WHERE o.room_id = ru.room_id AND o.role = 'owner');`,
+        // Порядковые номера сообщений внутри комнаты: rooms.last_seq — последний выданный номер
+        `ALTER TABLE rooms ADD COLUMN IF NOT EXISTS last_seq BIGINT NOT NULL DEFAULT 0;`,
+        `ALTER TABLE messages ADD COLUMN IF NOT EXISTS seq BIGINT;`,
+        // Нумеруем сообщения, сохраненные до появления seq, в порядке (created_at, id)
+        `UPDATE messages m SET seq = n.seq
+            FROM (
+                SELECT id, COALESCE((SELECT MAX(seq) FROM messages x WHERE x.room_id = messages.room_id), 0)
+                    + ROW_NUMBER() OVER (PARTITION BY room_id ORDER BY created_at, id) AS seq
+                FROM messages
+                WHERE seq IS NULL
+            ) n
+            WHERE m.id = n.id;`,
+        `UPDATE rooms r SET last_seq = s.max_seq
+            FROM (SELECT room_id, MAX(seq) AS max_seq FROM messages GROUP BY room_id) s
+            WHERE r.id = s.room_id AND r.last_seq < s.max_seq;`,
+        `ALTER TABLE messages ALTER COLUMN seq SET NOT NULL;`,
+        `CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_room_seq ON messages(room_id, seq);`,
+        `DROP INDEX IF EXISTS idx_messages_room_created_id;`,
+        // Ключ идемпотентности сообщения; для старых сообщений совпадает с id
+        `ALTER TABLE messages ADD COLUMN IF NOT EXISTS client_msg_id UUID;`,
+        `UPDATE messages SET client_msg_id = id WHERE client_msg_id IS NULL;`,
+        `ALTER TABLE messages ALTER COLUMN client_msg_id SET NOT NULL;`,
+        `CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_room_client_msg_id ON messages(room_id, client_msg_id);`,
+        `ALTER TABLE messages ADD COLUMN IF NOT EXISTS edited_at TIMESTAMP;`,
+        `CREATE TABLE IF NOT EXISTS message_edits (
+            id BIGSERIAL PRIMARY KEY,
+            message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+            content TEXT NOT NULL,
+            created_at TIMESTAMP NOT NULL,
+            replaced_at TIMESTAMP NOT NULL DEFAULT NOW()
+        );`,
+        `CREATE INDEX IF NOT EXISTS idx_message_edits_message_id ON message_edits(message_id, id);`,
+        `ALTER TABLE messages ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;`,
+        `ALTER TABLE messages ADD COLUMN IF NOT EXISTS deleted_by UUID;`,
+        // Треды: ответ ссылается на корневое сообщение, у корня храним счетчик и время последнего ответа
+        `ALTER TABLE messages ADD COLUMN IF NOT EXISTS parent_id UUID REFERENCES messages(id) ON DELETE CASCADE;`,
+        `ALTER TABLE messages ADD COLUMN IF NOT EXISTS reply_count INT NOT NULL DEFAULT 0;`,
+        `ALTER TABLE messages ADD COLUMN IF NOT EXISTS last_reply_at TIMESTAMP;`,
+        `CREATE INDEX IF NOT EXISTS idx_messages_parent_seq ON messages(parent_id, seq) WHERE parent_id IS NOT NULL;`,
+        // Реакции: один пользователь ставит каждый эмодзи на сообщение не больше одного раза
+        `CREATE TABLE IF NOT EXISTS message_reactions (
+            message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+            user_id UUID NOT NULL,
+            emoji VARCHAR(32) NOT NULL,
+            created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+            PRIMARY KEY (message_id, user_id, emoji)
+        );`,
+        // Курсор чтения участника. Участникам, вступившим до его появления, считаем прочитанной всю историю
+        `ALTER TABLE room_users ADD COLUMN IF NOT EXISTS last_read_seq BIGINT;`,
+        `UPDATE room_users ru SET last_read_seq = r.last_seq
+            FROM rooms r
+            WHERE ru.room_id = r.id AND ru.last_read_seq IS NULL;`,
+        `ALTER TABLE room_users ALTER COLUMN last_read_seq SET DEFAULT 0;`,
+        `ALTER TABLE room_users ALTER COLUMN last_read_seq SET NOT NULL;`,
+        // Упоминания пользователей в сообщениях, по ним считаются непрочитанные упоминания
+        `CREATE TABLE IF NOT EXISTS message_mentions (
+            message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+            user_id UUID NOT NULL,
+            PRIMARY KEY (message_id, user_id)
+        );`,
+        `CREATE INDEX IF NOT EXISTS idx_message_mentions_user_id ON message_mentions(user_id);`,
+        // Присутствие: по строке на пару инстанс-пользователь, инстанс продлевает updated_at,
+        // строки упавших инстансов устаревают и удаляются соседями
+        `CREATE TABLE IF NOT EXISTS presence_sessions (
+            instance_id UUID NOT NULL,
+            user_id UUID NOT NULL,
+            status VARCHAR(16) NOT NULL,
+            updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+            PRIMARY KEY (instance_id, user_id)
+        );`,
+        `CREATE INDEX IF NOT EXISTS idx_presence_sessions_user_id ON presence_sessions(user_id);`,
+        `CREATE TABLE IF NOT EXISTS user_presence (
+            user_id UUID PRIMARY KEY,
+            last_seen_at TIMESTAMP NOT NULL
+        );`,
+        // Полнотекстовый поиск по сообщениям. Конфигурация russian стеммит и русские,
+        // и латинские слова; вектор пересчитывается Postgres при изменении content
+        `ALTER TABLE messages ADD COLUMN IF NOT EXISTS search_vector TSVECTOR
+            GENERATED ALWAYS AS (to_tsvector('russian', content)) STORED;`,
+        `CREATE INDEX IF NOT EXISTS idx_messages_search_vector ON messages USING GIN (search_vector);`,
+        // Вложения: загружаются до отправки сообщения и привязываются к нему при сохранении
+        `CREATE TABLE IF NOT EXISTS attachments (
+            id UUID PRIMARY KEY,
+            room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+            uploader_id UUID NOT NULL,
+            message_id UUID REFERENCES messages(id) ON DELETE SET NULL,
+            name VARCHAR(255) NOT NULL,
+            size BIGINT NOT NULL,
+            mime_type VARCHAR(255) NOT NULL,
+            checksum CHAR(64) NOT NULL,
+            storage_key TEXT NOT NULL,
+            created_at TIMESTAMP NOT NULL DEFAULT NOW()
+        );`,
+        `CREATE INDEX IF NOT EXISTS idx_attachments_message_id ON attachments(message_id) WHERE message_id IS NOT NULL;`,
+        // Личные переписки: комната на пару пользователей с детерминированным id.
+        // Уникальность названия проверяется только у групповых комнат, прежний индекс idx_rooms_name
+        // распространялся на все комнаты
+        `ALTER TABLE rooms ADD COLUMN IF NOT EXISTS kind VARCHAR(16) NOT NULL DEFAULT 'group';`,
+        `DROP INDEX IF EXISTS idx_rooms_name;`,
+        `CREATE UNIQUE INDEX IF NOT EXISTS idx_rooms_group_name ON rooms(name) WHERE deleted_at IS NULL AND kind = 'group';`,
+        // Закрепленные сообщения: сообщение закрепляется в своей комнате не больше одного раза
+        `CREATE TABLE IF NOT EXISTS message_pins (
+            message_id UUID PRIMARY KEY REFERENCES messages(id) ON DELETE CASCADE,
+            room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+            pinned_by UUID NOT NULL,
+            pinned_at TIMESTAMP NOT NULL DEFAULT NOW()
+        );`,
+        `CREATE INDEX IF NOT EXISTS idx_message_pins_room_id ON message_pins(room_id, pinned_at DESC);`,
+        // Исчезающие сообщения: срок жизни по умолчанию у комнаты (в секундах, 0 — без срока)
+        // и момент удаления у сообщения
+        `ALTER TABLE rooms ADD COLUMN IF NOT EXISTS message_ttl BIGINT NOT NULL DEFAULT 0;`,
+        `ALTER TABLE messages ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP;`,
+        `CREATE INDEX IF NOT EXISTS idx_messages_expires_at ON messages(expires_at) WHERE expires_at IS NOT NULL;`,
+        // Отложенные сообщения: строка живет, пока сообщение не отправлено, и удаляется
+        // в той же транзакции, в которой планировщик публикует сообщение
+        `CREATE TABLE IF NOT EXISTS scheduled_messages (
+            id UUID PRIMARY KEY,
+            room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+            user_id UUID NOT NULL,
+            content TEXT NOT NULL,
+            parent_id UUID,
+            ttl BIGINT NOT NULL DEFAULT 0,
+            send_at TIMESTAMP NOT NULL,
+            created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+            updated_at TIMESTAMP
+        );`,
+        `CREATE INDEX IF NOT EXISTS idx_scheduled_messages_send_at ON scheduled_messages(send_at);`,
+        `CREATE INDEX IF NOT EXISTS idx_scheduled_messages_user_id ON scheduled_messages(user_id, send_at);`,
+        // Неприложенные вложения: по этому индексу уборщик находит забытые загрузки
+        `CREATE INDEX IF NOT EXISTS idx_attachments_pending ON attachments(created_at) WHERE message_id IS NULL;`,
     }
 
     // Добавьте retry логику для миграций...
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andro-kes/Chat/chat/logger"
+	"github.com/andro-kes/Chat/chat/responses"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// attachmentTimeout — сколько может длиться загрузка или скачивание вложения.
+// Общие таймауты сервера рассчитаны на короткие JSON-запросы.
+const attachmentTimeout = 2 * time.Minute
+
+// multipartOverhead — запас на заголовки multipart сверх лимита размера файла
+const multipartOverhead = 64 << 10
+
+// UploadAttachment загружает файл в комнату. Файл передается в multipart/form-data
+// в поле `file`; тип определяется по содержимому. Чтобы приложить файл к сообщению,
+// его id передается в `attachment_ids` фрейма `message`.
+//
+// Возвращает:
+//   - 201 Created: {"attachment": {id, name, size, mime_type, checksum, ...}}.
+//   - 400 Bad Request: Если нет поля `file` или файл пуст.
+//   - 403 Forbidden: Если пользователь не может писать в комнату.
+//   - 413 Request Entity Too Large: Если файл больше MAX_ATTACHMENT_SIZE.
+//   - 415 Unsupported Media Type: Если тип файла не разрешен.
+//
+// Пример использования:
+//   POST /{id}/attachments (multipart/form-data, file=@photo.png)
+func (ch *ChatHandlers) UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	roomID, currentUserID, ok := parseRoomRequest(w, r)
+	if !ok {
+		return
+	}
+
+	_ = http.NewResponseController(w).SetReadDeadline(time.Now().Add(attachmentTimeout))
+	r.Body = http.MaxBytesReader(w, r.Body, ch.ChatService.MaxAttachmentSize()+multipartOverhead)
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		responses.SendJSONResponse(w, 400, map[string]any{"Error": "Ожидается multipart/form-data"})
+		return
+	}
+
+	// Читаем части по очереди, не буферизуя файл целиком
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			sendUploadError(w, err)
+			return
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+
+		attachment, err := ch.ChatService.UploadAttachment(roomID, currentUserID, part.FileName(), part)
+		part.Close()
+		if err != nil {
+			sendUploadError(w, err)
+			return
+		}
+
+		responses.SendJSONResponse(w, 201, map[string]any{
+			"attachment": attachment,
+		})
+		return
+	}
+}
+
+// DownloadAttachment отдает содержимое вложения участнику комнаты.
+// Картинки отдаются для показа в браузере, остальные файлы — на скачивание.
+//
+// Возвращает:
+//   - 200 OK: Содержимое файла с его MIME-типом.
+//   - 403 Forbidden: Если пользователь не состоит в комнате.
+//   - 404 Not Found: Если вложения нет, его сообщение удалено или оно еще не отправлено другим пользователем.
+//
+// Пример использования:
+//   GET /{id}/attachments/{attachment_id}
+func (ch *ChatHandlers) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	roomID, currentUserID, ok := parseRoomRequest(w, r)
+	if !ok {
+		return
+	}
+
+	attachmentID, err := uuid.Parse(mux.Vars(r)["attachment_id"])
+	if err != nil {
+		responses.SendJSONResponse(w, 400, map[string]any{"Error": "Невалидный id вложения"})
+		return
+	}
+
+	attachment, body, err := ch.ChatService.OpenAttachment(roomID, attachmentID, currentUserID)
+	if err != nil {
+		sendServiceError(w, err)
+		return
+	}
+	defer body.Close()
+
+	disposition := "attachment"
+	if strings.HasPrefix(attachment.MimeType, "image/") {
+		disposition = "inline"
+	}
+
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(attachmentTimeout))
+	w.Header().Set("Content-Type", attachment.MimeType)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Header().Set("ETag", `"`+attachment.Checksum+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(w, body); err != nil {
+		logger.Log.Warn("Не удалось отдать вложение", zap.String("attachment_id", attachmentID.String()), zap.Error(err))
+	}
+}
+
+// sendUploadError отвечает на ошибку загрузки: превышение лимита тела запроса — 413,
+// отсутствие поля file — 400, остальное — как ошибки сервиса
+func sendUploadError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		responses.SendJSONResponse(w, 413, map[string]any{"Error": "Вложение слишком большое"})
+	case errors.Is(err, io.EOF):
+		responses.SendJSONResponse(w, 400, map[string]any{"Error": "Нет файла в поле file"})
+	default:
+		sendServiceError(w, err)
+	}
+}
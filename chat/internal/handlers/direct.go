@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/andro-kes/Chat/chat/binding"
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/andro-kes/Chat/chat/internal/protocol"
+	"github.com/andro-kes/Chat/chat/internal/services"
+	"github.com/andro-kes/Chat/chat/logger"
+	"github.com/andro-kes/Chat/chat/responses"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// SendDirectMessage отправляет сообщение в личную переписку с пользователем `user_id`.
+// Переписка у пары одна: при первом сообщении она создается, дальше это обычная комната
+// с двумя участниками, и писать в нее можно через WebSocket `/{room_id}/connect`.
+// Тело запроса — как у фрейма `message`: {"text": "...", "client_msg_id": "...", "ttl": 60}.
+//
+// Возвращает:
+//   - 202 Accepted: {"room": {...}, "message_id": "..."} — сообщение принято в очередь.
+//   - 400 Bad Request: При некорректном id, пустом тексте, недопустимом ttl или попытке написать самому себе.
+//   - 404 Not Found: Если пользователя нет.
+//
+// Пример использования:
+//   POST /direct/{user_id}/messages {"text": "привет"}
+func (ch *ChatHandlers) SendDirectMessage(w http.ResponseWriter, r *http.Request) {
+	currentUserID, err := getUser(r)
+	if err != nil {
+		responses.SendJSONResponse(w, 400, map[string]any{
+			"error": "Не удалось получить данные о пользователе",
+		})
+		return
+	}
+
+	peerID, err := uuid.Parse(mux.Vars(r)["user_id"])
+	if err != nil {
+		responses.SendJSONResponse(w, 400, map[string]any{"Error": "Невалидный id пользователя"})
+		return
+	}
+
+	var in protocol.MessageIn
+	if err := binding.BindWithJSON(r, &in); err != nil || strings.TrimSpace(in.Text) == "" {
+		responses.SendJSONResponse(w, 400, map[string]any{"Error": "Пустое сообщение"})
+		return
+	}
+
+	clientMsgID := uuid.New()
+	if in.ClientMsgID != "" {
+		if clientMsgID, err = uuid.Parse(in.ClientMsgID); err != nil {
+			responses.SendJSONResponse(w, 400, map[string]any{"Error": "Невалидный client_msg_id"})
+			return
+		}
+	}
+
+	createdAt := time.Now()
+	expiresAt, err := services.MessageExpiry(createdAt, in.TTL)
+	if err != nil {
+		sendServiceError(w, err)
+		return
+	}
+
+	room, err := ch.ChatService.OpenDirectRoom(*currentUserID, peerID)
+	if err != nil {
+		sendServiceError(w, err)
+		return
+	}
+
+	msg := models.Message{
+		ID:          models.MessageIDFor(room.ID, clientMsgID),
+		CreatedAt:   createdAt,
+		SenderID:    *currentUserID,
+		RoomID:      room.ID,
+		Content:     in.Text,
+		ClientMsgID: clientMsgID,
+		ExpiresAt:   expiresAt,
+	}
+	if err := ch.RabbitManager.PublishMessage(msg); err != nil {
+		logger.Log.Warn("Не удалось добавить сообщение в очередь", zap.Error(err))
+		responses.SendJSONResponse(w, 500, map[string]any{"Error": "Не удалось отправить сообщение"})
+		return
+	}
+
+	responses.SendJSONResponse(w, 202, map[string]any{
+		"room":       room,
+		"message_id": msg.ID,
+	})
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/andro-kes/Chat/chat/binding"
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/andro-kes/Chat/chat/internal/protocol"
+	"github.com/andro-kes/Chat/chat/logger"
+	"github.com/andro-kes/Chat/chat/responses"
+	"go.uber.org/zap"
+)
+
+// helper struct for parsing message ttl
+type MessageTTLRequest struct {
+	TTL int64 `json:"ttl"`
+}
+
+// SetMessageTTL меняет срок жизни новых сообщений комнаты по умолчанию.
+// Доступно ролям с правом менять настройки комнаты. Уже отправленные сообщения
+// сохраняют свой срок. Участники комнаты получают системное событие message_ttl_changed.
+//
+// Возвращает:
+//   - 200 OK: {"message_ttl": N}.
+//   - 400 Bad Request: При некорректном `id` или ttl (отрицательный или больше 7 дней).
+//   - 403 Forbidden: Если у пользователя нет прав менять настройки комнаты.
+//
+// Пример использования:
+//   PUT /{id}/ttl {"ttl": 3600}
+func (ch *ChatHandlers) SetMessageTTL(w http.ResponseWriter, r *http.Request) {
+	roomID, currentUserID, ok := parseRoomRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req MessageTTLRequest
+	if err := binding.BindWithJSON(r, &req); err != nil {
+		responses.SendJSONResponse(w, 400, map[string]any{
+			"Error": "Недопустимый срок жизни сообщения",
+		})
+		return
+	}
+
+	if err := ch.ChatService.SetMessageTTL(roomID, currentUserID, req.TTL); err != nil {
+		sendServiceError(w, err)
+		return
+	}
+
+	ch.publishSystemEvent(roomID, protocol.SystemPayload{
+		Event:      protocol.EventMessageTTLChanged,
+		ActorID:    currentUserID,
+		MessageTTL: req.TTL,
+	})
+
+	responses.SendJSONResponse(w, 200, map[string]any{
+		"message_ttl": req.TTL,
+	})
+}
+
+// publishExpired рассылает удаление истекших сообщений клиентам их комнат
+// тем же фреймом message_deleted, что и обычное удаление
+func (ch *ChatHandlers) publishExpired(expired []models.Message) {
+	for _, msg := range expired {
+		frame, err := protocol.NewFrame(protocol.TypeMessageDeleted, "", msg)
+		if err != nil {
+			logger.Log.Error("Не удалось собрать фрейм удаления", zap.Error(err))
+			continue
+		}
+		if err := ch.RabbitManager.PublishEvent(msg.RoomID, frame); err != nil {
+			logger.Log.Warn("Не удалось опубликовать удаление истекшего сообщения", zap.String("message_id", msg.ID.String()), zap.Error(err))
+		}
+	}
+}
@@ -1,12 +1,16 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/andro-kes/Chat/chat/binding"
 	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/andro-kes/Chat/chat/internal/protocol"
 	"github.com/andro-kes/Chat/chat/internal/rabbit"
 	"github.com/andro-kes/Chat/chat/internal/services"
 	"github.com/andro-kes/Chat/chat/logger"
@@ -20,6 +24,10 @@ import (
 type ChatHandlers struct {
 	ChatService   services.ChatService
 	RabbitManager rabbit.RabbitManager
+	Typing        *services.TypingThrottle
+	Presence      *services.PresenceTracker
+	Reaper        *services.MessageReaper
+	Scheduler     *services.MessageScheduler
 }
 
 // NewChatHandlers создает и возвращает новый экземпляр обработчика чата.
@@ -34,26 +42,38 @@ func NewChatHandlers() *ChatHandlers {
 	if err != nil {
 		logger.Log.Fatal("Не удалось инициализировать очередь сообщений", zap.Error(err))
 	}
-	return &ChatHandlers{
+	ch := &ChatHandlers{
 		ChatService:   chatService,
 		RabbitManager: rm,
+		Typing:        services.NewTypingThrottle(services.TypingInterval),
 	}
+	ch.Presence = services.NewPresenceTracker(ch.publishPresence)
+	ch.Presence.Start()
+	ch.Reaper = services.NewMessageReaper(chatService, ch.publishExpired)
+	ch.Reaper.Start()
+	ch.Scheduler = services.NewMessageScheduler(chatService, rm.PublishMessage)
+	ch.Scheduler.Start()
+	return ch
 }
 
 // ChatHandler обрабатывает WebSocket-соединение для чата.
 // 
 // Функция:
-// 1. Устанавливает соединение WebSocket.
-// 2. Извлекает идентификатор комнаты из URL-запроса.
-// 3. В цикле считывает сообщения от клиента и передает отправляет их в очередь.
+// 1. Извлекает идентификатор комнаты из URL-запроса и проверяет членство пользователя в ней.
+// 2. Устанавливает соединение WebSocket. Если передан `last_seq`, досылает сообщения
+//    с большим номером до переключения на живую доставку.
+// 3. В цикле считывает фреймы протокола (см. пакет protocol) и публикует сообщения в очередь.
+//    На каждое принятое сообщение клиент получает ack с id, назначенным сервером;
+//    ретрай с тем же client_msg_id получает тот же id.
 // 
 // Параметры:
 //   - w *http.ResponseWriter: Интерфейс для записи HTTP-ответа.
 //   - r *http.Request: HTTP-запрос, содержащий параметр `id` комнаты.
 // 
 // Возвращает:
-//   - 500 Internal Server Error: При ошибке установки соединения.
+//   - 500 Internal Server Error: При ошибке проверки доступа.
 //   - 400 Bad Request: При некорректном формате `id` комнаты.
+//   - 403 Forbidden: Если пользователь не состоит в комнате.
 // 
 // Пример использования:
 //   http.HandleFunc("/chat", ChatHandler)
@@ -71,24 +91,9 @@ func (ch *ChatHandlers) ChatHandler(w http.ResponseWriter, r *http.Request) {
 		WriteBufferSize: 1024,
 	}
 
-	conn, err := upgrader.Upgrade(w, r, nil)
+	roomID, err := roomIDFromRequest(r)
 	if err != nil {
-		logger.Log.Error("Не удалось обновить соединение websocket", zap.Error(err))
-		responses.SendJSONResponse(w, 500, map[string]any{"Error": "Не удалось обновить соединение websocket"})
-		return
-	}
-	defer conn.Close()
-	logger.Log.Info("Соединение установлено")
-
-	vars := mux.Vars(r)
-	idStr := vars["id"]
-	if idStr == "" {
-		// fallback на query param
-		idStr = r.URL.Query().Get("id")
-	}
-	roomID, err := uuid.Parse(idStr)
-	if err != nil {
-		logger.Log.Error("Не удалось спарсить id комнаты", zap.String("id", idStr), zap.Error(err))
+		logger.Log.Error("Не удалось спарсить id комнаты", zap.Error(err))
 		responses.SendJSONResponse(w, 400, map[string]any{"Error": "Неверный идентификатор комнаты"})
 		return
 	}
@@ -101,49 +106,319 @@ func (ch *ChatHandlers) ChatHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Получаем/создаём комнату
-	var roomSvc services.RoomService
-	if ch.ChatService.IsActive(roomID) {
-		roomSvc, err = ch.ChatService.GetRoom(roomID)
-		if err != nil {
-			logger.Log.Error("Не удалось получить комнату", zap.Error(err))
-			responses.SendJSONResponse(w, 500, map[string]any{"Error": "Internal error"})
+	// Проверяем членство до апгрейда, пока еще можно ответить обычным HTTP-статусом
+	if !ch.checkRoomAccess(w, roomID, *currentUserID) {
+		return
+	}
+
+	// При переподключении клиент передает seq последнего полученного сообщения
+	lastSeq := int64(-1)
+	if v := r.URL.Query().Get("last_seq"); v != "" {
+		lastSeq, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || lastSeq < 0 {
+			responses.SendJSONResponse(w, 400, map[string]any{"Error": "Невалидный last_seq"})
 			return
 		}
-	} else {
-		roomSvc = services.NewRoomService(roomID)
-		_ = ch.ChatService.AddRoom(roomSvc)
 	}
 
-	// Регистрируем пользователя в комнате
-	if err := roomSvc.AddUser(*currentUserID, conn); err != nil {
+	wsConn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade сам отвечает клиенту HTTP-ошибкой
+		logger.Log.Error("Не удалось обновить соединение websocket", zap.Error(err))
+		return
+	}
+	defer wsConn.Close()
+	logger.Log.Info("Соединение установлено")
+
+	// Отдельная горутина пишет в сокет и шлет ping, чтение остается в этой горутине
+	client := services.NewClient(*currentUserID, wsConn)
+	go client.WritePump()
+	defer client.Close()
+
+	connected, _ := protocol.NewFrame(protocol.TypeSystem, "", protocol.SystemPayload{
+		Event:  protocol.EventConnected,
+		RoomID: roomID,
+		UserID: *currentUserID,
+	})
+	if err := client.Send(connected); err != nil {
+		logger.Log.Warn("Не удалось отправить фрейм подключения", zap.Error(err))
+		return
+	}
+
+	// Живые сообщения придерживаем, пока досылаем пропущенные
+	if lastSeq >= 0 {
+		client.Hold()
+	}
+
+	// Получаем/создаём комнату и регистрируем в ней пользователя
+	if _, err := ch.ChatService.ConnectClient(roomID, client); err != nil {
 		logger.Log.Warn("Не удалось добавить пользователя в комнату", zap.Error(err))
 		return
 	}
-	defer roomSvc.RemoveUser(*currentUserID)
+	defer ch.ChatService.DisconnectClient(roomID, client)
 
-	// Читаем сообщения от клиента и публикуем
-	for {
-		var in struct {
-			Text string `json:"text"`
+	ch.Presence.Connect(client)
+	defer ch.Presence.Disconnect(client)
+
+	if lastSeq >= 0 {
+		if err := ch.replayMissed(client, roomID, lastSeq); err != nil {
+			logger.Log.Warn("Не удалось дослать пропущенные сообщения", zap.Error(err))
+			return
 		}
-		if err := conn.ReadJSON(&in); err != nil {
+	}
+
+	// Читаем фреймы от клиента
+	for {
+		var frame protocol.Frame
+		if err := client.ReadFrame(&frame); err != nil {
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+				_ = client.Send(protocol.NewError("", protocol.ErrCodeBadFrame, "Невалидный фрейм"))
+				continue
+			}
 			logger.Log.Warn("Не удалось считать сообщение", zap.Error(err))
 			return
 		}
 
+		if err := frame.Check(); err != nil {
+			_ = client.Send(protocol.NewError(frame.ID, protocol.ErrCodeUnsupported, err.Error()))
+			continue
+		}
+
+		if err := ch.handleFrame(client, &frame, roomID, *currentUserID); err != nil {
+			logger.Log.Warn("Не удалось обработать фрейм", zap.String("type", string(frame.Type)), zap.Error(err))
+			return
+		}
+	}
+}
+
+// replayMissed досылает клиенту сообщения с seq больше lastSeq и переключает его
+// на живую доставку. Если пропущено слишком много, вместо досылки клиент получает
+// событие replay_truncated и должен загрузить историю постранично.
+func (ch *ChatHandlers) replayMissed(client *services.Client, roomID uuid.UUID, lastSeq int64) (err error) {
+	replayed := make(map[string]struct{})
+	// Живые сообщения, уже попавшие в досылку, повторно не отправляем.
+	// Если накопленное не удалось отправить, соединение обслуживать дальше нельзя.
+	defer func() {
+		releaseErr := client.Release(func(f protocol.Frame) bool {
+			if f.Type != protocol.TypeMessage {
+				return false
+			}
+			_, ok := replayed[f.ID]
+			return ok
+		})
+		if err == nil {
+			err = releaseErr
+		}
+	}()
+
+	messages, truncated, err := ch.ChatService.GetMissedMessages(roomID, client.UserID, lastSeq, services.MaxReplayMessages)
+	if err != nil {
+		return err
+	}
+
+	if truncated {
+		event, _ := protocol.NewFrame(protocol.TypeSystem, "", protocol.SystemPayload{
+			Event:  protocol.EventReplayTruncated,
+			RoomID: roomID,
+		})
+		return client.Replay(event)
+	}
+
+	for i := range messages {
+		frame, err := protocol.NewFrame(protocol.TypeMessage, messages[i].ID.String(), messages[i])
+		if err != nil {
+			return err
+		}
+		if err := client.Replay(frame); err != nil {
+			return err
+		}
+		replayed[frame.ID] = struct{}{}
+	}
+
+	done, _ := protocol.NewFrame(protocol.TypeSystem, "", protocol.SystemPayload{
+		Event:  protocol.EventReplayDone,
+		RoomID: roomID,
+	})
+	return client.Replay(done)
+}
+
+// handleFrame обрабатывает один фрейм клиента.
+// Ошибки клиента возвращаются ему фреймом error, ошибка из функции означает,
+// что соединение закрыто или дальше обслуживать его нельзя.
+func (ch *ChatHandlers) handleFrame(client *services.Client, frame *protocol.Frame, roomID, userID uuid.UUID) error {
+	switch frame.Type {
+	case protocol.TypeMessage:
+		var in protocol.MessageIn
+		if err := frame.Decode(&in); err != nil {
+			return client.Send(protocol.NewError(frame.ID, protocol.ErrCodeBadFrame, "Невалидное сообщение"))
+		}
+		// Сообщение без текста допустимо, только если к нему приложены файлы
+		if strings.TrimSpace(in.Text) == "" && len(in.AttachmentIDs) == 0 {
+			return client.Send(protocol.NewError(frame.ID, protocol.ErrCodeEmptyMessage, "Пустое сообщение"))
+		}
+
+		// Членство или роль могли измениться, пока соединение открыто
+		if err := ch.ChatService.Authorize(roomID, userID, services.PermPost); err != nil {
+			if errors.Is(err, services.ErrAccessDenied) {
+				return client.Send(protocol.NewError(frame.ID, protocol.ErrCodeForbidden, "Access denied"))
+			}
+			return client.Send(protocol.NewError(frame.ID, protocol.ErrCodeInternal, "Не удалось проверить доступ"))
+		}
+
+		// Без ключа от клиента сообщение не защищено от повторов, но ключ все равно нужен для БД
+		clientMsgID := uuid.New()
+		if in.ClientMsgID != "" {
+			var err error
+			if clientMsgID, err = uuid.Parse(in.ClientMsgID); err != nil {
+				return client.Send(protocol.NewError(frame.ID, protocol.ErrCodeBadFrame, "Невалидный client_msg_id"))
+			}
+		}
+
 		msg := models.Message{
-			CreatedAt: time.Now(),
-			SenderID:  *currentUserID,
-			RoomID:    roomID,
-			Content:   in.Text,
+			ID:          models.MessageIDFor(roomID, clientMsgID),
+			CreatedAt:   time.Now(),
+			SenderID:    userID,
+			RoomID:      roomID,
+			Content:     in.Text,
+			ClientMsgID: clientMsgID,
+		}
+
+		// Срок жизни из фрейма; без него при сохранении подставится срок комнаты
+		expiresAt, err := services.MessageExpiry(msg.CreatedAt, in.TTL)
+		if err != nil {
+			return client.Send(protocol.NewError(frame.ID, protocol.ErrCodeInvalidTTL, err.Error()))
+		}
+		msg.ExpiresAt = expiresAt
+
+		// Ответ в треде: корень проверяем до публикации, чтобы клиент сразу получил ошибку
+		if in.ParentID != "" {
+			parentID, err := uuid.Parse(in.ParentID)
+			if err != nil {
+				return client.Send(protocol.NewError(frame.ID, protocol.ErrCodeBadFrame, "Невалидный parent_id"))
+			}
+			if err := ch.ChatService.CheckReplyParent(roomID, parentID); err != nil {
+				if errors.Is(err, services.ErrMessageNotFound) || errors.Is(err, services.ErrInvalidParent) {
+					return client.Send(protocol.NewError(frame.ID, protocol.ErrCodeInvalidParent, err.Error()))
+				}
+				return client.Send(protocol.NewError(frame.ID, protocol.ErrCodeInternal, "Не удалось проверить сообщение"))
+			}
+			msg.ParentID = &parentID
+		}
+
+		// Вложения проверяем до публикации; привязываются они при сохранении сообщения
+		if len(in.AttachmentIDs) > 0 {
+			ids := make([]uuid.UUID, len(in.AttachmentIDs))
+			for i, v := range in.AttachmentIDs {
+				id, err := uuid.Parse(v)
+				if err != nil {
+					return client.Send(protocol.NewError(frame.ID, protocol.ErrCodeBadFrame, "Невалидный attachment_id"))
+				}
+				ids[i] = id
+			}
+			attachments, err := ch.ChatService.ResolveAttachments(roomID, userID, msg.ID, ids)
+			if err != nil {
+				if errors.Is(err, services.ErrInvalidAttachment) {
+					return client.Send(protocol.NewError(frame.ID, protocol.ErrCodeInvalidAttachment, err.Error()))
+				}
+				return client.Send(protocol.NewError(frame.ID, protocol.ErrCodeInternal, "Не удалось проверить вложения"))
+			}
+			msg.Attachments = attachments
 		}
 
 		// Опубликовать в RabbitMQ
 		if err := ch.RabbitManager.PublishMessage(msg); err != nil {
 			logger.Log.Warn("Не удалось добавить сообщение в очередь", zap.Error(err))
-			return
+			return client.Send(protocol.NewError(frame.ID, protocol.ErrCodeInternal, "Не удалось отправить сообщение"))
+		}
+
+		ack, err := protocol.NewFrame(protocol.TypeAck, frame.ID, protocol.AckPayload{
+			TempID:    frame.ID,
+			MessageID: msg.ID,
+		})
+		if err != nil {
+			return err
 		}
+		return client.Send(ack)
+
+	case protocol.TypeReaction:
+		var in protocol.ReactionPayload
+		if err := frame.Decode(&in); err != nil || (in.Action != protocol.ReactionAdd && in.Action != protocol.ReactionRemove) {
+			return client.Send(protocol.NewError(frame.ID, protocol.ErrCodeBadFrame, "Невалидная реакция"))
+		}
+
+		if _, err := ch.react(roomID, userID, in.MessageID, in.Emoji, in.Action); err != nil {
+			switch {
+			case errors.Is(err, services.ErrAccessDenied):
+				return client.Send(protocol.NewError(frame.ID, protocol.ErrCodeForbidden, "Access denied"))
+			case errors.Is(err, services.ErrMessageNotFound):
+				return client.Send(protocol.NewError(frame.ID, protocol.ErrCodeNotFound, "Сообщение не найдено"))
+			case errors.Is(err, services.ErrInvalidEmoji):
+				return client.Send(protocol.NewError(frame.ID, protocol.ErrCodeBadFrame, "Невалидная реакция"))
+			}
+			logger.Log.Warn("Не удалось изменить реакцию", zap.Error(err))
+			return client.Send(protocol.NewError(frame.ID, protocol.ErrCodeInternal, "Не удалось изменить реакцию"))
+		}
+
+		ack, err := protocol.NewFrame(protocol.TypeAck, frame.ID, protocol.AckPayload{
+			TempID:    frame.ID,
+			MessageID: in.MessageID,
+		})
+		if err != nil {
+			return err
+		}
+		return client.Send(ack)
+
+	case protocol.TypeRead:
+		var in protocol.ReadPayload
+		if err := frame.Decode(&in); err != nil || in.Seq < 0 {
+			return client.Send(protocol.NewError(frame.ID, protocol.ErrCodeBadFrame, "Невалидный курсор чтения"))
+		}
+
+		if _, err := ch.markRead(roomID, userID, in.Seq); err != nil {
+			if errors.Is(err, services.ErrAccessDenied) {
+				return client.Send(protocol.NewError(frame.ID, protocol.ErrCodeForbidden, "Access denied"))
+			}
+			logger.Log.Warn("Не удалось сдвинуть курсор чтения", zap.Error(err))
+			return client.Send(protocol.NewError(frame.ID, protocol.ErrCodeInternal, "Не удалось сдвинуть курсор чтения"))
+		}
+		return nil
+
+	case protocol.TypeTyping:
+		// Членство проверено при подключении; событие эфемерное, поэтому БД не трогаем,
+		// а лишние события в пределах TypingInterval молча отбрасываем
+		if !ch.Typing.Allow(roomID, userID) {
+			return nil
+		}
+		typing, err := protocol.NewFrame(protocol.TypeTyping, "", protocol.TypingPayload{
+			UserID:    userID,
+			ExpiresIn: services.TypingTTL.Milliseconds(),
+		})
+		if err != nil {
+			return err
+		}
+		if err := ch.RabbitManager.PublishEphemeral(roomID, typing, services.TypingTTL); err != nil {
+			logger.Log.Debug("Не удалось опубликовать событие набора текста", zap.Error(err))
+		}
+		return nil
+
+	case protocol.TypePresence:
+		var in protocol.PresenceIn
+		if err := frame.Decode(&in); err != nil {
+			return client.Send(protocol.NewError(frame.ID, protocol.ErrCodeBadFrame, "Невалидный статус"))
+		}
+		if err := ch.Presence.SetStatus(client, models.PresenceStatus(in.Status)); err != nil {
+			return client.Send(protocol.NewError(frame.ID, protocol.ErrCodeBadFrame, "Невалидный статус"))
+		}
+		return nil
+
+	case protocol.TypePing:
+		pong, _ := protocol.NewFrame(protocol.TypePong, frame.ID, nil)
+		return client.Send(pong)
+
+	default:
+		return client.Send(protocol.NewError(frame.ID, protocol.ErrCodeUnknownType, "Неизвестный тип фрейма"))
 	}
 }
 
@@ -152,7 +427,8 @@ func (ch *ChatHandlers) ChatHandler(w http.ResponseWriter, r *http.Request) {
 // Функция:
 // 1. Извлекает идентификатор комнаты из URL-запроса.
 // 2. Проверяет, имеет ли пользователь доступ к комнате.
-// 3. Если комната не активна, запускает её.
+// 
+// Комната становится активной при подключении по WebSocket, а не при открытии страницы.
 // 
 // Параметры:
 //   - w *http.ResponseWriter: Интерфейс для записи HTTP-ответа.
@@ -166,13 +442,10 @@ func (ch *ChatHandlers) ChatHandler(w http.ResponseWriter, r *http.Request) {
 // Пример использования:
 //   http.HandleFunc("/chat_page", ChatPageHandler)
 func (ch *ChatHandlers) ChatPageHandler(w http.ResponseWriter, r *http.Request) {
-	url := r.URL
-	query := url.Query()
-	id := query.Get("id")
-	roomID, err := uuid.Parse(id)
+	roomID, err := roomIDFromRequest(r)
 	if err != nil {
 		logger.Log.Error("Не удалось спарсить id комнаты", zap.Error(err))
-		responses.SendJSONResponse(w, 500, map[string]any{
+		responses.SendJSONResponse(w, 400, map[string]any{
 			"Error": "Неверный идентификатор комнаты",
 		})
 		return
@@ -186,19 +459,10 @@ func (ch *ChatHandlers) ChatPageHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if !ch.ChatService.CheckAccess(*currentUserID) {
-		logger.Log.Warn("У пользователя нет доступа в эту комнату")
-		responses.SendJSONResponse(w, 403, map[string]any{
-			"Error": "Access denied",
-		})
+	if !ch.checkRoomAccess(w, roomID, *currentUserID) {
 		return
 	}
 
-	if !ch.ChatService.IsActive(roomID) {
-		roomService := services.NewRoomService(roomID)
-		ch.ChatService.AddRoom(roomService)
-	}
-
 	// Передаем user_id в шаблон
 	data := map[string]any{
 		"room_id": roomID.String(),
@@ -217,15 +481,15 @@ type RoomName struct {
 // Функция:
 // 1. Извлекает идентификатор пользователя из контекста.
 // 2. Десериализует JSON-запрос с названием комнаты.
-// 3. Создает комнату через сервис.
+// 3. Создает комнату через сервис, создатель становится её участником.
 // 
 // Параметры:
 //   - w *http.ResponseWriter: Интерфейс для записи HTTP-ответа.
 //   - r *http.Request: HTTP-запрос, содержащий данные комнаты и контекст пользователя.
 // 
 // Возвращает:
-//   - 201 Created: Если комната создана.
-//   - 400 Bad Request: При некорректном `id` пользователя.
+//   - 201 Created: Если комната создана, в ответе — созданная комната.
+//   - 400 Bad Request: При некорректном `id` пользователя или пустом названии.
 //   - 409 Conflict: Если комната с таким названием уже существует.
 // 
 // Пример использования:
@@ -248,94 +512,184 @@ func (ch *ChatHandlers) CreateRoom(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = ch.ChatService.CreateRoom(roomName.Name, *currentUserID)
+	if strings.TrimSpace(roomName.Name) == "" {
+		responses.SendJSONResponse(w, 400, map[string]any{
+			"Error": "Невалидное название комнаты",
+		})
+		return
+	}
+
+	room, err := ch.ChatService.CreateRoom(roomName.Name, *currentUserID)
 	if err != nil {
-		logger.Log.Warn("Комната с таким названием уже существует", zap.String("room_name", roomName.Name))
-		responses.SendJSONResponse(w, 409, map[string]any{
-			"Error": "Комната с таким названием уже существует",
+		if errors.Is(err, services.ErrRoomExists) {
+			logger.Log.Warn("Комната с таким названием уже существует", zap.String("room_name", roomName.Name))
+			responses.SendJSONResponse(w, 409, map[string]any{
+				"Error": "Комната с таким названием уже существует",
+			})
+			return
+		}
+		logger.Log.Error("Не удалось создать комнату", zap.String("room_name", roomName.Name), zap.Error(err))
+		responses.SendJSONResponse(w, 500, map[string]any{
+			"Error": "Internal server error",
 		})
 		return
 	}
 
 	responses.SendJSONResponse(w, 201, map[string]any{
 		"Message": "Room was created successfully",
+		"room":    room,
 	})
 }
 
-// GetRoomMessages возвращает список сообщений комнаты.
-// 
-// Функция:
-// 1. Извлекает идентификатор комнаты из URL-запроса.
-// 2. Проверяет, активна ли комната.
-// 3. Возвращает сообщения через сервис.
+// RenameRoom меняет название комнаты. Доступно ролям с правом менять настройки комнаты.
 // 
 // Параметры:
 //   - w *http.ResponseWriter: Интерфейс для записи HTTP-ответа.
-//   - r *http.Request: HTTP-запрос, содержащий параметр `room_id`.
+//   - r *http.Request: HTTP-запрос с `id` комнаты в пути и JSON {"name": "..."}.
 // 
 // Возвращает:
-//   - 200 OK: Список сообщений.
-//   - 404 Not Found: Если комната не найдена или не активна.
+//   - 200 OK: Если комната переименована.
+//   - 400 Bad Request: При некорректном `id` или пустом названии.
+//   - 403 Forbidden: Если у пользователя нет прав менять настройки комнаты.
+//   - 409 Conflict: Если комната с таким названием уже существует.
 // 
 // Пример использования:
-//   http.HandleFunc("/get_messages", GetRoomMessages)
-func (ch *ChatHandlers) GetRoomMessages(w http.ResponseWriter, r *http.Request) {
-	url := r.URL
-	query := url.Query()
-	id := query.Get("room_id")
+//   PATCH /{id} {"name": "new name"}
+func (ch *ChatHandlers) RenameRoom(w http.ResponseWriter, r *http.Request) {
+	roomID, currentUserID, ok := parseRoomRequest(w, r)
+	if !ok {
+		return
+	}
 
-	if id == "" {
+	var roomName RoomName
+	if err := binding.BindWithJSON(r, &roomName); err != nil || strings.TrimSpace(roomName.Name) == "" {
 		responses.SendJSONResponse(w, 400, map[string]any{
-			"Error": "Невалидный id комнаты",
+			"Error": "Невалидное название комнаты",
 		})
-		logger.Log.Warn("Пустой id комнаты")
 		return
 	}
-	
-	roomID, err := uuid.Parse(id)
-	if err != nil {
-		responses.SendJSONResponse(w, 400, map[string]any{
-			"Error": "Невалидный id комнаты",
-		})
-		logger.Log.Warn("Не удалось спарсить id комнаты", zap.String("id", id), zap.Error(err))
+
+	if err := ch.ChatService.RenameRoom(roomID, currentUserID, roomName.Name); err != nil {
+		sendServiceError(w, err)
 		return
 	}
 
-	if !ch.ChatService.IsActive(roomID) {
-		responses.SendJSONResponse(w, 404, map[string]any{
-			"Error": "Комната не активна",
-		})
-		logger.Log.Warn("Комната не активна")
+	ch.publishSystemEvent(roomID, protocol.SystemPayload{
+		Event:   protocol.EventRoomRenamed,
+		ActorID: currentUserID,
+		Name:    roomName.Name,
+	})
+
+	responses.SendJSONResponse(w, 200, map[string]any{
+		"Message": "Room was renamed successfully",
+	})
+}
+
+// DeleteRoom удаляет комнату. Доступно только владельцу.
+// Все WebSocket-соединения с комнатой закрываются на всех инстансах.
+// 
+// Параметры:
+//   - w *http.ResponseWriter: Интерфейс для записи HTTP-ответа.
+//   - r *http.Request: HTTP-запрос с `id` комнаты в пути.
+// 
+// Возвращает:
+//   - 200 OK: Если комната удалена.
+//   - 400 Bad Request: При некорректном `id`.
+//   - 403 Forbidden: Если у пользователя нет прав удалять комнату.
+// 
+// Пример использования:
+//   DELETE /{id}
+func (ch *ChatHandlers) DeleteRoom(w http.ResponseWriter, r *http.Request) {
+	roomID, currentUserID, ok := parseRoomRequest(w, r)
+	if !ok {
 		return
 	}
 
-	room, err := ch.ChatService.GetRoom(roomID)
-	if err != nil {
-		responses.SendJSONResponse(w, 404, map[string]any{
-			"Error": "Комната не найдена",
-		})
-		logger.Log.Warn("Комната не найдена", zap.String("room_id", roomID.String()))
+	if err := ch.ChatService.DeleteRoom(roomID, currentUserID); err != nil {
+		sendServiceError(w, err)
 		return
 	}
 
-	messages, err := room.GetMessages()
+	ch.publishSystemEvent(roomID, protocol.SystemPayload{
+		Event:   protocol.EventRoomDeleted,
+		ActorID: currentUserID,
+	})
+
+	responses.SendJSONResponse(w, 200, map[string]any{
+		"Message": "Room was deleted successfully",
+	})
+}
+
+// GetRoomMessages возвращает страницу истории сообщений комнаты.
+// 
+// Функция:
+// 1. Извлекает идентификатор комнаты из URL-запроса и параметры страницы.
+// 2. Проверяет, что пользователь состоит в комнате.
+// 3. Возвращает страницу сообщений из БД (комната не обязана быть активной).
+//    В ленту попадают только корневые сообщения, ответы отдаются через /thread.
+// 
+// Параметры:
+//   - w *http.ResponseWriter: Интерфейс для записи HTTP-ответа.
+//   - r *http.Request: HTTP-запрос с `id` комнаты в пути и query-параметрами:
+//     `before` или `after` — курсор из предыдущего ответа, `limit` — размер страницы (по умолчанию 50, максимум 100).
+// 
+// Возвращает:
+//   - 200 OK: {"messages": [...], "prev_cursor": "...", "next_cursor": "..."}, сообщения от старых к новым.
+//   - 400 Bad Request: При некорректном `id`, курсоре или `limit`.
+//   - 403 Forbidden: Если пользователь не состоит в комнате.
+// 
+// Пример использования:
+//   GET /{id}/messages?before=<cursor>&limit=50
+func (ch *ChatHandlers) GetRoomMessages(w http.ResponseWriter, r *http.Request) {
+	roomID, currentUserID, ok := parseRoomRequest(w, r)
+	if !ok {
+		return
+	}
+
+	query, ok := parseMessageQuery(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := ch.ChatService.GetMessages(roomID, currentUserID, query)
 	if err != nil {
-		logger.Log.Warn("Не удалось получить сообщения", zap.String("room_id", roomID.String()))
-		responses.SendJSONResponse(w, 500, map[string]any{
-			"Error": "Internal server error",
-		})
+		logger.Log.Warn("Не удалось получить сообщения", zap.String("room_id", roomID.String()), zap.Error(err))
+		sendServiceError(w, err)
 		return
 	}
 
 	responses.SendJSONResponse(w, 200, map[string]any{
-		"Messages": messages,
+		"messages":    page.Messages,
+		"prev_cursor": page.PrevCursor,
+		"next_cursor": page.NextCursor,
 	})
 }
 
+// parseMessageQuery читает параметры страницы истории: before, after и limit
+func parseMessageQuery(w http.ResponseWriter, r *http.Request) (models.MessageQuery, bool) {
+	q := r.URL.Query()
+	query := models.MessageQuery{
+		Before: q.Get("before"),
+		After:  q.Get("after"),
+	}
+	if limit := q.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			responses.SendJSONResponse(w, 400, map[string]any{
+				"Error": "Невалидный limit",
+			})
+			return models.MessageQuery{}, false
+		}
+		query.Limit = n
+	}
+	return query, true
+}
+
 // GetUserRooms возвращает список комнат, к которым имеет доступ текущий пользователь.
 //
 // Извлекает идентификатор пользователя из контекста запроса и вызывает сервис.
-// Отправляет JSON-ответ с массивом комнат.
+// Отправляет JSON-ответ с групповыми комнатами в `rooms` и личными переписками в `direct`;
+// у личной переписки `name` — имя собеседника, `peer_id` — его id.
 //
 // Параметры:
 //   - w *http.ResponseWriter: Интерфейс для записи HTTP-ответа.
@@ -367,7 +721,8 @@ func (ch *ChatHandlers) GetUserRooms(w http.ResponseWriter, r *http.Request) {
 	}
 
 	responses.SendJSONResponse(w, 200, map[string]any{
-		"rooms": rooms,
+		"rooms":  rooms.Rooms,
+		"direct": rooms.Direct,
 	})
 }
 
@@ -400,6 +755,140 @@ func (ch *ChatHandlers) MainPageHandler(w http.ResponseWriter, r *http.Request)
 	responses.SendHTMLResponse(w, 200, "main.html", data)
 }
 
+// roomIDFromRequest извлекает id комнаты из пути `/{id}/...`, а при его отсутствии — из query-параметров
+func roomIDFromRequest(r *http.Request) (uuid.UUID, error) {
+	idStr := mux.Vars(r)["id"]
+	if idStr == "" {
+		idStr = r.URL.Query().Get("id")
+	}
+	if idStr == "" {
+		idStr = r.URL.Query().Get("room_id")
+	}
+	return uuid.Parse(idStr)
+}
+
+// checkRoomAccess проверяет членство пользователя в комнате.
+// Если доступа нет, отправляет 403 (или 500 при ошибке проверки) и возвращает false.
+func (ch *ChatHandlers) checkRoomAccess(w http.ResponseWriter, roomID, userID uuid.UUID) bool {
+	err := ch.ChatService.CheckAccess(roomID, userID)
+	if err == nil {
+		return true
+	}
+
+	logger.Log.Warn(
+		"У пользователя нет доступа в эту комнату",
+		zap.String("room_id", roomID.String()),
+		zap.String("user_id", userID.String()),
+		zap.Error(err),
+	)
+	sendServiceError(w, err)
+	return false
+}
+
+// sendServiceError отправляет ответ с HTTP-статусом, соответствующим ошибке сервиса.
+// Тело ответа всегда имеет вид {"Error": "..."}.
+func sendServiceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrAccessDenied):
+		responses.SendJSONResponse(w, 403, map[string]any{"Error": "Access denied"})
+	case errors.Is(err, services.ErrRoomNotFound):
+		responses.SendJSONResponse(w, 404, map[string]any{"Error": "Комната не найдена"})
+	case errors.Is(err, services.ErrMemberNotFound):
+		responses.SendJSONResponse(w, 404, map[string]any{"Error": "Пользователь не состоит в комнате"})
+	case errors.Is(err, services.ErrAlreadyMember):
+		responses.SendJSONResponse(w, 409, map[string]any{"Error": "Пользователь уже состоит в комнате"})
+	case errors.Is(err, services.ErrRoomExists):
+		responses.SendJSONResponse(w, 409, map[string]any{"Error": "Комната с таким названием уже существует"})
+	case errors.Is(err, services.ErrOwnerMustStay):
+		responses.SendJSONResponse(w, 409, map[string]any{"Error": "Владелец не может покинуть комнату, не передав владение"})
+	case errors.Is(err, services.ErrInvalidCursor):
+		responses.SendJSONResponse(w, 400, map[string]any{"Error": "Невалидный курсор"})
+	case errors.Is(err, services.ErrInvalidRole):
+		responses.SendJSONResponse(w, 400, map[string]any{"Error": "Недопустимая роль"})
+	case errors.Is(err, services.ErrMessageNotFound):
+		responses.SendJSONResponse(w, 404, map[string]any{"Error": "Сообщение не найдено"})
+	case errors.Is(err, services.ErrNotAuthor):
+		responses.SendJSONResponse(w, 403, map[string]any{"Error": "Изменить сообщение может только его автор"})
+	case errors.Is(err, services.ErrEditWindowExpired):
+		responses.SendJSONResponse(w, 403, map[string]any{"Error": "Время на редактирование сообщения истекло"})
+	case errors.Is(err, services.ErrInvalidParent):
+		responses.SendJSONResponse(w, 400, map[string]any{"Error": "Сообщение не является корнем треда"})
+	case errors.Is(err, services.ErrInvalidEmoji):
+		responses.SendJSONResponse(w, 400, map[string]any{"Error": "Недопустимая реакция"})
+	case errors.Is(err, services.ErrAttachmentNotFound):
+		responses.SendJSONResponse(w, 404, map[string]any{"Error": "Вложение не найдено"})
+	case errors.Is(err, services.ErrAttachmentTooLarge):
+		responses.SendJSONResponse(w, 413, map[string]any{"Error": "Вложение слишком большое"})
+	case errors.Is(err, services.ErrAttachmentType):
+		responses.SendJSONResponse(w, 415, map[string]any{"Error": "Недопустимый тип вложения"})
+	case errors.Is(err, services.ErrInvalidAttachment):
+		responses.SendJSONResponse(w, 400, map[string]any{"Error": "Невалидное вложение"})
+	case errors.Is(err, services.ErrInvalidSearch):
+		responses.SendJSONResponse(w, 400, map[string]any{"Error": "Невалидный поисковый запрос"})
+	case errors.Is(err, services.ErrDirectRoom):
+		responses.SendJSONResponse(w, 409, map[string]any{"Error": "Действие недоступно в личной переписке"})
+	case errors.Is(err, services.ErrInvalidPeer):
+		responses.SendJSONResponse(w, 400, map[string]any{"Error": "Нельзя начать переписку с самим собой"})
+	case errors.Is(err, services.ErrUserNotFound):
+		responses.SendJSONResponse(w, 404, map[string]any{"Error": "Пользователь не найден"})
+	case errors.Is(err, services.ErrInvalidSendAt):
+		responses.SendJSONResponse(w, 400, map[string]any{"Error": "Время отправки должно быть в будущем, но не дальше чем через год"})
+	case errors.Is(err, services.ErrScheduledNotFound):
+		responses.SendJSONResponse(w, 404, map[string]any{"Error": "Отложенное сообщение не найдено"})
+	case errors.Is(err, services.ErrTooManyScheduled):
+		responses.SendJSONResponse(w, 409, map[string]any{"Error": "Слишком много отложенных сообщений"})
+	case errors.Is(err, services.ErrInvalidTTL):
+		responses.SendJSONResponse(w, 400, map[string]any{"Error": "Недопустимый срок жизни сообщения"})
+	case errors.Is(err, services.ErrTooManyPins):
+		responses.SendJSONResponse(w, 409, map[string]any{"Error": "В комнате закреплено слишком много сообщений"})
+	default:
+		logger.Log.Error("Внутренняя ошибка сервиса", zap.Error(err))
+		responses.SendJSONResponse(w, 500, map[string]any{"Error": "Internal server error"})
+	}
+}
+
+// publishSystemEvent рассылает системное событие всем клиентам комнаты на всех инстансах.
+// Ошибка публикации только логируется: само действие уже выполнено.
+func (ch *ChatHandlers) publishSystemEvent(roomID uuid.UUID, event protocol.SystemPayload) {
+	event.RoomID = roomID
+	frame, err := protocol.NewFrame(protocol.TypeSystem, "", event)
+	if err != nil {
+		logger.Log.Error("Не удалось собрать системное событие", zap.Error(err))
+		return
+	}
+	if err := ch.RabbitManager.PublishEvent(roomID, frame); err != nil {
+		logger.Log.Warn("Не удалось опубликовать системное событие", zap.String("event", event.Event), zap.Error(err))
+	}
+}
+
+// publishMessageEvent рассылает клиентам комнаты фрейм об изменении сообщения.
+// Как и для системных событий, ошибка публикации только логируется.
+func (ch *ChatHandlers) publishMessageEvent(t protocol.FrameType, msg *models.Message) {
+	frame, err := protocol.NewFrame(t, msg.ID.String(), msg)
+	if err != nil {
+		logger.Log.Error("Не удалось собрать фрейм сообщения", zap.Error(err))
+		return
+	}
+	if err := ch.RabbitManager.PublishEvent(msg.RoomID, frame); err != nil {
+		logger.Log.Warn("Не удалось опубликовать событие сообщения", zap.String("type", string(t)), zap.Error(err))
+	}
+}
+
+// publishPresence рассылает изменившееся присутствие пользователя во все его комнаты.
+// Ошибка публикации только логируется: клиент может запросить статус через /presence.
+func (ch *ChatHandlers) publishPresence(roomIDs []uuid.UUID, presence models.Presence) {
+	frame, err := protocol.NewFrame(protocol.TypePresence, "", presence)
+	if err != nil {
+		logger.Log.Error("Не удалось собрать событие присутствия", zap.Error(err))
+		return
+	}
+	for _, roomID := range roomIDs {
+		if err := ch.RabbitManager.PublishEvent(roomID, frame); err != nil {
+			logger.Log.Warn("Не удалось опубликовать событие присутствия", zap.String("room_id", roomID.String()), zap.Error(err))
+		}
+	}
+}
+
 func getUser(r *http.Request) (*uuid.UUID, error) {
 	user := r.Context().Value("user_id")
 	if user == nil {
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/andro-kes/Chat/chat/internal/protocol"
+	"github.com/andro-kes/Chat/chat/internal/rabbit"
+	"github.com/andro-kes/Chat/chat/internal/services"
+	"github.com/andro-kes/Chat/chat/logger"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestMain(m *testing.M) {
+	logger.Log = zap.NewNop()
+	os.Exit(m.Run())
+}
+
+// fakeChatService отдает заранее заданные пропущенные сообщения.
+// Остальные методы паникуют через встроенный nil-интерфейс.
+type fakeChatService struct {
+	services.ChatService
+
+	missed    []models.Message
+	truncated bool
+	err       error
+	lastSeq   int64
+}
+
+func (s *fakeChatService) GetMissedMessages(roomID, userID uuid.UUID, lastSeq int64, limit int) ([]models.Message, bool, error) {
+	s.lastSeq = lastSeq
+	return s.missed, s.truncated, s.err
+}
+
+// ephemeralPublish — аргументы вызова PublishEphemeral
+type ephemeralPublish struct {
+	roomID uuid.UUID
+	frame  protocol.Frame
+	ttl    time.Duration
+}
+
+// fakeRabbitManager запоминает эфемерные публикации.
+// Остальные методы паникуют через встроенный nil-интерфейс: сохранять такие события нельзя.
+type fakeRabbitManager struct {
+	rabbit.RabbitManager
+
+	ephemeral []ephemeralPublish
+}
+
+func (rm *fakeRabbitManager) PublishEphemeral(roomID uuid.UUID, frame protocol.Frame, ttl time.Duration) error {
+	rm.ephemeral = append(rm.ephemeral, ephemeralPublish{roomID: roomID, frame: frame, ttl: ttl})
+	return nil
+}
+
+// newTestClient возвращает клиента на серверной стороне WebSocket-соединения и подключенного к нему пира
+func newTestClient(t *testing.T) (*services.Client, *websocket.Conn) {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	conns := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	peer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = peer.Close() })
+
+	client := services.NewClient(uuid.New(), <-conns)
+	t.Cleanup(client.Close)
+	go client.WritePump()
+	return client, peer
+}
+
+// sendLive имитирует живую рассылку сообщения по комнате
+func sendLive(t *testing.T, client *services.Client, msg models.Message) {
+	t.Helper()
+	frame, err := protocol.NewFrame(protocol.TypeMessage, msg.ID.String(), msg)
+	require.NoError(t, err)
+	require.NoError(t, client.Send(frame))
+}
+
+// readFrames читает n фреймов пира и возвращает их идентификаторы,
+// а для системных событий — название события
+func readFrames(t *testing.T, peer *websocket.Conn, n int) []string {
+	t.Helper()
+	_ = peer.SetReadDeadline(time.Now().Add(time.Second))
+	got := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		var f protocol.Frame
+		require.NoError(t, peer.ReadJSON(&f))
+		if f.Type == protocol.TypeSystem {
+			var p protocol.SystemPayload
+			require.NoError(t, f.Decode(&p))
+			got = append(got, p.Event)
+			continue
+		}
+		got = append(got, f.ID)
+	}
+	return got
+}
+
+func TestReplayMissedSkipsLiveDuplicates(t *testing.T) {
+	m1 := models.Message{ID: uuid.New(), Seq: 11}
+	m2 := models.Message{ID: uuid.New(), Seq: 12}
+	m3 := models.Message{ID: uuid.New(), Seq: 13}
+	svc := &fakeChatService{missed: []models.Message{m1, m2}}
+	ch := &ChatHandlers{ChatService: svc}
+	client, peer := newTestClient(t)
+
+	// m2 пришло живой рассылкой после подписки, но до чтения истории,
+	// поэтому попадает и в досылку, и в накопленные фреймы
+	client.Hold()
+	sendLive(t, client, m2)
+	sendLive(t, client, m3)
+	require.NoError(t, ch.replayMissed(client, uuid.New(), 10))
+	assert.Equal(t, int64(10), svc.lastSeq)
+
+	want := []string{m1.ID.String(), m2.ID.String(), protocol.EventReplayDone, m3.ID.String()}
+	assert.Equal(t, want, readFrames(t, peer, len(want)))
+}
+
+func TestReplayMissedTruncated(t *testing.T) {
+	svc := &fakeChatService{missed: []models.Message{{ID: uuid.New(), Seq: 1}}, truncated: true}
+	ch := &ChatHandlers{ChatService: svc}
+	client, peer := newTestClient(t)
+	live := models.Message{ID: uuid.New(), Seq: 500}
+
+	client.Hold()
+	sendLive(t, client, live)
+	require.NoError(t, ch.replayMissed(client, uuid.New(), 0))
+
+	want := []string{protocol.EventReplayTruncated, live.ID.String()}
+	assert.Equal(t, want, readFrames(t, peer, len(want)))
+}
+
+func TestTypingPublishedAsThrottledEphemeral(t *testing.T) {
+	rm := &fakeRabbitManager{}
+	ch := &ChatHandlers{
+		ChatService:   &fakeChatService{},
+		RabbitManager: rm,
+		Typing:        services.NewTypingThrottle(time.Hour),
+	}
+	client, _ := newTestClient(t)
+	roomID, userID := uuid.New(), uuid.New()
+	typing, err := protocol.NewFrame(protocol.TypeTyping, "", nil)
+	require.NoError(t, err)
+
+	// Повтор в пределах интервала отбрасывается, другой пользователь проходит
+	require.NoError(t, ch.handleFrame(client, &typing, roomID, userID))
+	require.NoError(t, ch.handleFrame(client, &typing, roomID, userID))
+	require.NoError(t, ch.handleFrame(client, &typing, roomID, uuid.New()))
+
+	require.Len(t, rm.ephemeral, 2)
+	published := rm.ephemeral[0]
+	assert.Equal(t, roomID, published.roomID)
+	assert.Equal(t, services.TypingTTL, published.ttl)
+	assert.Equal(t, protocol.TypeTyping, published.frame.Type)
+
+	var payload protocol.TypingPayload
+	require.NoError(t, published.frame.Decode(&payload))
+	assert.Equal(t, userID, payload.UserID)
+	assert.Equal(t, services.TypingTTL.Milliseconds(), payload.ExpiresIn)
+}
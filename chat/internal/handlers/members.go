@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/andro-kes/Chat/chat/binding"
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/andro-kes/Chat/chat/internal/protocol"
+	"github.com/andro-kes/Chat/chat/logger"
+	"github.com/andro-kes/Chat/chat/responses"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// helper struct for parsing member id
+type MemberRequest struct {
+	UserID uuid.UUID `json:"user_id"`
+}
+
+// GetRoomMembers возвращает участников комнаты.
+//
+// Возвращает:
+//   - 200 OK: {"members": [...]}.
+//   - 400 Bad Request: При некорректном `id` комнаты.
+//   - 403 Forbidden: Если пользователь не состоит в комнате.
+//
+// Пример использования:
+//   GET /{id}/members
+func (ch *ChatHandlers) GetRoomMembers(w http.ResponseWriter, r *http.Request) {
+	roomID, currentUserID, ok := parseRoomRequest(w, r)
+	if !ok {
+		return
+	}
+
+	members, err := ch.ChatService.GetMembers(roomID, currentUserID)
+	if err != nil {
+		sendServiceError(w, err)
+		return
+	}
+
+	responses.SendJSONResponse(w, 200, map[string]any{
+		"members": members,
+	})
+}
+
+// AddRoomMember добавляет пользователя в комнату. Приглашать могут участники комнаты.
+//
+// Возвращает:
+//   - 201 Created: Если пользователь добавлен.
+//   - 400 Bad Request: При некорректном `id` комнаты или теле запроса.
+//   - 403 Forbidden: Если текущий пользователь не состоит в комнате.
+//   - 409 Conflict: Если пользователь уже состоит в комнате.
+//
+// Пример использования:
+//   POST /{id}/members {"user_id": "..."}
+func (ch *ChatHandlers) AddRoomMember(w http.ResponseWriter, r *http.Request) {
+	roomID, currentUserID, ok := parseRoomRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req MemberRequest
+	if err := binding.BindWithJSON(r, &req); err != nil || req.UserID == uuid.Nil {
+		responses.SendJSONResponse(w, 400, map[string]any{
+			"Error": "Невалидный id пользователя",
+		})
+		return
+	}
+
+	if err := ch.ChatService.AddMember(roomID, currentUserID, req.UserID); err != nil {
+		sendServiceError(w, err)
+		return
+	}
+
+	logger.Log.Info("Пользователь добавлен в комнату", zap.String("room_id", roomID.String()), zap.String("user_id", req.UserID.String()))
+	ch.publishSystemEvent(roomID, protocol.SystemPayload{
+		Event:   protocol.EventMemberAdded,
+		UserID:  req.UserID,
+		ActorID: currentUserID,
+	})
+
+	responses.SendJSONResponse(w, 201, map[string]any{
+		"Message": "Member was added successfully",
+	})
+}
+
+// RemoveRoomMember исключает пользователя из комнаты. Исключать можно участников
+// с ролью ниже своей при наличии права управлять участниками. Живые соединения
+// удаленного пользователя с комнатой закрываются на всех инстансах.
+//
+// Возвращает:
+//   - 200 OK: Если пользователь удален.
+//   - 400 Bad Request: При некорректном `id` комнаты или пользователя.
+//   - 403 Forbidden: Если у текущего пользователя нет прав исключать этого участника.
+//   - 404 Not Found: Если пользователь не состоит в комнате.
+//
+// Пример использования:
+//   DELETE /{id}/members/{user_id}
+func (ch *ChatHandlers) RemoveRoomMember(w http.ResponseWriter, r *http.Request) {
+	roomID, currentUserID, ok := parseRoomRequest(w, r)
+	if !ok {
+		return
+	}
+
+	userID, err := uuid.Parse(mux.Vars(r)["user_id"])
+	if err != nil {
+		responses.SendJSONResponse(w, 400, map[string]any{
+			"Error": "Невалидный id пользователя",
+		})
+		return
+	}
+
+	if err := ch.ChatService.RemoveMember(roomID, currentUserID, userID); err != nil {
+		sendServiceError(w, err)
+		return
+	}
+
+	logger.Log.Info("Пользователь удален из комнаты", zap.String("room_id", roomID.String()), zap.String("user_id", userID.String()))
+	ch.publishSystemEvent(roomID, protocol.SystemPayload{
+		Event:   protocol.EventMemberRemoved,
+		UserID:  userID,
+		ActorID: currentUserID,
+	})
+
+	responses.SendJSONResponse(w, 200, map[string]any{
+		"Message": "Member was removed successfully",
+	})
+}
+
+// LeaveRoom удаляет текущего пользователя из участников комнаты.
+//
+// Возвращает:
+//   - 200 OK: Если пользователь покинул комнату.
+//   - 400 Bad Request: При некорректном `id` комнаты.
+//   - 404 Not Found: Если пользователь не состоит в комнате.
+//   - 409 Conflict: Если пользователь — владелец комнаты.
+//
+// Пример использования:
+//   POST /{id}/leave
+func (ch *ChatHandlers) LeaveRoom(w http.ResponseWriter, r *http.Request) {
+	roomID, currentUserID, ok := parseRoomRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := ch.ChatService.LeaveRoom(roomID, currentUserID); err != nil {
+		sendServiceError(w, err)
+		return
+	}
+
+	ch.publishSystemEvent(roomID, protocol.SystemPayload{
+		Event:   protocol.EventMemberRemoved,
+		UserID:  currentUserID,
+		ActorID: currentUserID,
+	})
+
+	responses.SendJSONResponse(w, 200, map[string]any{
+		"Message": "Room was left successfully",
+	})
+}
+
+// parseRoomRequest извлекает id комнаты из пути и id текущего пользователя из контекста.
+// При ошибке отправляет 400 и возвращает false.
+func parseRoomRequest(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	roomID, err := roomIDFromRequest(r)
+	if err != nil {
+		logger.Log.Warn("Не удалось спарсить id комнаты", zap.Error(err))
+		responses.SendJSONResponse(w, 400, map[string]any{
+			"Error": "Невалидный id комнаты",
+		})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	currentUserID, err := getUser(r)
+	if err != nil {
+		responses.SendJSONResponse(w, 400, map[string]any{
+			"error": "Не удалось получить данные о пользователе",
+		})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return roomID, *currentUserID, true
+}
+
+// helper struct for parsing role
+type RoleRequest struct {
+	Role models.Role `json:"role"`
+}
+
+// SetMemberRole назначает участнику комнаты роль (admin, moderator или member).
+//
+// Возвращает:
+//   - 200 OK: Если роль назначена.
+//   - 400 Bad Request: При некорректных id или недопустимой роли.
+//   - 403 Forbidden: Если роль текущего пользователя не выше роли участника и назначаемой роли.
+//   - 404 Not Found: Если пользователь не состоит в комнате.
+//
+// Пример использования:
+//   PUT /{id}/members/{user_id}/role {"role": "moderator"}
+func (ch *ChatHandlers) SetMemberRole(w http.ResponseWriter, r *http.Request) {
+	roomID, currentUserID, ok := parseRoomRequest(w, r)
+	if !ok {
+		return
+	}
+
+	userID, err := uuid.Parse(mux.Vars(r)["user_id"])
+	if err != nil {
+		responses.SendJSONResponse(w, 400, map[string]any{
+			"Error": "Невалидный id пользователя",
+		})
+		return
+	}
+
+	var req RoleRequest
+	if err := binding.BindWithJSON(r, &req); err != nil {
+		responses.SendJSONResponse(w, 400, map[string]any{
+			"Error": "Недопустимая роль",
+		})
+		return
+	}
+
+	if err := ch.ChatService.SetMemberRole(roomID, currentUserID, userID, req.Role); err != nil {
+		sendServiceError(w, err)
+		return
+	}
+
+	ch.publishSystemEvent(roomID, protocol.SystemPayload{
+		Event:   protocol.EventRoleChanged,
+		UserID:  userID,
+		ActorID: currentUserID,
+		Role:    string(req.Role),
+	})
+
+	responses.SendJSONResponse(w, 200, map[string]any{
+		"Message": "Role was changed successfully",
+	})
+}
+
+// TransferOwnership передает владение комнатой другому участнику.
+// Текущий владелец становится администратором.
+//
+// Возвращает:
+//   - 200 OK: Если владение передано.
+//   - 400 Bad Request: При некорректных id.
+//   - 403 Forbidden: Если текущий пользователь не владелец комнаты.
+//   - 404 Not Found: Если новый владелец не состоит в комнате.
+//
+// Пример использования:
+//   POST /{id}/owner {"user_id": "..."}
+func (ch *ChatHandlers) TransferOwnership(w http.ResponseWriter, r *http.Request) {
+	roomID, currentUserID, ok := parseRoomRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req MemberRequest
+	if err := binding.BindWithJSON(r, &req); err != nil || req.UserID == uuid.Nil {
+		responses.SendJSONResponse(w, 400, map[string]any{
+			"Error": "Невалидный id пользователя",
+		})
+		return
+	}
+
+	if err := ch.ChatService.TransferOwnership(roomID, currentUserID, req.UserID); err != nil {
+		sendServiceError(w, err)
+		return
+	}
+
+	ch.publishSystemEvent(roomID, protocol.SystemPayload{
+		Event:   protocol.EventOwnerChanged,
+		UserID:  req.UserID,
+		ActorID: currentUserID,
+	})
+
+	responses.SendJSONResponse(w, 200, map[string]any{
+		"Message": "Ownership was transferred successfully",
+	})
+}
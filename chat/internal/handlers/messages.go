@@ -0,0 +1,337 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/andro-kes/Chat/chat/binding"
+	"github.com/andro-kes/Chat/chat/internal/protocol"
+	"github.com/andro-kes/Chat/chat/logger"
+	"github.com/andro-kes/Chat/chat/responses"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// helper struct for parsing message content
+type MessageRequest struct {
+	Content string `json:"content"`
+}
+
+// EditMessage меняет текст сообщения. Редактировать может только автор;
+// если задан MESSAGE_EDIT_WINDOW, то только в течение этого времени после отправки.
+// Клиенты комнаты получают фрейм message_edited с обновленным сообщением.
+//
+// Возвращает:
+//   - 200 OK: {"message": {...}} — обновленное сообщение.
+//   - 400 Bad Request: При некорректных id или пустом тексте.
+//   - 403 Forbidden: Если пользователь не автор, не может писать в комнату или время вышло.
+//   - 404 Not Found: Если сообщения нет в комнате.
+//
+// Пример использования:
+//   PATCH /{id}/messages/{message_id} {"content": "..."}
+func (ch *ChatHandlers) EditMessage(w http.ResponseWriter, r *http.Request) {
+	roomID, currentUserID, messageID, ok := parseMessageRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req MessageRequest
+	if err := binding.BindWithJSON(r, &req); err != nil || strings.TrimSpace(req.Content) == "" {
+		responses.SendJSONResponse(w, 400, map[string]any{
+			"Error": "Пустое сообщение",
+		})
+		return
+	}
+
+	msg, err := ch.ChatService.EditMessage(roomID, messageID, currentUserID, req.Content)
+	if err != nil {
+		sendServiceError(w, err)
+		return
+	}
+
+	logger.Log.Info("Сообщение отредактировано", zap.String("room_id", roomID.String()), zap.String("message_id", messageID.String()))
+	ch.publishMessageEvent(protocol.TypeMessageEdited, msg)
+
+	responses.SendJSONResponse(w, 200, map[string]any{
+		"message": msg,
+	})
+}
+
+// GetMessageEdits возвращает прежние версии сообщения, от старых к новым.
+//
+// Возвращает:
+//   - 200 OK: {"edits": [...]}.
+//   - 400 Bad Request: При некорректных id.
+//   - 403 Forbidden: Если пользователь не состоит в комнате.
+//   - 404 Not Found: Если сообщения нет в комнате.
+//
+// Пример использования:
+//   GET /{id}/messages/{message_id}/edits
+func (ch *ChatHandlers) GetMessageEdits(w http.ResponseWriter, r *http.Request) {
+	roomID, currentUserID, messageID, ok := parseMessageRequest(w, r)
+	if !ok {
+		return
+	}
+
+	edits, err := ch.ChatService.GetMessageEdits(roomID, messageID, currentUserID)
+	if err != nil {
+		sendServiceError(w, err)
+		return
+	}
+
+	responses.SendJSONResponse(w, 200, map[string]any{
+		"edits": edits,
+	})
+}
+
+// DeleteMessage удаляет сообщение. Свое сообщение может удалить автор,
+// чужое — модератор и выше. В истории вместо сообщения остается «надгробие»
+// с deleted_at, клиенты комнаты получают фрейм message_deleted.
+//
+// Возвращает:
+//   - 200 OK: {"message": {...}} — «надгробие» сообщения.
+//   - 400 Bad Request: При некорректных id.
+//   - 403 Forbidden: Если пользователь не состоит в комнате или удаляет чужое сообщение без прав.
+//   - 404 Not Found: Если сообщения нет в комнате или оно уже удалено.
+//
+// Пример использования:
+//   DELETE /{id}/messages/{message_id}
+func (ch *ChatHandlers) DeleteMessage(w http.ResponseWriter, r *http.Request) {
+	roomID, currentUserID, messageID, ok := parseMessageRequest(w, r)
+	if !ok {
+		return
+	}
+
+	msg, err := ch.ChatService.DeleteMessage(roomID, messageID, currentUserID)
+	if err != nil {
+		sendServiceError(w, err)
+		return
+	}
+
+	logger.Log.Info("Сообщение удалено",
+		zap.String("room_id", roomID.String()),
+		zap.String("message_id", messageID.String()),
+		zap.String("actor_id", currentUserID.String()),
+	)
+	ch.publishMessageEvent(protocol.TypeMessageDeleted, msg)
+
+	responses.SendJSONResponse(w, 200, map[string]any{
+		"message": msg,
+	})
+}
+
+// GetThread возвращает корневое сообщение треда и страницу ответов на него.
+// Пагинация такая же, как у истории комнаты.
+//
+// Возвращает:
+//   - 200 OK: {"parent": {...}, "messages": [...], "prev_cursor": "...", "next_cursor": "..."}.
+//   - 400 Bad Request: При некорректных id, курсоре или limit, а также если сообщение само является ответом.
+//   - 403 Forbidden: Если пользователь не состоит в комнате.
+//   - 404 Not Found: Если сообщения нет в комнате.
+//
+// Пример использования:
+//   GET /{id}/messages/{message_id}/thread?before=<cursor>&limit=50
+func (ch *ChatHandlers) GetThread(w http.ResponseWriter, r *http.Request) {
+	roomID, currentUserID, messageID, ok := parseMessageRequest(w, r)
+	if !ok {
+		return
+	}
+
+	query, ok := parseMessageQuery(w, r)
+	if !ok {
+		return
+	}
+
+	parent, page, err := ch.ChatService.GetThread(roomID, messageID, currentUserID, query)
+	if err != nil {
+		sendServiceError(w, err)
+		return
+	}
+
+	responses.SendJSONResponse(w, 200, map[string]any{
+		"parent":      parent,
+		"messages":    page.Messages,
+		"prev_cursor": page.PrevCursor,
+		"next_cursor": page.NextCursor,
+	})
+}
+
+// helper struct for parsing reaction
+type ReactionRequest struct {
+	Emoji string `json:"emoji"`
+}
+
+// AddReaction ставит реакцию текущего пользователя на сообщение.
+// Повторная реакция тем же эмодзи ничего не меняет. Клиенты комнаты получают фрейм reaction.
+//
+// Возвращает:
+//   - 200 OK: {"emoji": "...", "count": N} — число реакций этим эмодзи.
+//   - 400 Bad Request: При некорректных id или эмодзи.
+//   - 403 Forbidden: Если пользователь не состоит в комнате.
+//   - 404 Not Found: Если сообщения нет в комнате или оно удалено.
+//
+// Пример использования:
+//   POST /{id}/messages/{message_id}/reactions {"emoji": "👍"}
+func (ch *ChatHandlers) AddReaction(w http.ResponseWriter, r *http.Request) {
+	roomID, currentUserID, messageID, ok := parseMessageRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req ReactionRequest
+	if err := binding.BindWithJSON(r, &req); err != nil {
+		responses.SendJSONResponse(w, 400, map[string]any{
+			"Error": "Недопустимая реакция",
+		})
+		return
+	}
+
+	ch.sendReactionResult(w, roomID, currentUserID, messageID, req.Emoji, protocol.ReactionAdd)
+}
+
+// RemoveReaction снимает реакцию текущего пользователя с сообщения.
+//
+// Возвращает:
+//   - 200 OK: {"emoji": "...", "count": N} — число оставшихся реакций этим эмодзи.
+//   - 400 Bad Request: При некорректных id или эмодзи.
+//   - 403 Forbidden: Если пользователь не состоит в комнате.
+//   - 404 Not Found: Если сообщения нет в комнате или оно удалено.
+//
+// Пример использования:
+//   DELETE /{id}/messages/{message_id}/reactions/{emoji}
+func (ch *ChatHandlers) RemoveReaction(w http.ResponseWriter, r *http.Request) {
+	roomID, currentUserID, messageID, ok := parseMessageRequest(w, r)
+	if !ok {
+		return
+	}
+
+	ch.sendReactionResult(w, roomID, currentUserID, messageID, mux.Vars(r)["emoji"], protocol.ReactionRemove)
+}
+
+func (ch *ChatHandlers) sendReactionResult(w http.ResponseWriter, roomID, userID, messageID uuid.UUID, emoji, action string) {
+	count, err := ch.react(roomID, userID, messageID, emoji, action)
+	if err != nil {
+		sendServiceError(w, err)
+		return
+	}
+
+	responses.SendJSONResponse(w, 200, map[string]any{
+		"emoji": emoji,
+		"count": count,
+	})
+}
+
+// react ставит или снимает реакцию и, если она изменилась, рассылает фрейм reaction в комнату.
+// Возвращает число реакций этим эмодзи. Используется и REST-обработчиками, и фреймом reaction из сокета.
+func (ch *ChatHandlers) react(roomID, userID, messageID uuid.UUID, emoji, action string) (int, error) {
+	var (
+		changed bool
+		count   int
+		err     error
+	)
+	if action == protocol.ReactionAdd {
+		changed, count, err = ch.ChatService.AddReaction(roomID, messageID, userID, emoji)
+	} else {
+		changed, count, err = ch.ChatService.RemoveReaction(roomID, messageID, userID, emoji)
+	}
+	if err != nil || !changed {
+		return count, err
+	}
+
+	frame, err := protocol.NewFrame(protocol.TypeReaction, "", protocol.ReactionPayload{
+		MessageID: messageID,
+		Emoji:     emoji,
+		Action:    action,
+		UserID:    userID,
+		Count:     count,
+	})
+	if err != nil {
+		logger.Log.Error("Не удалось собрать фрейм реакции", zap.Error(err))
+		return count, nil
+	}
+	if err := ch.RabbitManager.PublishEvent(roomID, frame); err != nil {
+		logger.Log.Warn("Не удалось опубликовать реакцию", zap.Error(err))
+	}
+	return count, nil
+}
+
+// helper struct for parsing read cursor
+type ReadRequest struct {
+	Seq int64 `json:"seq"`
+}
+
+// MarkRead отмечает сообщения комнаты до seq включительно прочитанными.
+// Курсор только растет и не уходит дальше последнего сообщения комнаты;
+// если он сдвинулся, участники комнаты получают фрейм read.
+//
+// Возвращает:
+//   - 200 OK: {"last_read_seq": N}.
+//   - 400 Bad Request: При некорректном `id` комнаты или seq.
+//   - 403 Forbidden: Если пользователь не состоит в комнате.
+//
+// Пример использования:
+//   POST /{id}/read {"seq": 42}
+func (ch *ChatHandlers) MarkRead(w http.ResponseWriter, r *http.Request) {
+	roomID, currentUserID, ok := parseRoomRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req ReadRequest
+	if err := binding.BindWithJSON(r, &req); err != nil || req.Seq < 0 {
+		responses.SendJSONResponse(w, 400, map[string]any{
+			"Error": "Невалидный seq",
+		})
+		return
+	}
+
+	current, err := ch.markRead(roomID, currentUserID, req.Seq)
+	if err != nil {
+		sendServiceError(w, err)
+		return
+	}
+
+	responses.SendJSONResponse(w, 200, map[string]any{
+		"last_read_seq": current,
+	})
+}
+
+// markRead сдвигает курсор чтения и, если он изменился, рассылает в комнату уведомление о прочтении
+func (ch *ChatHandlers) markRead(roomID, userID uuid.UUID, seq int64) (int64, error) {
+	current, changed, err := ch.ChatService.MarkRead(roomID, userID, seq)
+	if err != nil || !changed {
+		return current, err
+	}
+
+	frame, err := protocol.NewFrame(protocol.TypeRead, "", protocol.ReadPayload{
+		UserID: userID,
+		Seq:    current,
+	})
+	if err != nil {
+		logger.Log.Error("Не удалось собрать фрейм прочтения", zap.Error(err))
+		return current, nil
+	}
+	if err := ch.RabbitManager.PublishEvent(roomID, frame); err != nil {
+		logger.Log.Warn("Не удалось опубликовать уведомление о прочтении", zap.Error(err))
+	}
+	return current, nil
+}
+
+// parseMessageRequest дополняет parseRoomRequest id сообщения из пути
+func parseMessageRequest(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, uuid.UUID, bool) {
+	roomID, currentUserID, ok := parseRoomRequest(w, r)
+	if !ok {
+		return uuid.Nil, uuid.Nil, uuid.Nil, false
+	}
+
+	messageID, err := uuid.Parse(mux.Vars(r)["message_id"])
+	if err != nil {
+		responses.SendJSONResponse(w, 400, map[string]any{
+			"Error": "Невалидный id сообщения",
+		})
+		return uuid.Nil, uuid.Nil, uuid.Nil, false
+	}
+
+	return roomID, currentUserID, messageID, true
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/andro-kes/Chat/chat/internal/protocol"
+	"github.com/andro-kes/Chat/chat/logger"
+	"github.com/andro-kes/Chat/chat/responses"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// PinMessage закрепляет сообщение в комнате. Закреплять могут владелец и администраторы.
+// Повторное закрепление ничего не меняет. Клиенты комнаты получают фрейм pin.
+//
+// Возвращает:
+//   - 200 OK: {"message_id": "...", "pinned_at": "..."}.
+//   - 400 Bad Request: При некорректных id.
+//   - 403 Forbidden: Если у пользователя нет права закреплять сообщения.
+//   - 404 Not Found: Если сообщения нет в комнате или оно удалено.
+//   - 409 Conflict: Если в комнате уже закреплено максимальное число сообщений.
+//
+// Пример использования:
+//   POST /{id}/messages/{message_id}/pin
+func (ch *ChatHandlers) PinMessage(w http.ResponseWriter, r *http.Request) {
+	roomID, currentUserID, messageID, ok := parseMessageRequest(w, r)
+	if !ok {
+		return
+	}
+
+	changed, pinnedAt, err := ch.ChatService.PinMessage(roomID, messageID, currentUserID)
+	if err != nil {
+		sendServiceError(w, err)
+		return
+	}
+	if changed {
+		ch.publishPin(roomID, protocol.PinPayload{
+			MessageID: messageID,
+			Action:    protocol.PinAdd,
+			UserID:    currentUserID,
+			At:        pinnedAt,
+		})
+	}
+
+	responses.SendJSONResponse(w, 200, map[string]any{
+		"message_id": messageID,
+		"pinned_at":  pinnedAt,
+	})
+}
+
+// UnpinMessage открепляет сообщение. Откреплять могут владелец и администраторы.
+// Если сообщение было закреплено, клиенты комнаты получают фрейм pin с действием unpin.
+//
+// Возвращает:
+//   - 200 OK: Если сообщение откреплено или не было закреплено.
+//   - 400 Bad Request: При некорректных id.
+//   - 403 Forbidden: Если у пользователя нет права закреплять сообщения.
+//
+// Пример использования:
+//   DELETE /{id}/messages/{message_id}/pin
+func (ch *ChatHandlers) UnpinMessage(w http.ResponseWriter, r *http.Request) {
+	roomID, currentUserID, messageID, ok := parseMessageRequest(w, r)
+	if !ok {
+		return
+	}
+
+	changed, err := ch.ChatService.UnpinMessage(roomID, messageID, currentUserID)
+	if err != nil {
+		sendServiceError(w, err)
+		return
+	}
+	if changed {
+		ch.publishPin(roomID, protocol.PinPayload{
+			MessageID: messageID,
+			Action:    protocol.PinRemove,
+			UserID:    currentUserID,
+			At:        time.Now(),
+		})
+	}
+
+	responses.SendJSONResponse(w, 200, map[string]any{
+		"Message": "Message was unpinned successfully",
+	})
+}
+
+// GetPins возвращает закрепленные сообщения комнаты, последние закрепленные первыми.
+// У каждого сообщения указано, кто и когда его закрепил.
+//
+// Возвращает:
+//   - 200 OK: {"pins": [...]}.
+//   - 400 Bad Request: При некорректном `id` комнаты.
+//   - 403 Forbidden: Если пользователь не состоит в комнате.
+//
+// Пример использования:
+//   GET /{id}/pins
+func (ch *ChatHandlers) GetPins(w http.ResponseWriter, r *http.Request) {
+	roomID, currentUserID, ok := parseRoomRequest(w, r)
+	if !ok {
+		return
+	}
+
+	pins, err := ch.ChatService.GetPins(roomID, currentUserID)
+	if err != nil {
+		sendServiceError(w, err)
+		return
+	}
+
+	responses.SendJSONResponse(w, 200, map[string]any{
+		"pins": pins,
+	})
+}
+
+// publishPin рассылает изменение закрепления всем клиентам комнаты.
+// Ошибка публикации только логируется: закрепление уже сохранено.
+func (ch *ChatHandlers) publishPin(roomID uuid.UUID, pin protocol.PinPayload) {
+	frame, err := protocol.NewFrame(protocol.TypePin, "", pin)
+	if err != nil {
+		logger.Log.Error("Не удалось собрать фрейм закрепления", zap.Error(err))
+		return
+	}
+	if err := ch.RabbitManager.PublishEvent(roomID, frame); err != nil {
+		logger.Log.Warn("Не удалось опубликовать закрепление", zap.Error(err))
+	}
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/andro-kes/Chat/chat/internal/services"
+	"github.com/andro-kes/Chat/chat/logger"
+	"github.com/andro-kes/Chat/chat/responses"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// GetPresence возвращает присутствие пользователей: online, away или offline
+// и время, когда у пользователя последний раз было открытое соединение.
+// Пользователи, не состоящие с текущим в общей комнате, в ответ не попадают.
+//
+// Возвращает:
+//   - 200 OK: {"presence": [{"user_id", "status", "last_seen_at"}]}.
+//   - 400 Bad Request: Если `user_ids` пуст, содержит невалидный id или больше MaxPresenceUsers.
+//
+// Пример использования:
+//   GET /presence?user_ids=<uuid>,<uuid>
+func (ch *ChatHandlers) GetPresence(w http.ResponseWriter, r *http.Request) {
+	currentUserID, err := getUser(r)
+	if err != nil {
+		responses.SendJSONResponse(w, 401, map[string]any{"Error": "Unauthorized"})
+		return
+	}
+
+	var userIDs []uuid.UUID
+	for _, v := range strings.Split(r.URL.Query().Get("user_ids"), ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		id, err := uuid.Parse(v)
+		if err != nil {
+			responses.SendJSONResponse(w, 400, map[string]any{"Error": "Невалидный id пользователя"})
+			return
+		}
+		userIDs = append(userIDs, id)
+	}
+	if len(userIDs) == 0 || len(userIDs) > services.MaxPresenceUsers {
+		responses.SendJSONResponse(w, 400, map[string]any{"Error": "Невалидный список пользователей"})
+		return
+	}
+
+	presence, err := ch.Presence.GetPresence(*currentUserID, userIDs)
+	if err != nil {
+		logger.Log.Error("Не удалось получить присутствие", zap.Error(err))
+		responses.SendJSONResponse(w, 500, map[string]any{"Error": "Internal server error"})
+		return
+	}
+
+	responses.SendJSONResponse(w, 200, map[string]any{
+		"presence": presence,
+	})
+}
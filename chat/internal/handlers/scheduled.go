@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/andro-kes/Chat/chat/binding"
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/andro-kes/Chat/chat/responses"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// helper struct for parsing scheduled message
+type ScheduleRequest struct {
+	Text     string    `json:"text"`
+	SendAt   time.Time `json:"send_at"`
+	ParentID string    `json:"parent_id,omitempty"`
+	TTL      int64     `json:"ttl,omitempty"`
+}
+
+// helper struct for parsing scheduled message changes; absent fields stay unchanged
+type ScheduleUpdateRequest struct {
+	Text   *string    `json:"text"`
+	SendAt *time.Time `json:"send_at"`
+}
+
+// ScheduleMessage планирует отправку сообщения в комнату. Когда наступит send_at,
+// планировщик опубликует сообщение так же, как фрейм message, и его получат все клиенты комнаты.
+// Если к этому времени автор уже не может писать в комнату, сообщение не отправляется.
+//
+// Возвращает:
+//   - 201 Created: {"scheduled": {id, room_id, sender_id, content, parent_id, ttl, send_at, created_at}}.
+//   - 400 Bad Request: При некорректном `id`, пустом тексте, send_at в прошлом или дальше чем через год,
+//     недопустимом ttl или parent_id.
+//   - 403 Forbidden: Если пользователь не может писать в комнату.
+//   - 409 Conflict: Если в комнате уже слишком много отложенных сообщений пользователя.
+//
+// Пример использования:
+//   POST /{id}/scheduled {"text": "С днем рождения!", "send_at": "2025-01-01T09:00:00Z"}
+func (ch *ChatHandlers) ScheduleMessage(w http.ResponseWriter, r *http.Request) {
+	roomID, currentUserID, ok := parseRoomRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req ScheduleRequest
+	if err := binding.BindWithJSON(r, &req); err != nil || strings.TrimSpace(req.Text) == "" {
+		responses.SendJSONResponse(w, 400, map[string]any{
+			"Error": "Пустое сообщение",
+		})
+		return
+	}
+
+	sm := models.ScheduledMessage{
+		RoomID:   roomID,
+		SenderID: currentUserID,
+		Content:  req.Text,
+		TTL:      req.TTL,
+		SendAt:   req.SendAt,
+	}
+	if req.ParentID != "" {
+		parentID, err := uuid.Parse(req.ParentID)
+		if err != nil {
+			responses.SendJSONResponse(w, 400, map[string]any{
+				"Error": "Невалидный parent_id",
+			})
+			return
+		}
+		sm.ParentID = &parentID
+	}
+
+	if err := ch.ChatService.ScheduleMessage(&sm); err != nil {
+		sendServiceError(w, err)
+		return
+	}
+
+	responses.SendJSONResponse(w, 201, map[string]any{
+		"scheduled": sm,
+	})
+}
+
+// GetScheduled возвращает неотправленные сообщения текущего пользователя в порядке отправки.
+// Параметр room_id ограничивает список одной комнатой.
+//
+// Возвращает:
+//   - 200 OK: {"scheduled": [...]}.
+//   - 400 Bad Request: При некорректном room_id.
+//
+// Пример использования:
+//   GET /scheduled?room_id=<uuid>
+func (ch *ChatHandlers) GetScheduled(w http.ResponseWriter, r *http.Request) {
+	currentUserID, err := getUser(r)
+	if err != nil {
+		responses.SendJSONResponse(w, 401, map[string]any{"Error": "Unauthorized"})
+		return
+	}
+
+	var roomID uuid.UUID
+	if v := r.URL.Query().Get("room_id"); v != "" {
+		if roomID, err = uuid.Parse(v); err != nil {
+			responses.SendJSONResponse(w, 400, map[string]any{"Error": "Невалидный id комнаты"})
+			return
+		}
+	}
+
+	scheduled, err := ch.ChatService.GetScheduled(*currentUserID, roomID)
+	if err != nil {
+		sendServiceError(w, err)
+		return
+	}
+
+	responses.SendJSONResponse(w, 200, map[string]any{
+		"scheduled": scheduled,
+	})
+}
+
+// EditScheduled меняет текст и/или время отправки своего неотправленного сообщения.
+//
+// Возвращает:
+//   - 200 OK: {"scheduled": {...}} — обновленное сообщение.
+//   - 400 Bad Request: При некорректном id, пустом тексте или недопустимом send_at.
+//   - 404 Not Found: Если сообщения нет, оно чужое или уже отправлено.
+//
+// Пример использования:
+//   PATCH /scheduled/{scheduled_id} {"text": "...", "send_at": "2025-01-01T10:00:00Z"}
+func (ch *ChatHandlers) EditScheduled(w http.ResponseWriter, r *http.Request) {
+	scheduledID, currentUserID, ok := parseScheduledRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req ScheduleUpdateRequest
+	if err := binding.BindWithJSON(r, &req); err != nil || (req.Text == nil && req.SendAt == nil) || (req.Text != nil && strings.TrimSpace(*req.Text) == "") {
+		responses.SendJSONResponse(w, 400, map[string]any{
+			"Error": "Невалидные изменения",
+		})
+		return
+	}
+
+	sm, err := ch.ChatService.EditScheduled(scheduledID, currentUserID, req.Text, req.SendAt)
+	if err != nil {
+		sendServiceError(w, err)
+		return
+	}
+
+	responses.SendJSONResponse(w, 200, map[string]any{
+		"scheduled": sm,
+	})
+}
+
+// CancelScheduled отменяет свое неотправленное сообщение.
+//
+// Возвращает:
+//   - 200 OK: Если сообщение отменено.
+//   - 400 Bad Request: При некорректном id.
+//   - 404 Not Found: Если сообщения нет, оно чужое или уже отправлено.
+//
+// Пример использования:
+//   DELETE /scheduled/{scheduled_id}
+func (ch *ChatHandlers) CancelScheduled(w http.ResponseWriter, r *http.Request) {
+	scheduledID, currentUserID, ok := parseScheduledRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := ch.ChatService.CancelScheduled(scheduledID, currentUserID); err != nil {
+		sendServiceError(w, err)
+		return
+	}
+
+	responses.SendJSONResponse(w, 200, map[string]any{
+		"Message": "Scheduled message was cancelled successfully",
+	})
+}
+
+// parseScheduledRequest возвращает id отложенного сообщения из пути и текущего пользователя.
+// При ошибке сам отвечает клиенту.
+func parseScheduledRequest(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	scheduledID, err := uuid.Parse(mux.Vars(r)["scheduled_id"])
+	if err != nil {
+		responses.SendJSONResponse(w, 400, map[string]any{
+			"Error": "Невалидный id отложенного сообщения",
+		})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	currentUserID, err := getUser(r)
+	if err != nil {
+		responses.SendJSONResponse(w, 401, map[string]any{"Error": "Unauthorized"})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return scheduledID, *currentUserID, true
+}
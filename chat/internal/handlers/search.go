@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/andro-kes/Chat/chat/responses"
+	"github.com/google/uuid"
+)
+
+// SearchMessages ищет сообщения по тексту во всех комнатах текущего пользователя.
+//
+// Параметры запроса:
+//   - q: поисковый запрос (обязателен), поддерживаются "фразы", OR и -исключения.
+//   - room_id, sender_id: ограничить поиск комнатой или автором.
+//   - from, to: интервал created_at в RFC3339, from включительно, to — нет.
+//   - cursor, limit: пагинация, курсор берется из next_cursor предыдущей страницы.
+//
+// Возвращает:
+//   - 200 OK: {"results": [{...сообщение, "snippet"}], "next_cursor"}, от новых к старым.
+//     В snippet совпадения обернуты в <mark>, остальной текст экранирован.
+//   - 400 Bad Request: При пустом запросе, невалидном фильтре или курсоре.
+//
+// Пример использования:
+//   GET /search?q=отчет&room_id=<uuid>&from=2024-01-01T00:00:00Z
+func (ch *ChatHandlers) SearchMessages(w http.ResponseWriter, r *http.Request) {
+	currentUserID, err := getUser(r)
+	if err != nil {
+		responses.SendJSONResponse(w, 401, map[string]any{"Error": "Unauthorized"})
+		return
+	}
+
+	query, ok := parseSearchQuery(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := ch.ChatService.SearchMessages(*currentUserID, query)
+	if err != nil {
+		sendServiceError(w, err)
+		return
+	}
+
+	responses.SendJSONResponse(w, 200, map[string]any{
+		"results":     page.Results,
+		"next_cursor": page.NextCursor,
+	})
+}
+
+// parseSearchQuery разбирает фильтры поиска. При ошибке сам отвечает клиенту 400.
+func parseSearchQuery(w http.ResponseWriter, r *http.Request) (models.SearchQuery, bool) {
+	q := r.URL.Query()
+	query := models.SearchQuery{
+		Text:   q.Get("q"),
+		Cursor: q.Get("cursor"),
+	}
+
+	var err error
+	if v := q.Get("room_id"); v != "" {
+		if query.RoomID, err = uuid.Parse(v); err != nil {
+			responses.SendJSONResponse(w, 400, map[string]any{"Error": "Неверный идентификатор комнаты"})
+			return models.SearchQuery{}, false
+		}
+	}
+	if v := q.Get("sender_id"); v != "" {
+		if query.SenderID, err = uuid.Parse(v); err != nil {
+			responses.SendJSONResponse(w, 400, map[string]any{"Error": "Невалидный id пользователя"})
+			return models.SearchQuery{}, false
+		}
+	}
+	// Время сообщений хранится в UTC
+	if v := q.Get("from"); v != "" {
+		if query.From, err = time.Parse(time.RFC3339, v); err != nil {
+			responses.SendJSONResponse(w, 400, map[string]any{"Error": "Невалидный from"})
+			return models.SearchQuery{}, false
+		}
+		query.From = query.From.UTC()
+	}
+	if v := q.Get("to"); v != "" {
+		if query.To, err = time.Parse(time.RFC3339, v); err != nil {
+			responses.SendJSONResponse(w, 400, map[string]any{"Error": "Невалидный to"})
+			return models.SearchQuery{}, false
+		}
+		query.To = query.To.UTC()
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			responses.SendJSONResponse(w, 400, map[string]any{"Error": "Невалидный limit"})
+			return models.SearchQuery{}, false
+		}
+		query.Limit = n
+	}
+	return query, true
+}
@@ -6,10 +6,142 @@ import (
 	"github.com/google/uuid"
 )
 
+// Message — сообщение комнаты. Seq — порядковый номер в комнате, назначается при сохранении
+// без пропусков; ClientMsgID — ключ идемпотентности, уникальный в пределах комнаты.
+// EditedAt заполнен, если сообщение редактировалось. Удаленное сообщение отдается
+// как «надгробие»: с DeletedAt и DeletedBy, но без текста.
+//
+// ParentID задан у ответа в треде. У корневого сообщения ReplyCount и LastReplyAt
+// описывают его тред; вложенных тредов нет.
+//
+// ExpiresAt задан у исчезающего сообщения: после этого момента оно удаляется из базы.
 type Message struct {
-	ID        uint      `db:"id" json:"id"`
-	CreatedAt time.Time `db:"created_at" json:"CreatedAt"`
-	SenderID  uuid.UUID `db:"sender_id" json:"SenderID"`
-	RoomID    uuid.UUID `db:"room_id" json:"RoomID"`
-	Content   string    `db:"content" json:"Text"`
-}
\ No newline at end of file
+	ID          uuid.UUID  `db:"id" json:"id"`
+	Seq         int64      `db:"seq" json:"seq"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+	SenderID    uuid.UUID  `db:"user_id" json:"sender_id"`
+	RoomID      uuid.UUID  `db:"room_id" json:"room_id"`
+	Content     string     `db:"content" json:"content"`
+	ClientMsgID uuid.UUID  `db:"client_msg_id" json:"client_msg_id"`
+	EditedAt    *time.Time `db:"edited_at" json:"edited_at,omitempty"`
+	DeletedAt   *time.Time `db:"deleted_at" json:"deleted_at,omitempty"`
+	DeletedBy   *uuid.UUID `db:"deleted_by" json:"deleted_by,omitempty"`
+	ParentID    *uuid.UUID `db:"parent_id" json:"parent_id,omitempty"`
+	ReplyCount  int        `db:"reply_count" json:"reply_count"`
+	LastReplyAt *time.Time `db:"last_reply_at" json:"last_reply_at,omitempty"`
+	ExpiresAt   *time.Time `db:"expires_at" json:"expires_at,omitempty"`
+	// Reactions — реакции на сообщение, заполняются при выдаче истории конкретному пользователю
+	Reactions []ReactionCount `json:"reactions,omitempty"`
+	// Attachments — вложенные файлы; у удаленного сообщения не отдаются
+	Attachments []Attachment `json:"attachments,omitempty"`
+	// Mentions — упомянутые в тексте участники комнаты, заполняются при сохранении
+	// и нужны только для уведомлений
+	Mentions []uuid.UUID `json:"-"`
+}
+
+// ReactionCount — сколько пользователей отреагировали на сообщение эмодзи
+// и есть ли среди них запросивший историю пользователь
+type ReactionCount struct {
+	Emoji   string `json:"emoji"`
+	Count   int    `json:"count"`
+	Reacted bool   `json:"reacted"`
+}
+
+// Attachment — метаданные файла, загруженного в комнату. Содержимое лежит в хранилище
+// под StorageKey. Пока MessageID пуст, вложение не привязано к сообщению и доступно только загрузившему.
+// Checksum — SHA-256 содержимого в hex.
+type Attachment struct {
+	ID         uuid.UUID  `db:"id" json:"id"`
+	RoomID     uuid.UUID  `db:"room_id" json:"room_id"`
+	UploaderID uuid.UUID  `db:"uploader_id" json:"uploader_id"`
+	MessageID  *uuid.UUID `db:"message_id" json:"message_id,omitempty"`
+	Name       string     `db:"name" json:"name"`
+	Size       int64      `db:"size" json:"size"`
+	MimeType   string     `db:"mime_type" json:"mime_type"`
+	Checksum   string     `db:"checksum" json:"checksum"`
+	StorageKey string     `db:"storage_key" json:"-"`
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+}
+
+// MessageEdit — прежняя версия отредактированного сообщения.
+// CreatedAt — когда версия появилась, ReplacedAt — когда ее заменила следующая.
+type MessageEdit struct {
+	MessageID  uuid.UUID `db:"message_id" json:"message_id"`
+	Content    string    `db:"content" json:"content"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+	ReplacedAt time.Time `db:"replaced_at" json:"replaced_at"`
+}
+
+// MessageIDFor возвращает id сообщения для ключа идемпотентности.
+// Id детерминирован, поэтому ретрай получает в ack тот же id, что и исходное сообщение.
+func MessageIDFor(roomID, clientMsgID uuid.UUID) uuid.UUID {
+	return uuid.NewSHA1(roomID, clientMsgID[:])
+}
+
+// MessageQuery — параметры запроса страницы истории. Before и After — непрозрачные курсоры,
+// полученные из MessagePage; одновременно может быть задан только один из них.
+// Без ParentID запрашивается лента комнаты (только корневые сообщения), с ParentID — тред.
+type MessageQuery struct {
+	Before   string
+	After    string
+	Limit    int
+	ParentID uuid.UUID
+}
+
+// MessagePage — страница истории сообщений в хронологическом порядке.
+// PrevCursor указывает на более старые сообщения, NextCursor — на более новые;
+// пустой курсор означает, что в этом направлении сообщений больше нет.
+type MessagePage struct {
+	Messages   []Message `json:"messages"`
+	PrevCursor string    `json:"prev_cursor,omitempty"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// SearchQuery — параметры полнотекстового поиска по сообщениям.
+// Нулевые RoomID, SenderID, From и To означают, что фильтр не задан.
+// Cursor — непрозрачный курсор из SearchPage.NextCursor.
+type SearchQuery struct {
+	Text     string
+	RoomID   uuid.UUID
+	SenderID uuid.UUID
+	From     time.Time
+	To       time.Time
+	Cursor   string
+	Limit    int
+}
+
+// ScheduledMessage — сообщение, которое автор запланировал отправить в SendAt.
+// После отправки id становится ключом идемпотентности (ClientMsgID) сообщения.
+// TTL — срок жизни отправленного сообщения в секундах, 0 — срок комнаты.
+type ScheduledMessage struct {
+	ID        uuid.UUID  `db:"id" json:"id"`
+	RoomID    uuid.UUID  `db:"room_id" json:"room_id"`
+	SenderID  uuid.UUID  `db:"user_id" json:"sender_id"`
+	Content   string     `db:"content" json:"content"`
+	ParentID  *uuid.UUID `db:"parent_id" json:"parent_id,omitempty"`
+	TTL       int64      `db:"ttl" json:"ttl,omitempty"`
+	SendAt    time.Time  `db:"send_at" json:"send_at"`
+	CreatedAt time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt *time.Time `db:"updated_at" json:"updated_at,omitempty"`
+}
+
+// PinnedMessage — закрепленное сообщение комнаты: кто и когда его закрепил
+type PinnedMessage struct {
+	Message
+	PinnedBy uuid.UUID `json:"pinned_by"`
+	PinnedAt time.Time `json:"pinned_at"`
+}
+
+// SearchResult — найденное сообщение и фрагмент его текста, где совпадения
+// обернуты в <mark>. Остальной текст фрагмента экранирован для HTML.
+type SearchResult struct {
+	Message
+	Snippet string `json:"snippet"`
+}
+
+// SearchPage — страница результатов поиска от новых сообщений к старым.
+// Пустой NextCursor означает, что результатов больше нет.
+type SearchPage struct {
+	Results    []SearchResult `json:"results"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
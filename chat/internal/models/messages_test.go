@@ -0,0 +1,52 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageIDFor(t *testing.T) {
+	room := uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	otherRoom := uuid.MustParse("6ba7b811-9dad-11d1-80b4-00c04fd430c8")
+	key := uuid.MustParse("f47ac10b-58cc-4372-a567-0e02b2c3d479")
+	otherKey := uuid.MustParse("f47ac10b-58cc-4372-a567-0e02b2c3d47a")
+
+	id := MessageIDFor(room, key)
+
+	tests := []struct {
+		name      string
+		roomID    uuid.UUID
+		clientID  uuid.UUID
+		wantEqual bool
+	}{
+		{"тот же ключ в той же комнате", room, key, true},
+		{"другой ключ", room, otherKey, false},
+		{"тот же ключ в другой комнате", otherRoom, key, false},
+		{"аргументы поменяны местами", key, room, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MessageIDFor(tt.roomID, tt.clientID)
+			if tt.wantEqual {
+				assert.Equal(t, id, got)
+			} else {
+				assert.NotEqual(t, id, got)
+			}
+		})
+	}
+}
+
+func TestMessageIDForFormat(t *testing.T) {
+	id := MessageIDFor(uuid.New(), uuid.New())
+	assert.Equal(t, uuid.Version(5), id.Version())
+	assert.Equal(t, uuid.RFC4122, id.Variant())
+}
+
+// Id сохраненных сообщений зависит от алгоритма: его смена сломала бы идемпотентность ретраев
+func TestMessageIDForStable(t *testing.T) {
+	room := uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	key := uuid.MustParse("f47ac10b-58cc-4372-a567-0e02b2c3d479")
+	assert.Equal(t, uuid.NewSHA1(room, key[:]), MessageIDFor(room, key))
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PresenceStatus — сетевой статус пользователя
+type PresenceStatus string
+
+const (
+	// PresenceOnline — хотя бы одно соединение пользователя активно
+	PresenceOnline PresenceStatus = "online"
+	// PresenceAway — соединения есть, но клиенты сообщили, что пользователь отошел
+	PresenceAway PresenceStatus = "away"
+	// PresenceOffline — открытых соединений нет ни на одном инстансе
+	PresenceOffline PresenceStatus = "offline"
+)
+
+// Presence — присутствие пользователя, сведенное по всем его соединениям и инстансам.
+// LastSeenAt — когда у пользователя последний раз было открытое соединение, nil — ни разу.
+type Presence struct {
+	UserID     uuid.UUID      `json:"user_id"`
+	Status     PresenceStatus `json:"status"`
+	LastSeenAt *time.Time     `json:"last_seen_at,omitempty"`
+}
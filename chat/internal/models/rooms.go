@@ -1,17 +1,97 @@
 package models
 
 import (
+	"bytes"
 	"time"
-	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/google/uuid"
 )
 
 type Room struct {
 	ID uuid.UUID `json:"id" db:"id"`
-	AdminID uuid.UUID `db:"admin_id"`
-	CreatedAt time.Time `db:"created_at"`
-	UpdatedAt *time.Time `db:"updated_at"`
-	DeletedAt *time.Time `db:"deleted_at"`
+	CreatedBy uuid.UUID `json:"created_by" db:"created_by"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty" db:"updated_at"`
+	DeletedAt *time.Time `json:"-" db:"deleted_at"`
 	Name string `json:"name" db:"name"`
-	Users pgtype.Array[uuid.UUID] `db:"users"` // хранит только индентификаторы пользователей
+	Kind RoomKind `json:"kind" db:"kind"`
+	// MessageTTL — срок жизни сообщений комнаты по умолчанию в секундах, 0 — сообщения не исчезают
+	MessageTTL int64 `json:"message_ttl" db:"message_ttl"`
+}
+
+// RoomKind — вид комнаты: групповая с названием или личная переписка двух пользователей
+type RoomKind string
+
+const (
+	RoomGroup  RoomKind = "group"
+	RoomDirect RoomKind = "direct"
+)
+
+// directRoomNamespace — пространство имен для id личных переписок
+var directRoomNamespace = uuid.MustParse("5b0e6c1e-8f0a-4c36-9d5e-2a7f4c1d9b83")
+
+// DirectRoomID возвращает id личной переписки пары пользователей.
+// Id не зависит от порядка аргументов, поэтому у пары всегда одна комната.
+func DirectRoomID(a, b uuid.UUID) uuid.UUID {
+	if bytes.Compare(a[:], b[:]) > 0 {
+		a, b = b, a
+	}
+	return uuid.NewSHA1(directRoomNamespace, append(a[:], b[:]...))
+}
+
+// UserRoom — комната в списке комнат пользователя с его непрочитанными сообщениями.
+// UnreadCount — чужие неудаленные сообщения с seq больше LastReadSeq,
+// MentionCount — сколько из них упоминают пользователя.
+type UserRoom struct {
+	Room
+	LastReadSeq int64 `json:"last_read_seq" db:"last_read_seq"`
+	UnreadCount int `json:"unread_count" db:"unread_count"`
+	MentionCount int `json:"mention_count" db:"mention_count"`
+}
+
+// DirectRoom — личная переписка в списке комнат пользователя.
+// Name у личной переписки — имя собеседника.
+type DirectRoom struct {
+	UserRoom
+	PeerID uuid.UUID `json:"peer_id" db:"peer_id"`
+}
+
+// RoomList — комнаты пользователя: групповые и личные переписки отдельно
+type RoomList struct {
+	Rooms []UserRoom `json:"rooms"`
+	Direct []DirectRoom `json:"direct"`
+}
+
+// Role — роль участника в комнате
+type Role string
+
+const (
+	RoleOwner     Role = "owner"
+	RoleAdmin     Role = "admin"
+	RoleModerator Role = "moderator"
+	RoleMember    Role = "member"
+)
+
+// Rank возвращает старшинство роли: чем больше, тем больше прав. Для неизвестной роли — 0.
+func (r Role) Rank() int {
+	switch r {
+	case RoleOwner:
+		return 4
+	case RoleAdmin:
+		return 3
+	case RoleModerator:
+		return 2
+	case RoleMember:
+		return 1
+	}
+	return 0
+}
+
+// RoomMember — запись об участии пользователя в комнате (таблица room_users).
+// LastReadSeq — seq последнего прочитанного участником сообщения.
+type RoomMember struct {
+	RoomID uuid.UUID `json:"room_id" db:"room_id"`
+	UserID uuid.UUID `json:"user_id" db:"user_id"`
+	Role Role `json:"role" db:"role"`
+	JoinedAt time.Time `json:"joined_at" db:"joined_at"`
+	LastReadSeq int64 `json:"last_read_seq" db:"last_read_seq"`
 }
\ No newline at end of file
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleRank(t *testing.T) {
+	tests := []struct {
+		role Role
+		want int
+	}{
+		{RoleOwner, 4},
+		{RoleAdmin, 3},
+		{RoleModerator, 2},
+		{RoleMember, 1},
+		{"", 0},
+		{"guest", 0},
+		{"Owner", 0},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.role), func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.role.Rank())
+		})
+	}
+}
+
+func TestDirectRoomID(t *testing.T) {
+	a := uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	b := uuid.MustParse("f47ac10b-58cc-4372-a567-0e02b2c3d479")
+	c := uuid.MustParse("f47ac10b-58cc-4372-a567-0e02b2c3d47a")
+
+	// Комната пары не зависит от того, кто пишет первым
+	assert.Equal(t, DirectRoomID(a, b), DirectRoomID(b, a))
+	assert.NotEqual(t, DirectRoomID(a, b), DirectRoomID(a, c))
+	assert.NotEqual(t, DirectRoomID(a, b), DirectRoomID(b, c))
+	assert.NotEqual(t, DirectRoomID(a, a), DirectRoomID(a, b))
+}
+
+func TestDirectRoomIDIsNotUserID(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+	id := DirectRoomID(a, b)
+	assert.NotEqual(t, a, id)
+	assert.NotEqual(t, b, id)
+	assert.Equal(t, uuid.Version(5), id.Version())
+}
@@ -0,0 +1,233 @@
+// Package protocol описывает формат WebSocket-фреймов между клиентом и chat-сервисом.
+//
+// Каждый фрейм — это конверт {v, type, id, payload}. Поле type определяет,
+// какую структуру содержит payload, id задается клиентом и возвращается в ack/error.
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Version — текущая версия протокола
+const Version = 1
+
+type FrameType string
+
+const (
+	// TypeMessage — сообщение чата. От клиента payload = MessageIn, от сервера — models.Message
+	TypeMessage FrameType = "message"
+	// TypeAck — подтверждение приема сообщения сервером
+	TypeAck FrameType = "ack"
+	// TypeError — ошибка обработки фрейма
+	TypeError FrameType = "error"
+	// TypeSystem — системное событие комнаты
+	TypeSystem FrameType = "system"
+	// TypePing — проверка соединения со стороны клиента, сервер отвечает TypePong
+	TypePing FrameType = "ping"
+	TypePong FrameType = "pong"
+	// TypeMessageEdited — сообщение отредактировано, payload — обновленное models.Message
+	TypeMessageEdited FrameType = "message_edited"
+	// TypeMessageDeleted — сообщение удалено, payload — «надгробие» models.Message без текста
+	TypeMessageDeleted FrameType = "message_deleted"
+	// TypeReaction — реакция на сообщение. От клиента — поставить или снять свою реакцию,
+	// от сервера — реакция изменилась; payload = ReactionPayload
+	TypeReaction FrameType = "reaction"
+	// TypeRead — курсор чтения. От клиента — сообщения до seq прочитаны,
+	// от сервера — уведомление о прочтении участником; payload = ReadPayload
+	TypeRead FrameType = "read"
+	// TypeTyping — пользователь набирает текст. Эфемерное событие: не сохраняется и не досылается.
+	// От клиента payload не нужен, от сервера — TypingPayload
+	TypeTyping FrameType = "typing"
+	// TypePresence — присутствие пользователя. От клиента — статус соединения (PresenceIn),
+	// от сервера — изменившийся общий статус участника комнаты, payload = models.Presence
+	TypePresence FrameType = "presence"
+	// TypeMention — пользователя упомянули в сообщении. Приходит во все его соединения,
+	// в какой бы комнате они ни были открыты; payload = MentionPayload
+	TypeMention FrameType = "mention"
+	// TypePin — сообщение закреплено или откреплено, приходит только от сервера; payload = PinPayload
+	TypePin FrameType = "pin"
+)
+
+// Коды ошибок в ErrorPayload
+const (
+	ErrCodeBadFrame     = "bad_frame"
+	ErrCodeUnsupported  = "unsupported_version"
+	ErrCodeUnknownType  = "unknown_type"
+	ErrCodeEmptyMessage = "empty_message"
+	ErrCodeInternal     = "internal_error"
+	ErrCodeForbidden    = "forbidden"
+	// ErrCodeInvalidParent — ответ на несуществующее, удаленное или не корневое сообщение
+	ErrCodeInvalidParent = "invalid_parent"
+	// ErrCodeNotFound — сообщение, на которое ссылается фрейм, не найдено
+	ErrCodeNotFound = "not_found"
+	// ErrCodeInvalidAttachment — вложение не найдено, чужое или уже приложено к другому сообщению
+	ErrCodeInvalidAttachment = "invalid_attachment"
+	// ErrCodeInvalidTTL — срок жизни сообщения отрицательный или больше допустимого
+	ErrCodeInvalidTTL = "invalid_ttl"
+)
+
+// Действия с реакцией в ReactionPayload
+const (
+	ReactionAdd    = "add"
+	ReactionRemove = "remove"
+)
+
+// Действия с закреплением в PinPayload
+const (
+	PinAdd    = "pin"
+	PinRemove = "unpin"
+)
+
+// Системные события
+const (
+	EventConnected = "connected"
+	// EventReplayDone — досылка пропущенных сообщений завершена, дальше идут живые
+	EventReplayDone = "replay_done"
+	// EventReplayTruncated — пропущено слишком много, историю нужно загрузить через /{id}/messages
+	EventReplayTruncated = "replay_truncated"
+	EventMemberAdded     = "member_added"
+	EventMemberRemoved   = "member_removed"
+	EventRoleChanged     = "role_changed"
+	EventOwnerChanged    = "owner_changed"
+	EventRoomRenamed     = "room_renamed"
+	EventRoomDeleted     = "room_deleted"
+	// EventMessageTTLChanged — изменился срок жизни сообщений комнаты по умолчанию
+	EventMessageTTLChanged = "message_ttl_changed"
+)
+
+var ErrUnsupportedVersion = errors.New("неподдерживаемая версия протокола")
+
+// Frame — конверт любого WebSocket-фрейма
+type Frame struct {
+	Version int             `json:"v"`
+	Type    FrameType       `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// MessageIn — payload сообщения, отправленного клиентом.
+// ClientMsgID — UUID, который клиент генерирует один раз на сообщение и повторяет при ретраях:
+// повторная отправка с тем же ключом подтверждается, но не сохраняется и не рассылается заново.
+// ParentID — id корневого сообщения, если это ответ в треде.
+// AttachmentIDs — id вложений, заранее загруженных через POST /{id}/attachments.
+// TTL — срок жизни сообщения в секундах; без него действует срок комнаты по умолчанию.
+type MessageIn struct {
+	Text          string   `json:"text"`
+	ClientMsgID   string   `json:"client_msg_id,omitempty"`
+	ParentID      string   `json:"parent_id,omitempty"`
+	AttachmentIDs []string `json:"attachment_ids,omitempty"`
+	TTL           int64    `json:"ttl,omitempty"`
+}
+
+// AckPayload связывает временный id клиента с id, назначенным сервером
+type AckPayload struct {
+	TempID    string    `json:"temp_id"`
+	MessageID uuid.UUID `json:"message_id"`
+}
+
+// ReactionPayload описывает реакцию на сообщение. Клиент заполняет MessageID, Emoji и Action;
+// сервер при рассылке добавляет автора реакции и новое число реакций этим эмодзи.
+type ReactionPayload struct {
+	MessageID uuid.UUID `json:"message_id"`
+	Emoji     string    `json:"emoji"`
+	Action    string    `json:"action"`
+	UserID    uuid.UUID `json:"user_id,omitempty"`
+	Count     int       `json:"count"`
+}
+
+// ReadPayload описывает курсор чтения участника. Клиент передает только Seq,
+// сервер при рассылке добавляет участника и итоговый курсор.
+type ReadPayload struct {
+	UserID uuid.UUID `json:"user_id,omitempty"`
+	Seq    int64     `json:"seq"`
+}
+
+// TypingPayload — кто набирает текст. Клиент показывает индикатор ExpiresIn миллисекунд,
+// если за это время не придет новое событие или сообщение от этого пользователя.
+type TypingPayload struct {
+	UserID    uuid.UUID `json:"user_id"`
+	ExpiresIn int64     `json:"expires_in"`
+}
+
+// PresenceIn — статус соединения от клиента: "online" или "away"
+type PresenceIn struct {
+	Status string `json:"status"`
+}
+
+// MentionPayload — упоминание пользователя: где и кем, с текстом сообщения
+type MentionPayload struct {
+	RoomID    uuid.UUID `json:"room_id"`
+	MessageID uuid.UUID `json:"message_id"`
+	Seq       int64     `json:"seq"`
+	SenderID  uuid.UUID `json:"sender_id"`
+	Text      string    `json:"text"`
+}
+
+// PinPayload — изменение закрепления сообщения: кто и когда его закрепил или открепил
+type PinPayload struct {
+	MessageID uuid.UUID `json:"message_id"`
+	Action    string    `json:"action"`
+	UserID    uuid.UUID `json:"user_id"`
+	At        time.Time `json:"at"`
+}
+
+// ErrorPayload описывает ошибку обработки фрейма
+type ErrorPayload struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// SystemPayload описывает системное событие комнаты
+type SystemPayload struct {
+	Event  string    `json:"event"`
+	RoomID uuid.UUID `json:"room_id"`
+	UserID uuid.UUID `json:"user_id,omitempty"`
+	// ActorID — пользователь, выполнивший действие (например, добавивший участника)
+	ActorID uuid.UUID `json:"actor_id,omitempty"`
+	// Role — новая роль участника для role_changed
+	Role string `json:"role,omitempty"`
+	// Name — новое название комнаты для room_renamed
+	Name string `json:"name,omitempty"`
+	// MessageTTL — новый срок жизни сообщений в секундах для message_ttl_changed, 0 — без срока
+	MessageTTL int64 `json:"message_ttl,omitempty"`
+}
+
+// NewFrame собирает фрейм текущей версии с сериализованным payload
+func NewFrame(t FrameType, id string, payload any) (Frame, error) {
+	f := Frame{Version: Version, Type: t, ID: id}
+	if payload == nil {
+		return f, nil
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return Frame{}, err
+	}
+	f.Payload = raw
+	return f, nil
+}
+
+// NewError собирает фрейм ошибки, отвечающий на фрейм с указанным id
+func NewError(id, code, message string) Frame {
+	f, _ := NewFrame(TypeError, id, ErrorPayload{Code: code, Message: message})
+	return f
+}
+
+// Check проверяет версию фрейма. Фреймы без версии считаются фреймами текущей версии.
+func (f *Frame) Check() error {
+	if f.Version != 0 && f.Version != Version {
+		return ErrUnsupportedVersion
+	}
+	return nil
+}
+
+// Decode десериализует payload фрейма в obj
+func (f *Frame) Decode(obj any) error {
+	if len(f.Payload) == 0 {
+		return errors.New("пустой payload")
+	}
+	return json.Unmarshal(f.Payload, obj)
+}
@@ -0,0 +1,97 @@
+package protocol
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// roundTrip собирает фрейм, передает его через JSON и декодирует payload обратно в out
+func roundTrip(t *testing.T, typ FrameType, id string, in, out any) Frame {
+	t.Helper()
+	f, err := NewFrame(typ, id, in)
+	require.NoError(t, err)
+
+	raw, err := json.Marshal(f)
+	require.NoError(t, err)
+
+	var got Frame
+	require.NoError(t, json.Unmarshal(raw, &got))
+	require.NoError(t, got.Check())
+	require.NoError(t, got.Decode(out))
+	return got
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	userID := uuid.New()
+
+	tests := []struct {
+		name string
+		typ  FrameType
+		in   any
+		out  func() any
+	}{
+		{"message", TypeMessage, &MessageIn{Text: "привет"}, func() any { return &MessageIn{} }},
+		{"ack", TypeAck, &AckPayload{TempID: "tmp-1", MessageID: uuid.New()}, func() any { return &AckPayload{} }},
+		{"error", TypeError, &ErrorPayload{Code: ErrCodeBadFrame, Message: "плохой фрейм"}, func() any { return &ErrorPayload{} }},
+		{"system", TypeSystem, &SystemPayload{Event: EventConnected, RoomID: uuid.New(), UserID: userID}, func() any { return &SystemPayload{} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := tt.out()
+			got := roundTrip(t, tt.typ, "frame-1", tt.in, out)
+			assert.Equal(t, Version, got.Version)
+			assert.Equal(t, tt.typ, got.Type)
+			assert.Equal(t, "frame-1", got.ID)
+			assert.Equal(t, tt.in, out)
+		})
+	}
+}
+
+func TestFrameWithoutPayload(t *testing.T) {
+	f, err := NewFrame(TypePing, "", nil)
+	require.NoError(t, err)
+
+	raw, err := json.Marshal(f)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"v":1,"type":"ping"}`, string(raw))
+
+	var got Frame
+	require.NoError(t, json.Unmarshal(raw, &got))
+	assert.Error(t, got.Decode(&MessageIn{}))
+}
+
+func TestFrameCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		version int
+		wantErr error
+	}{
+		{"текущая версия", Version, nil},
+		{"без версии", 0, nil},
+		{"будущая версия", Version + 1, ErrUnsupportedVersion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := Frame{Version: tt.version, Type: TypeMessage}
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, f.Check(), tt.wantErr)
+			} else {
+				assert.NoError(t, f.Check())
+			}
+		})
+	}
+}
+
+func TestNewError(t *testing.T) {
+	f := NewError("frame-1", ErrCodeInternal, "сбой")
+
+	var payload ErrorPayload
+	require.NoError(t, f.Decode(&payload))
+	assert.Equal(t, TypeError, f.Type)
+	assert.Equal(t, "frame-1", f.ID)
+	assert.Equal(t, ErrorPayload{Code: ErrCodeInternal, Message: "сбой"}, payload)
+}
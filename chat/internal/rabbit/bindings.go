@@ -0,0 +1,101 @@
+package rabbit
+
+import (
+	"github.com/andro-kes/Chat/chat/logger"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// binding — привязка или отвязка очереди инстанса от ключа exchange
+type binding struct {
+	exchange string
+	key      string
+	bind     bool
+}
+
+// RoomActivated привязывает очередь инстанса к комнате, ставшей активной
+func (rm *rabbitManager) RoomActivated(roomID uuid.UUID) {
+	rm.enqueueBinding(binding{exchange: roomsExchange, key: roomID.String(), bind: true})
+}
+
+// RoomDeactivated отвязывает очередь инстанса от комнаты, в которой не осталось подключений
+func (rm *rabbitManager) RoomDeactivated(roomID uuid.UUID) {
+	rm.enqueueBinding(binding{exchange: roomsExchange, key: roomID.String()})
+}
+
+// UserConnected привязывает очередь инстанса к событиям пользователя, открывшего первое соединение
+func (rm *rabbitManager) UserConnected(userID uuid.UUID) {
+	rm.enqueueBinding(binding{exchange: usersExchange, key: userID.String(), bind: true})
+}
+
+// UserDisconnected отвязывает очередь инстанса от пользователя, закрывшего последнее соединение
+func (rm *rabbitManager) UserDisconnected(userID uuid.UUID) {
+	rm.enqueueBinding(binding{exchange: usersExchange, key: userID.String()})
+}
+
+// enqueueBinding ставит привязку в очередь и сразу возвращается. Наблюдатель вызывается
+// под блокировкой сервиса чата, поэтому ждать ответа брокера здесь нельзя.
+// Привязки выполняются по одной в порядке поступления, так что отвязка не обгонит привязку.
+func (rm *rabbitManager) enqueueBinding(b binding) {
+	rm.bindMu.Lock()
+	rm.bindQueue = append(rm.bindQueue, b)
+	rm.bindMu.Unlock()
+
+	select {
+	case rm.bindSignal <- struct{}{}:
+	default:
+	}
+}
+
+// bindLoop выполняет накопленные привязки на отдельном канале bindCh
+func (rm *rabbitManager) bindLoop() {
+	for {
+		select {
+		case <-rm.bindSignal:
+		case <-rm.done:
+			return
+		}
+
+		rm.bindMu.Lock()
+		queue := rm.bindQueue
+		rm.bindQueue = nil
+		rm.bindMu.Unlock()
+
+		for _, b := range queue {
+			rm.applyBinding(b)
+		}
+	}
+}
+
+// applyBinding выполняет привязку. Ошибка закрывает канал привязок: тогда он
+// пересоздается и привязка повторяется один раз. Консьюмеры при этом не затрагиваются.
+func (rm *rabbitManager) applyBinding(b binding) {
+	err := rm.execBinding(b)
+	if err != nil && rm.bindCh.IsClosed() && !rm.conn.IsClosed() {
+		ch, chErr := rm.conn.Channel()
+		if chErr != nil {
+			logger.Log.Error("Не удалось пересоздать канал привязок", zap.Error(chErr))
+			return
+		}
+		rm.bindMu.Lock()
+		rm.bindCh = ch
+		rm.bindMu.Unlock()
+		err = rm.execBinding(b)
+	}
+	if err != nil {
+		logger.Log.Error(
+			"Не удалось изменить привязку очереди инстанса",
+			zap.String("exchange", b.exchange),
+			zap.String("key", b.key),
+			zap.Bool("bind", b.bind),
+			zap.Error(err),
+		)
+	}
+}
+
+func (rm *rabbitManager) execBinding(b binding) error {
+	if b.bind {
+		return rm.bindCh.QueueBind(rm.roomQ.Name, b.key, b.exchange, false, nil)
+	}
+	return rm.bindCh.QueueUnbind(rm.roomQ.Name, b.key, b.exchange, nil)
+}
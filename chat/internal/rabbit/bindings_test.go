@@ -0,0 +1,126 @@
+package rabbit
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startBindLoop открывает канал привязок и запускает горутину привязок
+func startBindLoop(t *testing.T, rm *rabbitManager) *fakeChannel {
+	t.Helper()
+	ch, err := rm.conn.Channel()
+	require.NoError(t, err)
+	rm.bindCh = ch
+	go rm.bindLoop()
+	return ch.(*fakeChannel)
+}
+
+func TestBindingsAppliedInOrder(t *testing.T) {
+	rm := newTestManager(t, &fakeConn{})
+	bindCh := startBindLoop(t, rm)
+	a, b := uuid.New(), uuid.New()
+
+	rm.RoomActivated(a)
+	rm.RoomDeactivated(a)
+	rm.RoomActivated(b)
+	rm.RoomActivated(a)
+
+	want := []binding{
+		{exchange: roomsExchange, key: a.String(), bind: true},
+		{exchange: roomsExchange, key: a.String()},
+		{exchange: roomsExchange, key: b.String(), bind: true},
+		{exchange: roomsExchange, key: a.String(), bind: true},
+	}
+	require.Eventually(t, func() bool {
+		return len(bindCh.appliedBindings()) == len(want)
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, want, bindCh.appliedBindings())
+}
+
+func TestUserBindings(t *testing.T) {
+	rm := newTestManager(t, &fakeConn{})
+	bindCh := startBindLoop(t, rm)
+	userID := uuid.New()
+
+	rm.UserConnected(userID)
+	rm.UserDisconnected(userID)
+
+	want := []binding{
+		{exchange: usersExchange, key: userID.String(), bind: true},
+		{exchange: usersExchange, key: userID.String()},
+	}
+	require.Eventually(t, func() bool {
+		return len(bindCh.appliedBindings()) == len(want)
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, want, bindCh.appliedBindings())
+}
+
+// Наблюдатель вызывается под блокировкой сервиса чата: постановка привязки
+// не должна ждать брокер, даже если горутина привязок занята или не запущена
+func TestEnqueueBindingDoesNotBlock(t *testing.T) {
+	rm := newTestManager(t, &fakeConn{})
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			rm.RoomActivated(uuid.New())
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("RoomActivated заблокировался без горутины привязок")
+	}
+	rm.bindMu.Lock()
+	defer rm.bindMu.Unlock()
+	assert.Len(t, rm.bindQueue, 100)
+}
+
+func TestBindingRetriedOnNewChannel(t *testing.T) {
+	conn := &fakeConn{}
+	rm := newTestManager(t, conn)
+	broken := startBindLoop(t, rm)
+	broken.bindErr = errors.New("NOT_FOUND - no exchange")
+	roomID := uuid.New()
+
+	rm.RoomActivated(roomID)
+
+	require.Eventually(t, func() bool {
+		channels := conn.opened()
+		return len(channels) == 2 && len(channels[1].appliedBindings()) == 1
+	}, time.Second, time.Millisecond)
+	retried := conn.opened()[1]
+	assert.Equal(t, []binding{{exchange: roomsExchange, key: roomID.String(), bind: true}}, retried.appliedBindings())
+	assert.Empty(t, broken.appliedBindings())
+
+	// Следующие привязки идут уже по новому каналу
+	rm.RoomDeactivated(roomID)
+	require.Eventually(t, func() bool {
+		return len(retried.appliedBindings()) == 2
+	}, time.Second, time.Millisecond)
+	rm.bindMu.Lock()
+	defer rm.bindMu.Unlock()
+	assert.Same(t, retried, rm.bindCh)
+}
+
+func TestBindingNotRetriedWhenConnectionClosed(t *testing.T) {
+	conn := &fakeConn{}
+	rm := newTestManager(t, conn)
+	broken := startBindLoop(t, rm)
+	broken.bindErr = errors.New("CONNECTION_FORCED")
+	require.NoError(t, conn.Close())
+
+	rm.RoomActivated(uuid.New())
+
+	require.Eventually(t, broken.IsClosed, time.Second, time.Millisecond)
+	assert.Never(t, func() bool {
+		return len(conn.opened()) > 1
+	}, 50*time.Millisecond, time.Millisecond)
+}
@@ -3,34 +3,70 @@ package rabbit
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/andro-kes/Chat/chat/internal/protocol"
 	"github.com/andro-kes/Chat/chat/internal/services"
 	"github.com/andro-kes/Chat/chat/logger"
+	"github.com/google/uuid"
 	amqp "github.com/rabbitmq/amqp091-go"
 	"go.uber.org/zap"
 )
 
+const (
+	// persistQueue — durable-очередь, из которой сообщения сохраняются в БД ровно один раз
+	persistQueue = "chat"
+	// roomsExchange — topic-exchange для рассылки сохраненных сообщений по инстансам.
+	// Ключ маршрутизации — id комнаты.
+	roomsExchange = "chat.rooms"
+	// usersExchange — direct-exchange для адресных событий пользователя (например, упоминаний).
+	// Ключ маршрутизации — id пользователя; очередь инстанса привязана к пользователям, подключенным к нему.
+	usersExchange = "chat.users"
+)
+
 type RabbitManager interface {
 	PublishMessage(msg models.Message) error
+	PublishEvent(roomID uuid.UUID, frame protocol.Frame) error
+	PublishEphemeral(roomID uuid.UUID, frame protocol.Frame, ttl time.Duration) error
+	PublishToUser(userID uuid.UUID, frame protocol.Frame) error
 	ConsumeMessages()
 	Stop()
 }
 
 type rabbitManager struct {
-	conn        *amqp.Connection
-	ch          *amqp.Channel
+	conn        amqpConnection
+	// mu защищает ch: если брокер закрыл канал, консьюмеры переподнимаются на новом
+	mu          sync.RWMutex
+	ch          amqpChannel
 	q           amqp.Queue
+	// roomQ — эксклюзивная очередь инстанса, привязанная только к его активным комнатам
+	// и подключенным пользователям
+	roomQ       amqp.Queue
 	ChatService services.ChatService
-	// можно добавить флаг завершения или context для остановки потребителя
+	prefetch    int
+
+	// Привязки roomQ выполняет отдельная горутина на своем канале bindCh, см. bindings.go.
+	// bindMu защищает очередь привязок и замену bindCh
+	bindCh      amqpChannel
+	bindMu      sync.Mutex
+	bindQueue   []binding
+	bindSignal  chan struct{}
+
+	done        chan struct{}
+	stopOnce    sync.Once
 }
 
 func Init(chatSvc services.ChatService) (*rabbitManager, error) {
-	var rm rabbitManager
+	rm := rabbitManager{
+		bindSignal: make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
 	var err error
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -45,9 +81,10 @@ func Init(chatSvc services.ChatService) (*rabbitManager, error) {
 	connURL := fmt.Sprintf("amqp://%s:%s@%s/", name, password, addr)
 
 	// simple retry/backoff
+	var conn *amqp.Connection
 	backoff := time.Second
 	for attempts := 0; attempts < 5; attempts++ {
-		rm.conn, err = amqp.Dial(connURL)
+		conn, err = amqp.Dial(connURL)
 		if err == nil {
 			break
 		}
@@ -63,29 +100,26 @@ func Init(chatSvc services.ChatService) (*rabbitManager, error) {
 		logger.Log.Error("Не удалось установить соединение с очередью", zap.Error(err))
 		return nil, err
 	}
-
-	rm.ch, err = rm.conn.Channel()
-	if err != nil {
-		logger.Log.Error("Не удалось создать канал для очереди", zap.Error(err))
-		return nil, err
-	}
+	rm.conn = connection{conn}
 
 	// QoS / prefetch — сделаем 1 (по одному сообщению на консьюмер)
 	// Можно взять из ENV: RABBITMQ_PREFETCH
-	prefetch := 1
+	rm.prefetch = 1
 	if v := os.Getenv("RABBITMQ_PREFETCH"); v != "" {
 		if p, err := strconv.Atoi(v); err == nil && p > 0 {
-			prefetch = p
+			rm.prefetch = p
 		}
 	}
-	if err := rm.ch.Qos(prefetch, 0, false); err != nil {
-		logger.Log.Warn("Не удалось установить QoS для канала RabbitMQ", zap.Error(err))
-		// не фаталим — но логируем
+
+	rm.ch, err = rm.openChannel()
+	if err != nil {
+		logger.Log.Error("Не удалось создать канал для очереди", zap.Error(err))
+		return nil, err
 	}
 
 	// durable queue
 	rm.q, err = rm.ch.QueueDeclare(
-		"chat",
+		persistQueue,
 		true,  // durable
 		false,
 		false,
@@ -97,14 +131,139 @@ func Init(chatSvc services.ChatService) (*rabbitManager, error) {
 		return nil, err
 	}
 
+	err = rm.ch.ExchangeDeclare(
+		roomsExchange,
+		amqp.ExchangeTopic,
+		true,  // durable
+		false, // autoDelete
+		false, // internal
+		false, // noWait
+		nil,
+	)
+	if err != nil {
+		logger.Log.Error("Не удалось создать exchange комнат", zap.Error(err))
+		return nil, err
+	}
+
+	err = rm.ch.ExchangeDeclare(
+		usersExchange,
+		amqp.ExchangeDirect,
+		true,  // durable
+		false, // autoDelete
+		false, // internal
+		false, // noWait
+		nil,
+	)
+	if err != nil {
+		logger.Log.Error("Не удалось создать exchange пользователей", zap.Error(err))
+		return nil, err
+	}
+
+	// Очередь инстанса: имя выдает сервер, удаляется вместе с соединением
+	rm.roomQ, err = rm.ch.QueueDeclare(
+		"",
+		false, // durable
+		true,  // autoDelete
+		true,  // exclusive
+		false,
+		nil,
+	)
+	if err != nil {
+		logger.Log.Error("Не удалось создать очередь инстанса", zap.Error(err))
+		return nil, err
+	}
+
+	rm.bindCh, err = rm.conn.Channel()
+	if err != nil {
+		logger.Log.Error("Не удалось создать канал для привязок", zap.Error(err))
+		return nil, err
+	}
+	go rm.bindLoop()
+
 	rm.ChatService = chatSvc
+	// Привязываем очередь инстанса к уже активным и будущим комнатам и пользователям
+	chatSvc.SetObserver(&rm)
 
-	// старт consumer в отдельной горутине
-	go rm.ConsumeMessages()
+	// старт consumer'ов в отдельных горутинах
+	rm.startConsumers(rm.ch)
 
 	return &rm, nil
 }
 
+// openChannel открывает канал для консьюмеров и публикации с настроенным prefetch
+func (rm *rabbitManager) openChannel() (amqpChannel, error) {
+	ch, err := rm.conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	if err := ch.Qos(rm.prefetch, 0, false); err != nil {
+		logger.Log.Warn("Не удалось установить QoS для канала RabbitMQ", zap.Error(err))
+		// не фаталим — но логируем
+	}
+	return ch, nil
+}
+
+// channel возвращает текущий канал консьюмеров и публикации
+func (rm *rabbitManager) channel() amqpChannel {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+	return rm.ch
+}
+
+// startConsumers запускает консьюмеров на канале ch и следит за его закрытием
+func (rm *rabbitManager) startConsumers(ch amqpChannel) {
+	closed := ch.NotifyClose(make(chan *amqp.Error, 1))
+	go rm.ConsumeMessages()
+	go rm.consumeRoomMessages()
+	go rm.watchChannel(closed)
+}
+
+// watchChannel переподнимает консьюмеров, если брокер закрыл их канал.
+// Очередь инстанса и её привязки принадлежат соединению и переживают закрытие канала,
+// неподтвержденные сообщения брокер вернет в очередь chat.
+func (rm *rabbitManager) watchChannel(closed chan *amqp.Error) {
+	select {
+	case err := <-closed:
+		logger.Log.Warn("Канал RabbitMQ закрыт", zap.Any("reason", err))
+	case <-rm.done:
+		return
+	}
+
+	backoff := time.Second
+	for {
+		select {
+		case <-rm.done:
+			return
+		default:
+		}
+		if rm.conn.IsClosed() {
+			// Вместе с соединением удалена и очередь инстанса: нужен перезапуск сервиса
+			logger.Log.Error("Соединение с RabbitMQ закрыто, доставка сообщений остановлена")
+			return
+		}
+
+		ch, err := rm.openChannel()
+		if err == nil {
+			rm.mu.Lock()
+			rm.ch = ch
+			rm.mu.Unlock()
+			logger.Log.Info("Канал RabbitMQ восстановлен")
+			rm.startConsumers(ch)
+			return
+		}
+		logger.Log.Warn("Не удалось пересоздать канал RabbitMQ", zap.Error(err))
+
+		select {
+		case <-rm.done:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
 // PublishMessage публикует сообщение в очередь RabbitMQ.
 func (rm *rabbitManager) PublishMessage(msg models.Message) error {
 	body, err := json.Marshal(msg)
@@ -113,7 +272,7 @@ func (rm *rabbitManager) PublishMessage(msg models.Message) error {
 		return err
 	}
 
-	err = rm.ch.PublishWithContext(
+	err = rm.channel().PublishWithContext(
 		context.Background(),
 		"",        // default exchange
 		rm.q.Name, // routing key
@@ -123,6 +282,7 @@ func (rm *rabbitManager) PublishMessage(msg models.Message) error {
 			ContentType:  "application/json",
 			Body:         body,
 			DeliveryMode: amqp.Persistent,
+			MessageId:    msg.ClientMsgID.String(),
 			Timestamp:    time.Now(),
 		},
 	)
@@ -133,10 +293,11 @@ func (rm *rabbitManager) PublishMessage(msg models.Message) error {
 	return nil
 }
 
-// ConsumeMessages читает сообщения из очереди и рассылает их через WebSocket.
+// ConsumeMessages читает сообщения из durable-очереди, сохраняет их в БД
+// и публикует в exchange комнат для рассылки всеми инстансами.
 // Используется manual ack: autoAck=false в Consume, после успешной обработки вызывается delivery.Ack(false).
 func (rm *rabbitManager) ConsumeMessages() {
-	msgs, err := rm.ch.Consume(
+	msgs, err := rm.channel().Consume(
 		rm.q.Name, // queue
 		"",        // consumer
 		false,     // autoAck == false -> подтверждать вручную
@@ -162,26 +323,43 @@ func (rm *rabbitManager) ConsumeMessages() {
 			continue
 		}
 
-		room, err := rm.ChatService.GetRoom(msg.RoomID)
-		if err != nil {
-			logger.Log.Error("Неверное id комнаты", zap.Error(err))
-			// если комната не найдена — отдаем Nack с requeue=false (чтобы не зацикливать), либо requeue=true если хотим повторить позже
-			if nackErr := d.Nack(false, false); nackErr != nil {
-				logger.Log.Warn("Не удалось Nack сообщение (room not found)", zap.Error(nackErr))
+		// Повторная доставка (ретрай клиента или redelivery) уже сохранена и разослана — только подтверждаем
+		err := rm.ChatService.SaveMessage(&msg)
+		if errors.Is(err, services.ErrDuplicateMessage) {
+			logger.Log.Info("Пропущен дубликат сообщения", zap.String("client_msg_id", msg.ClientMsgID.String()))
+			if ackErr := d.Ack(false); ackErr != nil {
+				logger.Log.Warn("Не удалось Ack сообщение", zap.Error(ackErr))
 			}
 			continue
 		}
 
-		// Попытка доставки — SendMessage может возвращать ошибку (например, DB down или проблемa с websocket)
-		if err := room.SendMessage(&msg); err != nil {
-			logger.Log.Warn("Ошибка при отправке сообщения в комнату", zap.Any("message", msg), zap.Error(err))
+		// Сохранение может упасть, например, если БД недоступна — тогда повторяем позже
+		if err != nil {
+			logger.Log.Warn("Не удалось сохранить сообщение", zap.Any("message", msg), zap.Error(err))
 			if nackErr := d.Nack(false, true); nackErr != nil {
 				logger.Log.Warn("Не удалось Nack (requeue) сообщение", zap.Error(nackErr))
 			}
 			continue
 		}
 
-		// Успешно обработано — подтверждаем delivery
+		frame, err := protocol.NewFrame(protocol.TypeMessage, msg.ID.String(), msg)
+		if err != nil {
+			logger.Log.Error("Не удалось собрать фрейм сообщения", zap.Error(err))
+			if nackErr := d.Nack(false, false); nackErr != nil {
+				logger.Log.Warn("Не удалось Nack сообщение", zap.Error(nackErr))
+			}
+			continue
+		}
+
+		// Сообщение уже сохранено: вернуть delivery в очередь нельзя, повторная доставка
+		// окажется дубликатом и до клиентов не дойдет. Поэтому повторяем только рассылку.
+		if err := rm.publishSaved(msg.RoomID, frame); err != nil {
+			logger.Log.Error("Не удалось разослать сохраненное сообщение", zap.String("id", msg.ID.String()), zap.Error(err))
+		}
+
+		rm.publishMentions(&msg)
+
+		// Сообщение сохранено — подтверждаем delivery
 		if ackErr := d.Ack(false); ackErr != nil {
 			logger.Log.Warn("Не удалось Ack сообщение", zap.Error(ackErr))
 		} else {
@@ -191,10 +369,189 @@ func (rm *rabbitManager) ConsumeMessages() {
 	logger.Log.Info("RabbitMQ consumer loop exited")
 }
 
-// Stop корректно закрывает канал и соединение
+// Сколько раз пытаться разослать сохраненное сообщение и пауза между попытками
+const publishAttempts = 3
+
+var publishRetryDelay = 500 * time.Millisecond
+
+// publishSaved рассылает сохраненное сообщение, повторяя публикацию при ошибке.
+// Если брокер так и не принял фрейм, клиенты получат сообщение из истории или при досылке.
+func (rm *rabbitManager) publishSaved(roomID uuid.UUID, frame protocol.Frame) error {
+	for attempt := 1; ; attempt++ {
+		err := rm.PublishEvent(roomID, frame)
+		if err == nil || attempt == publishAttempts {
+			return err
+		}
+		select {
+		case <-rm.done:
+			return err
+		case <-time.After(publishRetryDelay):
+		}
+	}
+}
+
+// PublishEvent публикует фрейм в exchange комнат с ключом id комнаты.
+// Фрейм получат клиенты комнаты на всех инстансах; в БД он не сохраняется.
+func (rm *rabbitManager) PublishEvent(roomID uuid.UUID, frame protocol.Frame) error {
+	return rm.publishRoomFrame(roomID, frame, 0)
+}
+
+// PublishEphemeral публикует в exchange комнат кратковременное событие (например, набор текста).
+// Через ttl брокер отбрасывает недоставленный фрейм: устаревшее событие клиентам не нужно.
+func (rm *rabbitManager) PublishEphemeral(roomID uuid.UUID, frame protocol.Frame, ttl time.Duration) error {
+	return rm.publishRoomFrame(roomID, frame, ttl)
+}
+
+// PublishToUser публикует фрейм в exchange пользователей: его получат все соединения
+// пользователя на всех инстансах, в какой бы комнате они ни были открыты
+func (rm *rabbitManager) PublishToUser(userID uuid.UUID, frame protocol.Frame) error {
+	return rm.publishFrame(usersExchange, userID.String(), frame, 0)
+}
+
+// publishMentions уведомляет упомянутых в сообщении пользователей.
+// Упоминания уже сохранены, поэтому ошибка публикации только логируется.
+func (rm *rabbitManager) publishMentions(msg *models.Message) {
+	if len(msg.Mentions) == 0 {
+		return
+	}
+	frame, err := protocol.NewFrame(protocol.TypeMention, msg.ID.String(), protocol.MentionPayload{
+		RoomID:    msg.RoomID,
+		MessageID: msg.ID,
+		Seq:       msg.Seq,
+		SenderID:  msg.SenderID,
+		Text:      msg.Content,
+	})
+	if err != nil {
+		logger.Log.Error("Не удалось собрать фрейм упоминания", zap.Error(err))
+		return
+	}
+	for _, userID := range msg.Mentions {
+		if err := rm.PublishToUser(userID, frame); err != nil {
+			logger.Log.Warn("Не удалось опубликовать упоминание", zap.String("user_id", userID.String()), zap.Error(err))
+		}
+	}
+}
+
+func (rm *rabbitManager) publishRoomFrame(roomID uuid.UUID, frame protocol.Frame, ttl time.Duration) error {
+	return rm.publishFrame(roomsExchange, roomID.String(), frame, ttl)
+}
+
+func (rm *rabbitManager) publishFrame(exchange, key string, frame protocol.Frame, ttl time.Duration) error {
+	body, err := json.Marshal(frame)
+	if err != nil {
+		logger.Log.Error("Не удалось сериализовать фрейм", zap.Error(err))
+		return err
+	}
+
+	publishing := amqp.Publishing{
+		ContentType: "application/json",
+		Body:        body,
+		Timestamp:   time.Now(),
+	}
+	if ttl > 0 {
+		publishing.Expiration = strconv.FormatInt(ttl.Milliseconds(), 10)
+	}
+
+	err = rm.channel().PublishWithContext(
+		context.Background(),
+		exchange,
+		key, // routing key
+		false,
+		false,
+		publishing,
+	)
+	if err != nil {
+		logger.Log.Error("Не удалось опубликовать фрейм", zap.String("exchange", exchange), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// consumeRoomMessages читает фреймы из очереди инстанса и рассылает их
+// через WebSocket клиентам комнат, подключенным к этому инстансу, а адресные
+// события пользователей — во все соединения пользователя.
+// Очередь временная, поэтому используется autoAck.
+func (rm *rabbitManager) consumeRoomMessages() {
+	msgs, err := rm.channel().Consume(
+		rm.roomQ.Name, // queue
+		"",            // consumer
+		true,          // autoAck
+		true,          // exclusive
+		false,         // noLocal
+		false,         // noWait
+		nil,           // args
+	)
+	if err != nil {
+		logger.Log.Error("Не удалось подписаться на очередь инстанса", zap.Error(err))
+		return
+	}
+
+	logger.Log.Info("RabbitMQ room consumer started", zap.String("queue", rm.roomQ.Name))
+
+	for d := range msgs {
+		// Ключ маршрутизации — id пользователя для адресных событий и id комнаты для остальных
+		id, err := uuid.Parse(d.RoutingKey)
+		if err != nil {
+			logger.Log.Error("Неверный ключ маршрутизации", zap.String("routing_key", d.RoutingKey), zap.Error(err))
+			continue
+		}
+
+		var frame protocol.Frame
+		if err := json.Unmarshal(d.Body, &frame); err != nil {
+			logger.Log.Error("Не удалось десериализовать фрейм", zap.Error(err))
+			continue
+		}
+
+		if d.Exchange == usersExchange {
+			rm.ChatService.SendToUser(id, frame)
+			continue
+		}
+
+		room, err := rm.ChatService.GetRoom(id)
+		if err != nil {
+			// Комната могла деактивироваться до отвязки очереди — на этом инстансе доставлять некому
+			logger.Log.Debug("Комната не активна на инстансе", zap.String("room_id", id.String()))
+			continue
+		}
+
+		room.Broadcast(frame)
+		rm.applyRoomEvent(room, &frame)
+	}
+	logger.Log.Info("RabbitMQ room consumer loop exited")
+}
+
+// applyRoomEvent выполняет локальные действия, которых требует системное событие.
+// Например, соединения исключенного участника закрываются на каждом инстансе.
+func (rm *rabbitManager) applyRoomEvent(room services.RoomService, frame *protocol.Frame) {
+	if frame.Type != protocol.TypeSystem {
+		return
+	}
+	var event protocol.SystemPayload
+	if err := frame.Decode(&event); err != nil {
+		logger.Log.Warn("Не удалось разобрать системное событие", zap.Error(err))
+		return
+	}
+	switch event.Event {
+	case protocol.EventMemberRemoved:
+		room.DisconnectUser(event.UserID)
+	case protocol.EventRoomDeleted:
+		room.DisconnectAll()
+	}
+}
+
+// Stop корректно закрывает каналы и соединение
 func (rm *rabbitManager) Stop() {
-	if rm.ch != nil {
-		_ = rm.ch.Close()
+	rm.stopOnce.Do(func() {
+		close(rm.done)
+	})
+	if ch := rm.channel(); ch != nil {
+		_ = ch.Close()
+	}
+	rm.bindMu.Lock()
+	bindCh := rm.bindCh
+	rm.bindMu.Unlock()
+	if bindCh != nil {
+		_ = bindCh.Close()
 	}
 	if rm.conn != nil {
 		_ = rm.conn.Close()
@@ -0,0 +1,515 @@
+package rabbit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/andro-kes/Chat/chat/internal/protocol"
+	"github.com/andro-kes/Chat/chat/internal/services"
+	"github.com/andro-kes/Chat/chat/logger"
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestMain(m *testing.M) {
+	logger.Log = zap.NewNop()
+	os.Exit(m.Run())
+}
+
+// fakeChannel записывает обращения менеджера к каналу RabbitMQ
+type fakeChannel struct {
+	amqpChannel
+
+	mu         sync.Mutex
+	closed     bool
+	prefetch   int
+	bindErr    error
+	bindings   []binding
+	consumed   []string
+	deliveries []chan amqp.Delivery
+	notify     []chan *amqp.Error
+	// publishErrs — сколько следующих публикаций завершатся ошибкой
+	publishErrs int
+	published   []publishing
+}
+
+type publishing struct {
+	exchange string
+	key      string
+	msg      amqp.Publishing
+}
+
+func (ch *fakeChannel) Qos(prefetchCount, prefetchSize int, global bool) error {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	ch.prefetch = prefetchCount
+	return nil
+}
+
+func (ch *fakeChannel) QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error {
+	return ch.recordBinding(binding{exchange: exchange, key: key, bind: true})
+}
+
+func (ch *fakeChannel) QueueUnbind(name, key, exchange string, args amqp.Table) error {
+	return ch.recordBinding(binding{exchange: exchange, key: key})
+}
+
+// recordBinding запоминает привязку. Как и брокер, при ошибке закрывает канал
+func (ch *fakeChannel) recordBinding(b binding) error {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+	if ch.bindErr != nil {
+		ch.closed = true
+		return ch.bindErr
+	}
+	ch.bindings = append(ch.bindings, b)
+	return nil
+}
+
+func (ch *fakeChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if ch.closed {
+		return nil, amqp.ErrClosed
+	}
+	d := make(chan amqp.Delivery)
+	ch.consumed = append(ch.consumed, queue)
+	ch.deliveries = append(ch.deliveries, d)
+	return d, nil
+}
+
+func (ch *fakeChannel) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if ch.publishErrs > 0 {
+		ch.publishErrs--
+		return amqp.ErrClosed
+	}
+	ch.published = append(ch.published, publishing{exchange: exchange, key: key, msg: msg})
+	return nil
+}
+
+func (ch *fakeChannel) NotifyClose(c chan *amqp.Error) chan *amqp.Error {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	ch.notify = append(ch.notify, c)
+	return c
+}
+
+func (ch *fakeChannel) IsClosed() bool {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	return ch.closed
+}
+
+func (ch *fakeChannel) Close() error {
+	ch.shutdown(nil)
+	return nil
+}
+
+// shutdown закрывает канал так же, как брокер: консьюмеры завершаются,
+// подписчики NotifyClose получают причину
+func (ch *fakeChannel) shutdown(reason *amqp.Error) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if ch.closed && ch.deliveries == nil {
+		return
+	}
+	ch.closed = true
+	for _, d := range ch.deliveries {
+		close(d)
+	}
+	ch.deliveries = nil
+	for _, c := range ch.notify {
+		if reason != nil {
+			c <- reason
+		}
+		close(c)
+	}
+	ch.notify = nil
+}
+
+func (ch *fakeChannel) consumedQueues() []string {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	return append([]string(nil), ch.consumed...)
+}
+
+func (ch *fakeChannel) publishings() []publishing {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	return append([]publishing(nil), ch.published...)
+}
+
+func (ch *fakeChannel) appliedBindings() []binding {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	return append([]binding(nil), ch.bindings...)
+}
+
+// fakeConn выдает новый fakeChannel на каждый вызов Channel
+type fakeConn struct {
+	mu       sync.Mutex
+	closed   bool
+	channels []*fakeChannel
+}
+
+func (c *fakeConn) Channel() (amqpChannel, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, amqp.ErrClosed
+	}
+	ch := &fakeChannel{}
+	c.channels = append(c.channels, ch)
+	return ch, nil
+}
+
+func (c *fakeConn) IsClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+func (c *fakeConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *fakeConn) opened() []*fakeChannel {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*fakeChannel(nil), c.channels...)
+}
+
+func newTestManager(t *testing.T, conn *fakeConn) *rabbitManager {
+	t.Helper()
+	rm := &rabbitManager{
+		conn:       conn,
+		q:          amqp.Queue{Name: persistQueue},
+		roomQ:      amqp.Queue{Name: "amq.gen-instance"},
+		prefetch:   4,
+		bindSignal: make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+	t.Cleanup(rm.Stop)
+	return rm
+}
+
+// startTestConsumers открывает канал консьюмеров и ждет, пока оба консьюмера подпишутся
+func startTestConsumers(t *testing.T, rm *rabbitManager) *fakeChannel {
+	t.Helper()
+	ch, err := rm.openChannel()
+	require.NoError(t, err)
+	rm.ch = ch
+	rm.startConsumers(ch)
+
+	fake := ch.(*fakeChannel)
+	require.Eventually(t, func() bool {
+		return len(fake.consumedQueues()) == 2
+	}, time.Second, time.Millisecond)
+	return fake
+}
+
+func TestWatchChannelRecreatesConsumers(t *testing.T) {
+	conn := &fakeConn{}
+	rm := newTestManager(t, conn)
+	first := startTestConsumers(t, rm)
+	assert.ElementsMatch(t, []string{persistQueue, "amq.gen-instance"}, first.consumedQueues())
+
+	first.shutdown(&amqp.Error{Code: amqp.PreconditionFailed, Reason: "PRECONDITION_FAILED"})
+
+	require.Eventually(t, func() bool {
+		channels := conn.opened()
+		return len(channels) == 2 && len(channels[1].consumedQueues()) == 2
+	}, time.Second, time.Millisecond)
+
+	second := conn.opened()[1]
+	assert.ElementsMatch(t, []string{persistQueue, "amq.gen-instance"}, second.consumedQueues())
+	assert.Equal(t, 4, second.prefetch)
+	assert.Same(t, second, rm.channel())
+
+	// Новый канал тоже под наблюдением
+	second.shutdown(&amqp.Error{Code: amqp.ChannelError, Reason: "CHANNEL_ERROR"})
+	require.Eventually(t, func() bool {
+		return len(conn.opened()) == 3
+	}, time.Second, time.Millisecond)
+}
+
+func TestWatchChannelGivesUpWhenConnectionClosed(t *testing.T) {
+	conn := &fakeConn{}
+	rm := newTestManager(t, conn)
+	first := startTestConsumers(t, rm)
+
+	require.NoError(t, conn.Close())
+	first.shutdown(&amqp.Error{Code: amqp.ConnectionForced, Reason: "CONNECTION_FORCED"})
+
+	assert.Never(t, func() bool {
+		return len(conn.opened()) > 1
+	}, 50*time.Millisecond, time.Millisecond)
+	assert.Same(t, first, rm.channel())
+}
+
+func TestStopDoesNotRecreateChannel(t *testing.T) {
+	conn := &fakeConn{}
+	rm := newTestManager(t, conn)
+	first := startTestConsumers(t, rm)
+
+	rm.Stop()
+
+	assert.True(t, first.IsClosed())
+	assert.True(t, conn.IsClosed())
+	assert.Never(t, func() bool {
+		return len(conn.opened()) > 1
+	}, 50*time.Millisecond, time.Millisecond)
+}
+
+// fakeChatService сохраняет сообщения в памяти и, как БД, не сохраняет повтор client_msg_id.
+// Остальные методы паникуют через встроенный nil-интерфейс.
+type fakeChatService struct {
+	services.ChatService
+
+	mu      sync.Mutex
+	saveErr error
+	saved   map[uuid.UUID]models.Message
+	// mentions — кого сервис «находит» упомянутым в каждом сохраненном сообщении
+	mentions []uuid.UUID
+}
+
+func (s *fakeChatService) SaveMessage(msg *models.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.saveErr != nil {
+		return s.saveErr
+	}
+	if stored, ok := s.saved[msg.ClientMsgID]; ok {
+		msg.ID, msg.Seq = stored.ID, stored.Seq
+		return services.ErrDuplicateMessage
+	}
+	msg.ID = models.MessageIDFor(msg.RoomID, msg.ClientMsgID)
+	msg.Seq = int64(len(s.saved) + 1)
+	msg.Mentions = s.mentions
+	if s.saved == nil {
+		s.saved = make(map[uuid.UUID]models.Message)
+	}
+	s.saved[msg.ClientMsgID] = *msg
+	return nil
+}
+
+func (s *fakeChatService) savedCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.saved)
+}
+
+// fakeAcknowledger сообщает, чем завершилась обработка delivery: ack, nack или requeue
+type fakeAcknowledger struct {
+	result chan string
+}
+
+func newFakeAcknowledger() *fakeAcknowledger {
+	return &fakeAcknowledger{result: make(chan string, 1)}
+}
+
+func (a *fakeAcknowledger) Ack(tag uint64, multiple bool) error {
+	a.result <- "ack"
+	return nil
+}
+
+func (a *fakeAcknowledger) Nack(tag uint64, multiple, requeue bool) error {
+	if requeue {
+		a.result <- "requeue"
+	} else {
+		a.result <- "nack"
+	}
+	return nil
+}
+
+func (a *fakeAcknowledger) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+// startPersistConsumer запускает ConsumeMessages на новом канале
+// и возвращает канал, в который можно отправлять delivery
+func startPersistConsumer(t *testing.T, rm *rabbitManager) (*fakeChannel, chan amqp.Delivery) {
+	t.Helper()
+	ch, err := rm.openChannel()
+	require.NoError(t, err)
+	rm.ch = ch
+	go rm.ConsumeMessages()
+
+	fake := ch.(*fakeChannel)
+	require.Eventually(t, func() bool {
+		return len(fake.consumedQueues()) == 1
+	}, time.Second, time.Millisecond)
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	return fake, fake.deliveries[0]
+}
+
+// deliver передает сообщение консьюмеру и ждет, чем завершится его обработка
+func deliver(t *testing.T, deliveries chan<- amqp.Delivery, msg models.Message) string {
+	t.Helper()
+	body, err := json.Marshal(msg)
+	require.NoError(t, err)
+	ack := newFakeAcknowledger()
+	deliveries <- amqp.Delivery{Acknowledger: ack, Body: body}
+	select {
+	case result := <-ack.result:
+		return result
+	case <-time.After(time.Second):
+		t.Fatal("delivery не подтверждена")
+		return ""
+	}
+}
+
+func newPersistFixture(t *testing.T) (*fakeChatService, *fakeChannel, chan amqp.Delivery) {
+	t.Helper()
+	delay := publishRetryDelay
+	publishRetryDelay = 0
+	t.Cleanup(func() { publishRetryDelay = delay })
+
+	svc := &fakeChatService{}
+	rm := newTestManager(t, &fakeConn{})
+	rm.ChatService = svc
+	ch, deliveries := startPersistConsumer(t, rm)
+	return svc, ch, deliveries
+}
+
+func testMessage() models.Message {
+	return models.Message{RoomID: uuid.New(), SenderID: uuid.New(), Content: "привет", ClientMsgID: uuid.New()}
+}
+
+func TestConsumeAcksDuplicateWithoutPublishing(t *testing.T) {
+	svc, ch, deliveries := newPersistFixture(t)
+	msg := testMessage()
+
+	assert.Equal(t, "ack", deliver(t, deliveries, msg))
+	assert.Equal(t, "ack", deliver(t, deliveries, msg))
+
+	assert.Equal(t, 1, svc.savedCount())
+	assert.Len(t, ch.publishings(), 1)
+}
+
+func TestConsumeRetriesPublishOfSavedMessage(t *testing.T) {
+	svc, ch, deliveries := newPersistFixture(t)
+	ch.mu.Lock()
+	ch.publishErrs = publishAttempts - 1
+	ch.mu.Unlock()
+	msg := testMessage()
+
+	assert.Equal(t, "ack", deliver(t, deliveries, msg))
+
+	assert.Equal(t, 1, svc.savedCount())
+	published := ch.publishings()
+	require.Len(t, published, 1)
+	assert.Equal(t, roomsExchange, published[0].exchange)
+	assert.Equal(t, msg.RoomID.String(), published[0].key)
+
+	var frame protocol.Frame
+	require.NoError(t, json.Unmarshal(published[0].msg.Body, &frame))
+	var stored models.Message
+	require.NoError(t, frame.Decode(&stored))
+	assert.Equal(t, models.MessageIDFor(msg.RoomID, msg.ClientMsgID), stored.ID)
+	assert.Equal(t, int64(1), stored.Seq)
+}
+
+// Сохраненное сообщение не возвращается в очередь: повторная доставка оказалась бы
+// дубликатом и так и не дошла бы до клиентов
+func TestConsumeAcksSavedMessageWhenPublishFails(t *testing.T) {
+	svc, ch, deliveries := newPersistFixture(t)
+	ch.mu.Lock()
+	ch.publishErrs = publishAttempts
+	ch.mu.Unlock()
+
+	assert.Equal(t, "ack", deliver(t, deliveries, testMessage()))
+
+	assert.Equal(t, 1, svc.savedCount())
+	assert.Empty(t, ch.publishings())
+}
+
+func TestConsumeRequeuesWhenSaveFails(t *testing.T) {
+	svc, ch, deliveries := newPersistFixture(t)
+	svc.mu.Lock()
+	svc.saveErr = errors.New("connection refused")
+	svc.mu.Unlock()
+
+	assert.Equal(t, "requeue", deliver(t, deliveries, testMessage()))
+	assert.Empty(t, ch.publishings())
+}
+
+func TestConsumeDropsInvalidJSON(t *testing.T) {
+	_, ch, deliveries := newPersistFixture(t)
+	ack := newFakeAcknowledger()
+
+	deliveries <- amqp.Delivery{Acknowledger: ack, Body: []byte("{")}
+
+	assert.Equal(t, "nack", <-ack.result)
+	assert.Empty(t, ch.publishings())
+}
+
+// Событие набора текста уходит только в exchange комнат и не доживает до поздних подписчиков
+func TestPublishEphemeralIsNotPersisted(t *testing.T) {
+	rm := newTestManager(t, &fakeConn{})
+	ch := startTestConsumers(t, rm)
+	roomID := uuid.New()
+	frame, err := protocol.NewFrame(protocol.TypeTyping, "", nil)
+	require.NoError(t, err)
+
+	require.NoError(t, rm.PublishEphemeral(roomID, frame, 6*time.Second))
+	require.NoError(t, rm.PublishEvent(roomID, frame))
+
+	published := ch.publishings()
+	require.Len(t, published, 2)
+	for _, p := range published {
+		assert.Equal(t, roomsExchange, p.exchange)
+		assert.Equal(t, roomID.String(), p.key)
+		assert.NotEqual(t, amqp.Persistent, p.msg.DeliveryMode)
+	}
+	assert.Equal(t, "6000", published[0].msg.Expiration)
+	assert.Empty(t, published[1].msg.Expiration)
+}
+
+func TestConsumePublishesMentionsOnce(t *testing.T) {
+	svc, ch, deliveries := newPersistFixture(t)
+	bob, carol := uuid.New(), uuid.New()
+	svc.mu.Lock()
+	svc.mentions = []uuid.UUID{bob, carol}
+	svc.mu.Unlock()
+	msg := testMessage()
+
+	assert.Equal(t, "ack", deliver(t, deliveries, msg))
+	// Повторная доставка уже сохранена: ни рассылки, ни повторных уведомлений
+	assert.Equal(t, "ack", deliver(t, deliveries, msg))
+
+	published := ch.publishings()
+	require.Len(t, published, 3)
+	assert.Equal(t, roomsExchange, published[0].exchange)
+	for i, userID := range []uuid.UUID{bob, carol} {
+		p := published[i+1]
+		assert.Equal(t, usersExchange, p.exchange)
+		assert.Equal(t, userID.String(), p.key)
+
+		var frame protocol.Frame
+		require.NoError(t, json.Unmarshal(p.msg.Body, &frame))
+		assert.Equal(t, protocol.TypeMention, frame.Type)
+		var payload protocol.MentionPayload
+		require.NoError(t, frame.Decode(&payload))
+		assert.Equal(t, msg.RoomID, payload.RoomID)
+		assert.Equal(t, models.MessageIDFor(msg.RoomID, msg.ClientMsgID), payload.MessageID)
+	}
+}
@@ -0,0 +1,224 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrAttachmentNotFound = errors.New("вложение не найдено")
+
+const attachmentColumns = "a.id, a.room_id, a.uploader_id, a.message_id, a.name, a.size, a.mime_type, a.checksum, a.storage_key, a.created_at"
+
+// SaveAttachment сохраняет метаданные загруженного вложения
+func (rr *roomRepo) SaveAttachment(a *models.Attachment) error {
+	return rr.Pool.QueryRow(
+		context.Background(),
+		`INSERT INTO attachments (id, room_id, uploader_id, name, size, mime_type, checksum, storage_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING created_at`,
+		a.ID,
+		a.RoomID,
+		a.UploaderID,
+		a.Name,
+		a.Size,
+		a.MimeType,
+		a.Checksum,
+		a.StorageKey,
+	).Scan(&a.CreatedAt)
+}
+
+// DeleteStaleAttachments удаляет до limit вложений, которые так и не приложили к сообщению
+// за age, и возвращает их ключи в хранилище. Строки блокируются с SKIP LOCKED, а привязка
+// к сообщению проверяет message_id IS NULL, поэтому приложенное вложение не удаляется.
+func (rr *roomRepo) DeleteStaleAttachments(age time.Duration, limit int) ([]string, error) {
+	rows, err := rr.Pool.Query(
+		context.Background(),
+		`DELETE FROM attachments
+		WHERE id IN (
+			SELECT id FROM attachments
+			WHERE message_id IS NULL AND created_at < NOW() - make_interval(secs => $1)
+			ORDER BY created_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING storage_key`,
+		age.Seconds(),
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// GetAttachment возвращает вложение комнаты. Вложения удаленных сообщений не отдаются.
+func (rr *roomRepo) GetAttachment(roomId, attachmentId uuid.UUID) (*models.Attachment, error) {
+	rows, err := rr.Pool.Query(
+		context.Background(),
+		"SELECT "+attachmentColumns+` FROM attachments a
+		LEFT JOIN messages m ON m.id = a.message_id
+		WHERE a.room_id = $1 AND a.id = $2 AND m.deleted_at IS NULL`,
+		roomId,
+		attachmentId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	attachments, err := scanAttachments(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(attachments) == 0 {
+		return nil, ErrAttachmentNotFound
+	}
+	return &attachments[0], nil
+}
+
+// GetPendingAttachments возвращает вложения, загруженные uploaderId в комнату и еще не привязанные
+// к сообщениям (или уже привязанные к messageId — так ретрай сообщения проходит проверку).
+// Чужие, привязанные к другим сообщениям и несуществующие id пропускаются.
+func (rr *roomRepo) GetPendingAttachments(roomId, uploaderId, messageId uuid.UUID, ids []uuid.UUID) ([]models.Attachment, error) {
+	rows, err := rr.Pool.Query(
+		context.Background(),
+		"SELECT "+attachmentColumns+` FROM attachments a
+		WHERE a.room_id = $1 AND a.uploader_id = $2 AND a.id = ANY($3)
+			AND (a.message_id IS NULL OR a.message_id = $4)
+		ORDER BY a.created_at, a.id`,
+		roomId,
+		uploaderId,
+		ids,
+		messageId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanAttachments(rows)
+}
+
+// linkAttachments привязывает вложения msg к сообщению в транзакции его сохранения.
+// Вложения, которые успели привязать к другому сообщению, из msg убираются.
+func linkAttachments(ctx context.Context, tx pgx.Tx, msg *models.Message) error {
+	if len(msg.Attachments) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, len(msg.Attachments))
+	for i := range msg.Attachments {
+		ids[i] = msg.Attachments[i].ID
+	}
+
+	rows, err := tx.Query(
+		ctx,
+		`UPDATE attachments SET message_id = $1
+		WHERE id = ANY($2) AND room_id = $3 AND uploader_id = $4 AND message_id IS NULL
+		RETURNING id`,
+		msg.ID,
+		ids,
+		msg.RoomID,
+		msg.SenderID,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	linked := make(map[uuid.UUID]struct{}, len(ids))
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		linked[id] = struct{}{}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	attachments := msg.Attachments[:0]
+	for _, a := range msg.Attachments {
+		if _, ok := linked[a.ID]; ok {
+			a.MessageID = &msg.ID
+			attachments = append(attachments, a)
+		}
+	}
+	msg.Attachments = attachments
+	return nil
+}
+
+// AttachFiles заполняет Attachments у неудаленных сообщений одним запросом
+func (rr *roomRepo) AttachFiles(messages []models.Message) error {
+	ids := make([]uuid.UUID, 0, len(messages))
+	index := make(map[uuid.UUID]int, len(messages))
+	for i := range messages {
+		if messages[i].DeletedAt != nil {
+			continue
+		}
+		ids = append(ids, messages[i].ID)
+		index[messages[i].ID] = i
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	rows, err := rr.Pool.Query(
+		context.Background(),
+		"SELECT "+attachmentColumns+` FROM attachments a
+		WHERE a.message_id = ANY($1)
+		ORDER BY a.created_at, a.id`,
+		ids,
+	)
+	if err != nil {
+		return err
+	}
+	attachments, err := scanAttachments(rows)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range attachments {
+		msg := &messages[index[*a.MessageID]]
+		msg.Attachments = append(msg.Attachments, a)
+	}
+	return nil
+}
+
+func scanAttachments(rows pgx.Rows) ([]models.Attachment, error) {
+	defer rows.Close()
+
+	var attachments []models.Attachment
+	for rows.Next() {
+		var a models.Attachment
+		err := rows.Scan(
+			&a.ID,
+			&a.RoomID,
+			&a.UploaderID,
+			&a.MessageID,
+			&a.Name,
+			&a.Size,
+			&a.MimeType,
+			&a.Checksum,
+			&a.StorageKey,
+			&a.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
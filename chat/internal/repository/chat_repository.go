@@ -9,16 +9,39 @@ import (
 	"github.com/andro-kes/Chat/chat/internal/models"
 	"github.com/andro-kes/Chat/chat/logger"
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"go.uber.org/zap"
 )
 
+// uniqueViolation — код ошибки Postgres при нарушении уникального ограничения
+const uniqueViolation = "23505"
+
+var (
+	ErrRoomExists     = errors.New("комната с таким названием уже существует")
+	ErrRoomNotFound   = errors.New("комната не найдена")
+	ErrMemberNotFound = errors.New("пользователь не состоит в комнате")
+	ErrNotOwner       = errors.New("пользователь не является владельцем комнаты")
+)
+
 type ChatRepo interface {
 	FindRoomByID(id uuid.UUID) (*models.Room, error)
-	CheckAccess(userId uuid.UUID) error
-	CreateRoom(name string, adminID uuid.UUID) error
-	GetUserRooms(userId uuid.UUID) ([]models.Room, error)
+	CheckAccess(roomID, userID uuid.UUID) (bool, error)
+	CreateRoom(name string, adminID uuid.UUID) (*models.Room, error)
+	GetUserRooms(userId uuid.UUID) ([]models.UserRoom, error)
+	OpenDirectRoom(roomID, userID, peerID uuid.UUID) (*models.Room, error)
+	GetDirectRooms(userId uuid.UUID) ([]models.DirectRoom, error)
+	AddMember(roomID, userID uuid.UUID) (bool, error)
+	RemoveMember(roomID, userID uuid.UUID) error
+	GetMembers(roomID uuid.UUID) ([]models.RoomMember, error)
+	GetMemberRole(roomID, userID uuid.UUID) (models.Role, error)
+	SetMemberRole(roomID, userID uuid.UUID, role models.Role) error
+	TransferOwnership(roomID, fromID, toID uuid.UUID) error
+	RenameRoom(roomID uuid.UUID, name string) error
+	SetMessageTTL(roomID uuid.UUID, ttl int64) error
+	DeleteRoom(roomID uuid.UUID) error
+	MarkRead(roomID, userID uuid.UUID, seq int64) (int64, bool, error)
 }
 
 type chatRepo struct {
@@ -31,30 +54,31 @@ func NewChatRepo() *chatRepo {
 	}
 }
 
-// CreateRoom создает новую комнату и добавляет администратора в список пользователей
-func (cr *chatRepo) CreateRoom(name string, adminID uuid.UUID) error {
-	roomId := uuid.New()
-	now := time.Now()
-	users := pgtype.Array[uuid.UUID]{
-		Elements: []uuid.UUID{adminID},
-		Valid:    true,
+// CreateRoom создает новую комнату и добавляет создателя владельцем одной транзакцией
+func (cr *chatRepo) CreateRoom(name string, adminID uuid.UUID) (*models.Room, error) {
+	ctx := context.Background()
+	room := &models.Room{
+		ID:        uuid.New(),
+		Name:      name,
+		CreatedBy: adminID,
+		CreatedAt: time.Now(),
+		Kind:      models.RoomGroup,
 	}
 
-	sql := `
-		INSERT INTO rooms (id, created_at, updated_at, deleted_at, name, users) 
-		VALUES ($1, $2, $3, $4, $5, $6)
-	`
-	_, err := cr.Pool.Exec(
-		context.Background(),
-		sql,
-		roomId,
-		now,
-		now,
-		nil,
-		name,
-		users,
+	tx, err := cr.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(
+		ctx,
+		`INSERT INTO rooms (id, name, created_by, created_at) VALUES ($1, $2, $3, $4)`,
+		room.ID,
+		room.Name,
+		room.CreatedBy,
+		room.CreatedAt,
 	)
-	
 	if err != nil {
 		logger.Log.Warn(
 			"Не удалось создать комнату",
@@ -62,60 +86,100 @@ func (cr *chatRepo) CreateRoom(name string, adminID uuid.UUID) error {
 			zap.String("admin_id", adminID.String()),
 			zap.Error(err),
 		)
-		return err
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return nil, ErrRoomExists
+		}
+		return nil, err
 	}
 
-	return nil
+	_, err = tx.Exec(
+		ctx,
+		`INSERT INTO room_users (room_id, user_id, role, joined_at) VALUES ($1, $2, $3, $4)`,
+		room.ID,
+		adminID,
+		models.RoleOwner,
+		room.CreatedAt,
+	)
+	if err != nil {
+		logger.Log.Warn("Не удалось добавить создателя в комнату", zap.String("room_id", room.ID.String()), zap.Error(err))
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return room, nil
 }
 
 // FindRoomByID возвращает комнату по ID или ошибку
 func (cr *chatRepo) FindRoomByID(id uuid.UUID) (*models.Room, error) {
-	sql := `SELECT id, name, users FROM rooms WHERE id = $1 AND deleted_at IS NULL`
+	sql := `SELECT id, name, kind, created_by, created_at, updated_at, message_ttl FROM rooms WHERE id = $1 AND deleted_at IS NULL`
 	var room models.Room
 	err := cr.Pool.QueryRow(
 		context.Background(),
 		sql,
 		id,
-	).Scan(&room.ID, &room.Name, &room.Users)
+	).Scan(&room.ID, &room.Name, &room.Kind, &room.CreatedBy, &room.CreatedAt, &room.UpdatedAt, &room.MessageTTL)
 	if err != nil {
 		logger.Log.Warn(
 			"Не удалось найти комнату",
 			zap.String("id", id.String()),
 			zap.Error(err),
 		)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrRoomNotFound
+		}
 		return nil, err
 	}
 
 	return &room, nil
 }
 
-// CheckAccess проверяет, имеет ли пользователь доступ к комнате
-func (rr *chatRepo) CheckAccess(userId uuid.UUID) error {
-	var username string
+// CheckAccess проверяет, состоит ли пользователь в комнате
+func (rr *chatRepo) CheckAccess(roomID, userID uuid.UUID) (bool, error) {
+	var isMember bool
 	err := rr.Pool.QueryRow(
 		context.Background(),
-		"SELECT username FROM users u JOIN room_users ru ON u.id = ru.user_id WHERE ru.room_id = ANY(SELECT id FROM rooms WHERE deleted_at IS NULL) AND ru.user_id = $1",
-		userId,
-	).Scan(&username)
-
+		`SELECT EXISTS(
+			SELECT 1 FROM room_users ru
+			JOIN rooms r ON r.id = ru.room_id
+			WHERE ru.room_id = $1 AND ru.user_id = $2 AND r.deleted_at IS NULL
+		)`,
+		roomID,
+		userID,
+	).Scan(&isMember)
 	if err != nil {
-		return errors.New("не удалось выполнить запрос")
-	}
-
-	if username == "" {
-		return errors.New("нет доступа")
+		logger.Log.Warn(
+			"Не удалось проверить доступ к комнате",
+			zap.String("room_id", roomID.String()),
+			zap.String("user_id", userID.String()),
+			zap.Error(err),
+		)
+		return false, err
 	}
 
-	return nil
+	return isMember, nil
 }
 
-// GetUserRooms возвращает список комнат, к которым имеет доступ пользователь
-func (rr *chatRepo) GetUserRooms(userId uuid.UUID) ([]models.Room, error) {
+// userRoomColumns — поля комнаты в списке комнат пользователя: сама комната, курсор
+// чтения, число непрочитанных сообщений и упоминаний. Ожидает алиасы r (rooms) и ru (room_users).
+const userRoomColumns = `r.id, r.name, r.kind, r.created_by, r.created_at, r.updated_at, ru.last_read_seq,
+	(SELECT COUNT(*) FROM messages m
+		WHERE m.room_id = r.id AND m.seq > ru.last_read_seq
+		AND m.user_id <> ru.user_id AND m.deleted_at IS NULL),
+	(SELECT COUNT(*) FROM messages m
+		JOIN message_mentions mm ON mm.message_id = m.id AND mm.user_id = ru.user_id
+		WHERE m.room_id = r.id AND m.seq > ru.last_read_seq AND m.deleted_at IS NULL)`
+
+// GetUserRooms возвращает список групповых комнат, к которым имеет доступ пользователь,
+// с числом непрочитанных сообщений и упоминаний
+func (rr *chatRepo) GetUserRooms(userId uuid.UUID) ([]models.UserRoom, error) {
 	sql := `
-		SELECT r.id, r.name, r.users 
+		SELECT ` + userRoomColumns + `
 		FROM rooms r
 		JOIN room_users ru ON r.id = ru.room_id
-		WHERE ru.user_id = $1 AND r.deleted_at IS NULL
+		WHERE ru.user_id = $1 AND r.deleted_at IS NULL AND r.kind = 'group'
 	`
 
 	rows, err := rr.Pool.Query(context.Background(), sql, userId)
@@ -124,10 +188,10 @@ func (rr *chatRepo) GetUserRooms(userId uuid.UUID) ([]models.Room, error) {
 	}
 	defer rows.Close()
 
-	var rooms []models.Room
+	var rooms []models.UserRoom
 	for rows.Next() {
-		var room models.Room
-		if err := rows.Scan(&room.ID, &room.Name, &room.Users); err != nil {
+		var room models.UserRoom
+		if err := rows.Scan(userRoomFields(&room)...); err != nil {
 			return nil, err
 		}
 		rooms = append(rooms, room)
@@ -139,3 +203,298 @@ func (rr *chatRepo) GetUserRooms(userId uuid.UUID) ([]models.Room, error) {
 
 	return rooms, nil
 }
+
+// userRoomFields возвращает указатели на поля room в порядке userRoomColumns
+func userRoomFields(room *models.UserRoom) []any {
+	return []any{
+		&room.ID,
+		&room.Name,
+		&room.Kind,
+		&room.CreatedBy,
+		&room.CreatedAt,
+		&room.UpdatedAt,
+		&room.LastReadSeq,
+		&room.UnreadCount,
+		&room.MentionCount,
+	}
+}
+
+// AddMember добавляет пользователя в участники комнаты.
+// Сообщения, отправленные до вступления, считаются прочитанными.
+// Возвращает false, если пользователь уже состоял в комнате.
+func (rr *chatRepo) AddMember(roomID, userID uuid.UUID) (bool, error) {
+	tag, err := rr.Pool.Exec(
+		context.Background(),
+		`INSERT INTO room_users (room_id, user_id, joined_at, last_read_seq)
+		SELECT $1, $2, $3, last_seq FROM rooms WHERE id = $1
+		ON CONFLICT (room_id, user_id) DO NOTHING`,
+		roomID,
+		userID,
+		time.Now(),
+	)
+	if err != nil {
+		logger.Log.Warn(
+			"Не удалось добавить участника в комнату",
+			zap.String("room_id", roomID.String()),
+			zap.String("user_id", userID.String()),
+			zap.Error(err),
+		)
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// RemoveMember удаляет пользователя из участников комнаты
+func (rr *chatRepo) RemoveMember(roomID, userID uuid.UUID) error {
+	tag, err := rr.Pool.Exec(
+		context.Background(),
+		`DELETE FROM room_users WHERE room_id = $1 AND user_id = $2`,
+		roomID,
+		userID,
+	)
+	if err != nil {
+		logger.Log.Warn(
+			"Не удалось удалить участника из комнаты",
+			zap.String("room_id", roomID.String()),
+			zap.String("user_id", userID.String()),
+			zap.Error(err),
+		)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrMemberNotFound
+	}
+	return nil
+}
+
+// GetMembers возвращает участников комнаты в порядке вступления
+func (rr *chatRepo) GetMembers(roomID uuid.UUID) ([]models.RoomMember, error) {
+	rows, err := rr.Pool.Query(
+		context.Background(),
+		`SELECT room_id, user_id, role, joined_at, last_read_seq FROM room_users WHERE room_id = $1 ORDER BY joined_at ASC`,
+		roomID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []models.RoomMember
+	for rows.Next() {
+		var m models.RoomMember
+		if err := rows.Scan(&m.RoomID, &m.UserID, &m.Role, &m.JoinedAt, &m.LastReadSeq); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// GetMemberRole возвращает роль пользователя в неудаленной комнате
+func (rr *chatRepo) GetMemberRole(roomID, userID uuid.UUID) (models.Role, error) {
+	var role models.Role
+	err := rr.Pool.QueryRow(
+		context.Background(),
+		`SELECT ru.role FROM room_users ru
+		JOIN rooms r ON r.id = ru.room_id
+		WHERE ru.room_id = $1 AND ru.user_id = $2 AND r.deleted_at IS NULL`,
+		roomID,
+		userID,
+	).Scan(&role)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrMemberNotFound
+		}
+		logger.Log.Warn(
+			"Не удалось получить роль участника",
+			zap.String("room_id", roomID.String()),
+			zap.String("user_id", userID.String()),
+			zap.Error(err),
+		)
+		return "", err
+	}
+	return role, nil
+}
+
+// SetMemberRole меняет роль участника комнаты
+func (rr *chatRepo) SetMemberRole(roomID, userID uuid.UUID, role models.Role) error {
+	tag, err := rr.Pool.Exec(
+		context.Background(),
+		`UPDATE room_users SET role = $3 WHERE room_id = $1 AND user_id = $2`,
+		roomID,
+		userID,
+		role,
+	)
+	if err != nil {
+		logger.Log.Warn("Не удалось изменить роль участника", zap.String("room_id", roomID.String()), zap.Error(err))
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrMemberNotFound
+	}
+	return nil
+}
+
+// TransferOwnership передает владение комнатой другому участнику.
+// Прежний владелец становится администратором. Понижение выполняется первым и только
+// при роли владельца: строка остается заблокированной до конца транзакции, поэтому две
+// параллельные передачи не создадут двух владельцев — вторая получит ErrNotOwner.
+func (rr *chatRepo) TransferOwnership(roomID, fromID, toID uuid.UUID) error {
+	ctx := context.Background()
+	tx, err := rr.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(
+		ctx,
+		`UPDATE room_users SET role = $3 WHERE room_id = $1 AND user_id = $2 AND role = $4`,
+		roomID,
+		fromID,
+		models.RoleAdmin,
+		models.RoleOwner,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != 1 {
+		return ErrNotOwner
+	}
+
+	tag, err = tx.Exec(
+		ctx,
+		`UPDATE room_users SET role = $3 WHERE room_id = $1 AND user_id = $2`,
+		roomID,
+		toID,
+		models.RoleOwner,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrMemberNotFound
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		logger.Log.Warn("Не удалось передать владение комнатой", zap.String("room_id", roomID.String()), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// RenameRoom меняет название комнаты
+func (rr *chatRepo) RenameRoom(roomID uuid.UUID, name string) error {
+	tag, err := rr.Pool.Exec(
+		context.Background(),
+		`UPDATE rooms SET name = $2, updated_at = $3 WHERE id = $1 AND deleted_at IS NULL`,
+		roomID,
+		name,
+		time.Now(),
+	)
+	if err != nil {
+		logger.Log.Warn("Не удалось переименовать комнату", zap.String("room_id", roomID.String()), zap.Error(err))
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return ErrRoomExists
+		}
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrRoomNotFound
+	}
+	return nil
+}
+
+// SetMessageTTL меняет срок жизни сообщений комнаты по умолчанию (в секундах, 0 — без срока).
+// Уже отправленные сообщения сохраняют свой срок.
+func (rr *chatRepo) SetMessageTTL(roomID uuid.UUID, ttl int64) error {
+	tag, err := rr.Pool.Exec(
+		context.Background(),
+		`UPDATE rooms SET message_ttl = $2, updated_at = $3 WHERE id = $1 AND deleted_at IS NULL`,
+		roomID,
+		ttl,
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrRoomNotFound
+	}
+	return nil
+}
+
+// DeleteRoom помечает комнату удаленной. Сообщения и участники остаются в БД.
+func (rr *chatRepo) DeleteRoom(roomID uuid.UUID) error {
+	tag, err := rr.Pool.Exec(
+		context.Background(),
+		`UPDATE rooms SET deleted_at = $2 WHERE id = $1 AND deleted_at IS NULL`,
+		roomID,
+		time.Now(),
+	)
+	if err != nil {
+		logger.Log.Warn("Не удалось удалить комнату", zap.String("room_id", roomID.String()), zap.Error(err))
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrRoomNotFound
+	}
+	return nil
+}
+
+// MarkRead сдвигает курсор чтения участника вперед до seq, но не дальше последнего
+// сообщения комнаты. Курсор никогда не сдвигается назад.
+// Возвращает текущий курсор и true, если он изменился.
+func (rr *chatRepo) MarkRead(roomID, userID uuid.UUID, seq int64) (int64, bool, error) {
+	ctx := context.Background()
+	tx, err := rr.Pool.Begin(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var prev, lastSeq int64
+	err = tx.QueryRow(
+		ctx,
+		`SELECT ru.last_read_seq, r.last_seq
+		FROM room_users ru
+		JOIN rooms r ON r.id = ru.room_id
+		WHERE ru.room_id = $1 AND ru.user_id = $2
+		FOR UPDATE OF ru`,
+		roomID,
+		userID,
+	).Scan(&prev, &lastSeq)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, false, ErrMemberNotFound
+		}
+		return 0, false, err
+	}
+
+	current := max(prev, min(seq, lastSeq))
+	if current == prev {
+		return prev, false, nil
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		`UPDATE room_users SET last_read_seq = $3 WHERE room_id = $1 AND user_id = $2`,
+		roomID,
+		userID,
+		current,
+	)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, false, err
+	}
+	return current, true, nil
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/google/uuid"
+)
+
+var ErrInvalidCursor = errors.New("невалидный курсор")
+
+// messageCursor — позиция сообщения в истории комнаты.
+// Сообщения упорядочены по seq, который уникален в пределах комнаты.
+type messageCursor struct {
+	Seq int64
+}
+
+func cursorOf(msg *models.Message) messageCursor {
+	return messageCursor{Seq: msg.Seq}
+}
+
+// encode возвращает непрозрачное представление курсора для клиента
+func (c messageCursor) encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(c.Seq, 10)))
+}
+
+func decodeCursor(s string) (messageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return messageCursor{}, ErrInvalidCursor
+	}
+	seq, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || seq < 0 {
+		return messageCursor{}, ErrInvalidCursor
+	}
+	return messageCursor{Seq: seq}, nil
+}
+
+// searchCursor — позиция в результатах поиска. Результаты собраны из разных комнат,
+// поэтому упорядочены не по seq, а по (created_at, id).
+type searchCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+func searchCursorOf(msg *models.Message) searchCursor {
+	return searchCursor{CreatedAt: msg.CreatedAt, ID: msg.ID}
+}
+
+func (c searchCursor) encode() string {
+	raw := strconv.FormatInt(c.CreatedAt.UnixNano(), 10) + ":" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeSearchCursor(s string) (searchCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return searchCursor{}, ErrInvalidCursor
+	}
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return searchCursor{}, ErrInvalidCursor
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return searchCursor{}, ErrInvalidCursor
+	}
+	msgID, err := uuid.Parse(id)
+	if err != nil {
+		return searchCursor{}, ErrInvalidCursor
+	}
+	return searchCursor{CreatedAt: time.Unix(0, n).UTC(), ID: msgID}, nil
+}
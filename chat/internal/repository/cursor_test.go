@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageCursorRoundTrip(t *testing.T) {
+	for _, seq := range []int64{0, 1, 42, 1 << 40} {
+		cursor := cursorOf(&models.Message{Seq: seq})
+		got, err := decodeCursor(cursor.encode())
+		require.NoError(t, err)
+		assert.Equal(t, seq, got.Seq)
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	encode := func(raw string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"пустая строка", ""},
+		{"не base64", "!!!"},
+		{"отрицательный seq", encode("-1")},
+		{"seq не число", encode("x")},
+		{"старый формат с временем", encode("1700000000:00000000-0000-0000-0000-000000000000")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeCursor(tt.cursor)
+			assert.ErrorIs(t, err, ErrInvalidCursor)
+		})
+	}
+}
+
+func TestSearchCursorRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor searchCursor
+	}{
+		{"наносекунды", searchCursor{CreatedAt: time.Date(2025, 3, 14, 15, 9, 26, 535897932, time.UTC), ID: uuid.New()}},
+		{"начало эпохи", searchCursor{CreatedAt: time.Unix(0, 0).UTC(), ID: uuid.New()}},
+		{"до эпохи", searchCursor{CreatedAt: time.Date(1969, 7, 20, 20, 17, 0, 0, time.UTC), ID: uuid.New()}},
+		{"нулевой id", searchCursor{CreatedAt: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), ID: uuid.Nil}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeSearchCursor(tt.cursor.encode())
+			require.NoError(t, err)
+			assert.True(t, tt.cursor.CreatedAt.Equal(got.CreatedAt))
+			assert.Equal(t, tt.cursor.ID, got.ID)
+		})
+	}
+}
+
+func TestSearchCursorNormalizesZone(t *testing.T) {
+	local := time.Date(2025, 6, 1, 12, 0, 0, 0, time.FixedZone("MSK", 3*60*60))
+	got, err := decodeSearchCursor(searchCursor{CreatedAt: local, ID: uuid.New()}.encode())
+	require.NoError(t, err)
+	assert.Equal(t, time.UTC, got.CreatedAt.Location())
+	assert.True(t, local.Equal(got.CreatedAt))
+}
+
+func TestDecodeSearchCursorInvalid(t *testing.T) {
+	encode := func(raw string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"пустая строка", ""},
+		{"не base64", "!!!"},
+		{"без разделителя", encode("1700000000")},
+		{"время не число", encode("abc:" + uuid.NewString())},
+		{"невалидный id", encode("1700000000:not-a-uuid")},
+		{"курсор истории", messageCursor{Seq: 42}.encode()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeSearchCursor(tt.cursor)
+			assert.ErrorIs(t, err, ErrInvalidCursor)
+		})
+	}
+}
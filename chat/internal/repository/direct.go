@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/andro-kes/Chat/chat/logger"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// OpenDirectRoom возвращает личную переписку userID и peerID с id roomID, создавая её
+// при первом обращении. Оба пользователя становятся участниками с ролью member.
+func (rr *chatRepo) OpenDirectRoom(roomID, userID, peerID uuid.UUID) (*models.Room, error) {
+	ctx := context.Background()
+	tx, err := rr.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	now := time.Now()
+	_, err = tx.Exec(
+		ctx,
+		`INSERT INTO rooms (id, name, kind, created_by, created_at) VALUES ($1, '', $2, $3, $4)
+		ON CONFLICT (id) DO NOTHING`,
+		roomID,
+		models.RoomDirect,
+		userID,
+		now,
+	)
+	if err != nil {
+		logger.Log.Warn(
+			"Не удалось создать личную переписку",
+			zap.String("room_id", roomID.String()),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		`INSERT INTO room_users (room_id, user_id, role, joined_at, last_read_seq)
+		SELECT r.id, u.user_id, $3, $4, r.last_seq
+		FROM rooms r, unnest($2::uuid[]) AS u(user_id)
+		WHERE r.id = $1
+		ON CONFLICT (room_id, user_id) DO NOTHING`,
+		roomID,
+		[]uuid.UUID{userID, peerID},
+		models.RoleMember,
+		now,
+	)
+	if err != nil {
+		logger.Log.Warn(
+			"Не удалось добавить участников личной переписки",
+			zap.String("room_id", roomID.String()),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	var room models.Room
+	err = tx.QueryRow(
+		ctx,
+		`SELECT id, name, kind, created_by, created_at, updated_at, message_ttl FROM rooms
+		WHERE id = $1 AND kind = $2 AND deleted_at IS NULL`,
+		roomID,
+		models.RoomDirect,
+	).Scan(&room.ID, &room.Name, &room.Kind, &room.CreatedBy, &room.CreatedAt, &room.UpdatedAt, &room.MessageTTL)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrRoomNotFound
+		}
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
+
+// GetDirectRooms возвращает личные переписки пользователя с id собеседника,
+// числом непрочитанных сообщений и упоминаний
+func (rr *chatRepo) GetDirectRooms(userId uuid.UUID) ([]models.DirectRoom, error) {
+	sql := `
+		SELECT ` + userRoomColumns + `, peer.user_id
+		FROM rooms r
+		JOIN room_users ru ON r.id = ru.room_id
+		JOIN room_users peer ON peer.room_id = r.id AND peer.user_id <> ru.user_id
+		WHERE ru.user_id = $1 AND r.deleted_at IS NULL AND r.kind = 'direct'
+	`
+
+	rows, err := rr.Pool.Query(context.Background(), sql, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rooms []models.DirectRoom
+	for rows.Next() {
+		var room models.DirectRoom
+		if err := rows.Scan(append(userRoomFields(&room.UserRoom), &room.PeerID)...); err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, room)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rooms, nil
+}
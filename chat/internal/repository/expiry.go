@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// DeleteExpiredMessages удаляет из базы до limit сообщений с истекшим сроком жизни.
+// Возвращает «надгробия» удаленных сообщений (без текста) и ключи хранилища их вложений,
+// чтобы вызывающий удалил файлы и разослал удаление клиентам.
+//
+// Строки блокируются с SKIP LOCKED, поэтому несколько инстансов могут убирать
+// сообщения одновременно и не удалят одно и то же дважды. Ответы в треде
+// удаляются вместе с корнем и тоже попадают в результат, у корня истекшего ответа
+// уменьшается reply_count.
+func (rr *roomRepo) DeleteExpiredMessages(limit int) ([]models.Message, []string, error) {
+	ctx := context.Background()
+	tx, err := rr.Pool.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(
+		ctx,
+		`SELECT id
+		FROM messages
+		WHERE expires_at <= NOW()
+		ORDER BY expires_at
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED`,
+		limit,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil, nil
+	}
+
+	// Вложения удаляем явно: иначе внешний ключ отвяжет их, и они снова станут
+	// доступны загрузившему как неприложенные. Это касается и ответов удаляемых корней.
+	keys, err := deleteMessageAttachments(ctx, tx, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		`UPDATE messages m SET reply_count = GREATEST(m.reply_count - e.n, 0)
+		FROM (
+			SELECT parent_id, COUNT(*) AS n FROM messages
+			WHERE id = ANY($1) AND parent_id IS NOT NULL
+			GROUP BY parent_id
+		) e
+		WHERE m.id = e.parent_id AND NOT m.id = ANY($1)`,
+		ids,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Ответы удаляем явно, а не каскадом: так они попадут в RETURNING,
+	// и клиенты получат удаление и для них
+	rows, err = tx.Query(
+		ctx,
+		`DELETE FROM messages
+		WHERE id = ANY($1) OR parent_id = ANY($1)
+		RETURNING id, seq, room_id, user_id, created_at, client_msg_id, parent_id, expires_at`,
+		ids,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var expired []models.Message
+	for rows.Next() {
+		var msg models.Message
+		if err := rows.Scan(&msg.ID, &msg.Seq, &msg.RoomID, &msg.SenderID, &msg.CreatedAt, &msg.ClientMsgID, &msg.ParentID, &msg.ExpiresAt); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		expired = append(expired, msg)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, err
+	}
+	return expired, keys, nil
+}
+
+func deleteMessageAttachments(ctx context.Context, tx pgx.Tx, ids []uuid.UUID) ([]string, error) {
+	rows, err := tx.Query(
+		ctx,
+		`DELETE FROM attachments
+		WHERE message_id = ANY($1)
+			OR message_id IN (SELECT id FROM messages WHERE parent_id = ANY($1))
+		RETURNING storage_key`,
+		ids,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// saveMentions сохраняет упоминания msg в транзакции его сохранения.
+// Упоминание записывается только участникам комнаты; в msg.Mentions остаются те, кому оно записано.
+func saveMentions(ctx context.Context, tx pgx.Tx, msg *models.Message) error {
+	if len(msg.Mentions) == 0 {
+		return nil
+	}
+
+	rows, err := tx.Query(
+		ctx,
+		`INSERT INTO message_mentions (message_id, user_id)
+		SELECT $1, ru.user_id FROM room_users ru
+		WHERE ru.room_id = $2 AND ru.user_id = ANY($3)
+		ON CONFLICT DO NOTHING
+		RETURNING user_id`,
+		msg.ID,
+		msg.RoomID,
+		msg.Mentions,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	mentions := msg.Mentions[:0]
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		mentions = append(mentions, id)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	msg.Mentions = mentions
+	return nil
+}
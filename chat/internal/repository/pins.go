@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrTooManyPins — в комнате уже закреплено максимальное число сообщений
+var ErrTooManyPins = errors.New("в комнате закреплено слишком много сообщений")
+
+// PinMessage закрепляет сообщение в комнате, если в ней закреплено меньше limit
+// неудаленных сообщений. Возвращает false, если сообщение уже закреплено, и время закрепления.
+// Повторное закрепление уже закрепленного сообщения лимит не проверяет.
+//
+// Строка комнаты блокируется до конца транзакции, поэтому параллельные закрепления
+// считают закрепленные сообщения по очереди и не превысят лимит.
+func (rr *roomRepo) PinMessage(roomId, messageId, userId uuid.UUID, limit int) (bool, time.Time, error) {
+	var pinnedAt time.Time
+	ctx := context.Background()
+	tx, err := rr.Pool.Begin(ctx)
+	if err != nil {
+		return false, pinnedAt, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "SELECT 1 FROM rooms WHERE id = $1 FOR UPDATE", roomId); err != nil {
+		return false, pinnedAt, err
+	}
+
+	tag, err := tx.Exec(
+		ctx,
+		`INSERT INTO message_pins (message_id, room_id, pinned_by)
+		SELECT id, room_id, $3 FROM messages
+		WHERE id = $1 AND room_id = $2 AND deleted_at IS NULL AND `+notExpired+`
+			AND (
+				SELECT COUNT(*) FROM message_pins p
+				JOIN messages m ON m.id = p.message_id
+				WHERE p.room_id = $2 AND m.deleted_at IS NULL
+			) < $4
+		ON CONFLICT DO NOTHING`,
+		messageId,
+		roomId,
+		userId,
+		limit,
+	)
+	if err != nil {
+		return false, pinnedAt, err
+	}
+	err = tx.QueryRow(
+		ctx,
+		"SELECT pinned_at FROM message_pins WHERE message_id = $1",
+		messageId,
+	).Scan(&pinnedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Сообщение могли удалить после проверки в сервисе
+		var live bool
+		err = tx.QueryRow(
+			ctx,
+			"SELECT EXISTS (SELECT 1 FROM messages WHERE id = $1 AND room_id = $2 AND deleted_at IS NULL)",
+			messageId,
+			roomId,
+		).Scan(&live)
+		if err != nil {
+			return false, pinnedAt, err
+		}
+		if !live {
+			return false, pinnedAt, ErrMessageNotFound
+		}
+		return false, pinnedAt, ErrTooManyPins
+	}
+	if err != nil {
+		return false, pinnedAt, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, pinnedAt, err
+	}
+	return tag.RowsAffected() > 0, pinnedAt, nil
+}
+
+// UnpinMessage открепляет сообщение. Возвращает false, если оно не было закреплено.
+func (rr *roomRepo) UnpinMessage(roomId, messageId uuid.UUID) (bool, error) {
+	tag, err := rr.Pool.Exec(
+		context.Background(),
+		"DELETE FROM message_pins WHERE room_id = $1 AND message_id = $2",
+		roomId,
+		messageId,
+	)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetPins возвращает закрепленные сообщения комнаты, последние закрепленные первыми.
+// Удаленные сообщения не возвращаются.
+func (rr *roomRepo) GetPins(roomId uuid.UUID) ([]models.PinnedMessage, error) {
+	rows, err := rr.Pool.Query(
+		context.Background(),
+		"SELECT "+messageColumns+`, p.pinned_by, p.pinned_at
+		FROM messages
+		JOIN (SELECT message_id, pinned_by, pinned_at FROM message_pins WHERE room_id = $1) p ON p.message_id = messages.id
+		WHERE deleted_at IS NULL AND `+notExpired+`
+		ORDER BY p.pinned_at DESC`,
+		roomId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pins := []models.PinnedMessage{}
+	for rows.Next() {
+		var pin models.PinnedMessage
+		if err := rows.Scan(append(messageFields(&pin.Message), &pin.PinnedBy, &pin.PinnedAt)...); err != nil {
+			return nil, err
+		}
+		pins = append(pins, pin)
+	}
+	return pins, rows.Err()
+}
@@ -0,0 +1,224 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/andro-kes/Chat/chat/internal/database"
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PresenceRepo хранит присутствие пользователей, общее для всех инстансов.
+// Каждый инстанс держит по строке presence_sessions на своего пользователя;
+// строка считается живой, пока ее updated_at моложе ttl.
+type PresenceRepo interface {
+	SetSession(instanceID, userID uuid.UUID, status models.PresenceStatus) error
+	RemoveSession(instanceID, userID uuid.UUID) error
+	TouchSessions(instanceID uuid.UUID) error
+	RemoveStaleSessions(ttl time.Duration) ([]uuid.UUID, error)
+	RemoveInstance(instanceID uuid.UUID) ([]uuid.UUID, error)
+	GetPresence(viewerID uuid.UUID, userIDs []uuid.UUID, ttl time.Duration) ([]models.Presence, error)
+	GetUserRoomIDs(userID uuid.UUID) ([]uuid.UUID, error)
+}
+
+type presenceRepo struct {
+	Pool *pgxpool.Pool
+}
+
+func NewPresenceRepo() *presenceRepo {
+	return &presenceRepo{
+		Pool: database.GetDBPool(),
+	}
+}
+
+// touchLastSeen отмечает, что пользователь сейчас на связи
+const touchLastSeen = `INSERT INTO user_presence (user_id, last_seen_at)
+	VALUES ($1, NOW())
+	ON CONFLICT (user_id) DO UPDATE SET last_seen_at = EXCLUDED.last_seen_at`
+
+// SetSession сохраняет статус пользователя на инстансе и обновляет время последнего визита
+func (pr *presenceRepo) SetSession(instanceID, userID uuid.UUID, status models.PresenceStatus) error {
+	ctx := context.Background()
+	tx, err := pr.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(
+		ctx,
+		`INSERT INTO presence_sessions (instance_id, user_id, status, updated_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (instance_id, user_id) DO UPDATE
+		SET status = EXCLUDED.status, updated_at = EXCLUDED.updated_at`,
+		instanceID,
+		userID,
+		status,
+	)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, touchLastSeen, userID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// RemoveSession удаляет строку пользователя на инстансе, когда закрылось его последнее соединение
+func (pr *presenceRepo) RemoveSession(instanceID, userID uuid.UUID) error {
+	ctx := context.Background()
+	tx, err := pr.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(
+		ctx,
+		"DELETE FROM presence_sessions WHERE instance_id = $1 AND user_id = $2",
+		instanceID,
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, touchLastSeen, userID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// TouchSessions продлевает все строки инстанса и время последнего визита их пользователей
+func (pr *presenceRepo) TouchSessions(instanceID uuid.UUID) error {
+	ctx := context.Background()
+	tx, err := pr.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "UPDATE presence_sessions SET updated_at = NOW() WHERE instance_id = $1", instanceID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		ctx,
+		`INSERT INTO user_presence (user_id, last_seen_at)
+		SELECT user_id, NOW() FROM presence_sessions WHERE instance_id = $1
+		ON CONFLICT (user_id) DO UPDATE SET last_seen_at = EXCLUDED.last_seen_at`,
+		instanceID,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// RemoveStaleSessions удаляет строки, которые не продлевались дольше ttl (инстанс упал),
+// и возвращает затронутых пользователей. Каждую строку возвращает ровно одному вызывающему.
+func (pr *presenceRepo) RemoveStaleSessions(ttl time.Duration) ([]uuid.UUID, error) {
+	return pr.removeSessions(
+		"DELETE FROM presence_sessions WHERE updated_at < NOW() - make_interval(secs => $1) RETURNING user_id",
+		ttl.Seconds(),
+	)
+}
+
+// RemoveInstance удаляет все строки инстанса при его остановке и возвращает их пользователей
+func (pr *presenceRepo) RemoveInstance(instanceID uuid.UUID) ([]uuid.UUID, error) {
+	return pr.removeSessions("DELETE FROM presence_sessions WHERE instance_id = $1 RETURNING user_id", instanceID)
+}
+
+func (pr *presenceRepo) removeSessions(sql string, args ...any) ([]uuid.UUID, error) {
+	rows, err := pr.Pool.Query(context.Background(), sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// У пользователя может быть несколько строк на разных инстансах
+	seen := make(map[uuid.UUID]struct{})
+	var userIDs []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		userIDs = append(userIDs, id)
+	}
+	return userIDs, rows.Err()
+}
+
+// GetPresence сводит присутствие пользователей по живым строкам всех инстансов:
+// online, если хоть одна строка online, away, если строки есть, но все away, иначе offline.
+// Возвращаются только сам viewerID и пользователи, состоящие с ним в общей комнате.
+func (pr *presenceRepo) GetPresence(viewerID uuid.UUID, userIDs []uuid.UUID, ttl time.Duration) ([]models.Presence, error) {
+	rows, err := pr.Pool.Query(
+		context.Background(),
+		`SELECT u.user_id,
+			CASE
+				WHEN bool_or(s.status = 'online') THEN 'online'
+				WHEN count(s.user_id) > 0 THEN 'away'
+				ELSE 'offline'
+			END,
+			p.last_seen_at
+		FROM (SELECT DISTINCT unnest($2::uuid[]) AS user_id) u
+		LEFT JOIN presence_sessions s
+			ON s.user_id = u.user_id AND s.updated_at >= NOW() - make_interval(secs => $3)
+		LEFT JOIN user_presence p ON p.user_id = u.user_id
+		WHERE u.user_id = $1 OR EXISTS (
+			SELECT 1 FROM room_users a
+			JOIN room_users b ON b.room_id = a.room_id
+			JOIN rooms r ON r.id = a.room_id AND r.deleted_at IS NULL
+			WHERE a.user_id = $1 AND b.user_id = u.user_id
+		)
+		GROUP BY u.user_id, p.last_seen_at`,
+		viewerID,
+		userIDs,
+		ttl.Seconds(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	presence := make([]models.Presence, 0, len(userIDs))
+	for rows.Next() {
+		var p models.Presence
+		if err := rows.Scan(&p.UserID, &p.Status, &p.LastSeenAt); err != nil {
+			return nil, err
+		}
+		presence = append(presence, p)
+	}
+	return presence, rows.Err()
+}
+
+// GetUserRoomIDs возвращает активные комнаты пользователя
+func (pr *presenceRepo) GetUserRoomIDs(userID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := pr.Pool.Query(
+		context.Background(),
+		`SELECT ru.room_id FROM room_users ru
+		JOIN rooms r ON r.id = ru.room_id
+		WHERE ru.user_id = $1 AND r.deleted_at IS NULL`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roomIDs []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		roomIDs = append(roomIDs, id)
+	}
+	return roomIDs, rows.Err()
+}
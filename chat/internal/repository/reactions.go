@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/google/uuid"
+)
+
+// AddReaction ставит реакцию пользователя на сообщение.
+// Возвращает false, если такая реакция уже стоит, и текущее число реакций этим эмодзи.
+func (rr *roomRepo) AddReaction(messageId, userId uuid.UUID, emoji string) (bool, int, error) {
+	tag, err := rr.Pool.Exec(
+		context.Background(),
+		`INSERT INTO message_reactions (message_id, user_id, emoji)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING`,
+		messageId,
+		userId,
+		emoji,
+	)
+	if err != nil {
+		return false, 0, err
+	}
+	count, err := rr.countReactions(messageId, emoji)
+	return tag.RowsAffected() > 0, count, err
+}
+
+// RemoveReaction снимает реакцию пользователя с сообщения.
+// Возвращает false, если реакции не было, и текущее число реакций этим эмодзи.
+func (rr *roomRepo) RemoveReaction(messageId, userId uuid.UUID, emoji string) (bool, int, error) {
+	tag, err := rr.Pool.Exec(
+		context.Background(),
+		"DELETE FROM message_reactions WHERE message_id = $1 AND user_id = $2 AND emoji = $3",
+		messageId,
+		userId,
+		emoji,
+	)
+	if err != nil {
+		return false, 0, err
+	}
+	count, err := rr.countReactions(messageId, emoji)
+	return tag.RowsAffected() > 0, count, err
+}
+
+func (rr *roomRepo) countReactions(messageId uuid.UUID, emoji string) (int, error) {
+	var count int
+	err := rr.Pool.QueryRow(
+		context.Background(),
+		"SELECT COUNT(*) FROM message_reactions WHERE message_id = $1 AND emoji = $2",
+		messageId,
+		emoji,
+	).Scan(&count)
+	return count, err
+}
+
+// AttachReactions заполняет Reactions у сообщений одним запросом.
+// Эмодзи идут в порядке появления первой реакции, Reacted отмечает реакции viewerId.
+func (rr *roomRepo) AttachReactions(messages []models.Message, viewerId uuid.UUID) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, len(messages))
+	index := make(map[uuid.UUID]int, len(messages))
+	for i := range messages {
+		ids[i] = messages[i].ID
+		index[messages[i].ID] = i
+	}
+
+	rows, err := rr.Pool.Query(
+		context.Background(),
+		`SELECT message_id, emoji, COUNT(*), BOOL_OR(user_id = $2)
+		FROM message_reactions
+		WHERE message_id = ANY($1)
+		GROUP BY message_id, emoji
+		ORDER BY MIN(created_at)`,
+		ids,
+		viewerId,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			messageId uuid.UUID
+			reaction  models.ReactionCount
+		)
+		if err := rows.Scan(&messageId, &reaction.Emoji, &reaction.Count, &reaction.Reacted); err != nil {
+			return err
+		}
+		msg := &messages[index[messageId]]
+		msg.Reactions = append(msg.Reactions, reaction)
+	}
+	return rows.Err()
+}
@@ -2,18 +2,59 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
 
 	"github.com/andro-kes/Chat/chat/internal/database"
 	"github.com/andro-kes/Chat/chat/internal/models"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type RoomRepo interface {
 	SaveMessage(msg *models.Message) error
-	GetMessages(roomId uuid.UUID) ([]models.Message, error)
+	GetMessagesPage(roomId uuid.UUID, query models.MessageQuery) (*models.MessagePage, error)
+	GetMessagesAfter(roomId uuid.UUID, afterSeq int64, limit int) ([]models.Message, bool, error)
+	GetMessage(roomId, messageId uuid.UUID) (*models.Message, error)
+	EditMessage(roomId, messageId uuid.UUID, content string) (*models.Message, error)
+	GetMessageEdits(roomId, messageId uuid.UUID) ([]models.MessageEdit, error)
+	DeleteMessage(roomId, messageId, actorId uuid.UUID) (*models.Message, error)
+	AddReaction(messageId, userId uuid.UUID, emoji string) (bool, int, error)
+	RemoveReaction(messageId, userId uuid.UUID, emoji string) (bool, int, error)
+	AttachReactions(messages []models.Message, viewerId uuid.UUID) error
+	PinMessage(roomId, messageId, userId uuid.UUID, limit int) (bool, time.Time, error)
+	UnpinMessage(roomId, messageId uuid.UUID) (bool, error)
+	GetPins(roomId uuid.UUID) ([]models.PinnedMessage, error)
+	DeleteExpiredMessages(limit int) ([]models.Message, []string, error)
+	SaveScheduled(sm *models.ScheduledMessage, limit int) error
+	GetScheduled(userId, roomId uuid.UUID) ([]models.ScheduledMessage, error)
+	UpdateScheduled(id, userId uuid.UUID, content *string, sendAt *time.Time) (*models.ScheduledMessage, error)
+	DeleteScheduled(id, userId uuid.UUID) error
+	DispatchScheduled(limit int, send func(sm *models.ScheduledMessage) error) (int, error)
+	SearchMessages(userId uuid.UUID, query models.SearchQuery) (*models.SearchPage, error)
+	SaveAttachment(a *models.Attachment) error
+	DeleteStaleAttachments(age time.Duration, limit int) ([]string, error)
+	GetAttachment(roomId, attachmentId uuid.UUID) (*models.Attachment, error)
+	GetPendingAttachments(roomId, uploaderId, messageId uuid.UUID, ids []uuid.UUID) ([]models.Attachment, error)
+	AttachFiles(messages []models.Message) error
 }
 
+var (
+	// ErrDuplicateMessage — сообщение с таким ключом идемпотентности уже сохранено
+	ErrDuplicateMessage = errors.New("сообщение уже сохранено")
+	ErrMessageNotFound  = errors.New("сообщение не найдено")
+)
+
+// messageColumns — колонки сообщения в порядке, в котором их читает scanMessage.
+// Текст удаленного сообщения не отдается: вместо него возвращается пустая строка.
+const messageColumns = "id, seq, room_id, user_id, CASE WHEN deleted_at IS NULL THEN content ELSE '' END, created_at, client_msg_id, edited_at, deleted_at, deleted_by, parent_id, reply_count, last_reply_at, expires_at"
+
+// notExpired отсекает истекшие сообщения, которые уборщик еще не успел удалить
+const notExpired = "(expires_at IS NULL OR expires_at > NOW())"
+
 type roomRepo struct {
 	Pool *pgxpool.Pool
 }
@@ -24,37 +65,349 @@ func NewRoomRepo() *roomRepo {
 	}
 }
 
-// SaveMessage сохраняет сообщение в базе данных
+// SaveMessage сохраняет сообщение в базе данных и назначает ему следующий номер в комнате.
+// Счетчик rooms.last_seq увеличивается в той же транзакции, что и вставка:
+// строка комнаты блокируется до коммита, поэтому номера выдаются по порядку и без пропусков.
+//
+// Ответ в треде обновляет счетчик ответов и время последнего ответа у корневого сообщения.
+// Вложения из msg.Attachments привязываются к сообщению в той же транзакции.
+// Если у сообщения не задан ExpiresAt, а у комнаты есть срок жизни сообщений,
+// ExpiresAt отсчитывается от CreatedAt.
+//
+// Если сообщение с тем же (room_id, client_msg_id) уже сохранено, транзакция откатывается,
+// msg заполняется сохраненными id, seq и created_at, а функция возвращает ErrDuplicateMessage.
 func (rr *roomRepo) SaveMessage(msg *models.Message) error {
+	ctx := context.Background()
+	tx, err := rr.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var seq, ttl int64
+	err = tx.QueryRow(
+		ctx,
+		"UPDATE rooms SET last_seq = last_seq + 1 WHERE id = $1 RETURNING last_seq, message_ttl",
+		msg.RoomID,
+	).Scan(&seq, &ttl)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrRoomNotFound
+		}
+		return err
+	}
+
+	// Проверяем дубликат уже под блокировкой комнаты, чтобы параллельная вставка не проскочила
+	var existing models.Message
+	err = tx.QueryRow(
+		ctx,
+		"SELECT id, seq, created_at FROM messages WHERE room_id = $1 AND client_msg_id = $2",
+		msg.RoomID,
+		msg.ClientMsgID,
+	).Scan(&existing.ID, &existing.Seq, &existing.CreatedAt)
+	if err == nil {
+		msg.ID, msg.Seq, msg.CreatedAt = existing.ID, existing.Seq, existing.CreatedAt
+		return ErrDuplicateMessage
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	if msg.ExpiresAt == nil && ttl > 0 {
+		expiresAt := msg.CreatedAt.Add(time.Duration(ttl) * time.Second)
+		msg.ExpiresAt = &expiresAt
+	}
+
 	sql := `
-		INSERT INTO messages (id, room_id, user_id, content, created_at)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO messages (id, seq, room_id, user_id, content, created_at, client_msg_id, parent_id, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 	`
-	_, err := rr.Pool.Exec(
-		context.Background(),
+	_, err = tx.Exec(
+		ctx,
 		sql,
 		msg.ID,
+		seq,
 		msg.RoomID,
 		msg.SenderID,
 		msg.Content,
 		msg.CreatedAt,
+		msg.ClientMsgID,
+		msg.ParentID,
+		msg.ExpiresAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := linkAttachments(ctx, tx, msg); err != nil {
+		return err
+	}
+
+	if err := saveMentions(ctx, tx, msg); err != nil {
+		return err
+	}
+
+	if msg.ParentID != nil {
+		_, err = tx.Exec(
+			ctx,
+			"UPDATE messages SET reply_count = reply_count + 1, last_reply_at = $3 WHERE room_id = $1 AND id = $2",
+			msg.RoomID,
+			*msg.ParentID,
+			msg.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	msg.Seq = seq
+	return nil
+}
+
+// GetMessagesPage возвращает страницу ленты комнаты или треда (если задан query.ParentID).
+// Без курсора возвращаются последние сообщения, с Before — более старые, с After — более новые.
+// Внутри страницы сообщения всегда идут от старых к новым.
+func (rr *roomRepo) GetMessagesPage(roomId uuid.UUID, query models.MessageQuery) (*models.MessagePage, error) {
+	var (
+		cursor   messageCursor
+		backward = query.After == ""
+		err      error
+	)
+	switch {
+	case query.Before != "":
+		cursor, err = decodeCursor(query.Before)
+	case query.After != "":
+		cursor, err = decodeCursor(query.After)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Берем на одно сообщение больше лимита, чтобы узнать, есть ли продолжение
+	sql := "SELECT " + messageColumns + " FROM messages WHERE room_id = $1 AND " + notExpired
+	args := []any{roomId}
+	if query.ParentID != uuid.Nil {
+		args = append(args, query.ParentID)
+		sql += " AND parent_id = $2"
+	} else {
+		sql += " AND parent_id IS NULL"
+	}
+	switch {
+	case query.Before != "":
+		args = append(args, cursor.Seq, query.Limit+1)
+		sql += fmt.Sprintf(" AND seq < $%d ORDER BY seq DESC LIMIT $%d", len(args)-1, len(args))
+	case query.After != "":
+		args = append(args, cursor.Seq, query.Limit+1)
+		sql += fmt.Sprintf(" AND seq > $%d ORDER BY seq ASC LIMIT $%d", len(args)-1, len(args))
+	default:
+		args = append(args, query.Limit+1)
+		sql += fmt.Sprintf(" ORDER BY seq DESC LIMIT $%d", len(args))
+	}
+
+	messages, err := rr.queryMessages(sql, query.Limit+1, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	hasMore := len(messages) > query.Limit
+	if hasMore {
+		messages = messages[:query.Limit]
+	}
+	if backward {
+		slices.Reverse(messages)
+	}
+
+	page := &models.MessagePage{Messages: messages}
+	if len(messages) == 0 {
+		return page, nil
+	}
+
+	// В направлении запроса продолжение есть, если нашлось лишнее сообщение,
+	// в обратном — если запрос начинался от курсора
+	olderExist := hasMore
+	newerExist := query.Before != ""
+	if !backward {
+		olderExist, newerExist = true, hasMore
+	}
+	if olderExist {
+		page.PrevCursor = cursorOf(&messages[0]).encode()
+	}
+	if newerExist {
+		page.NextCursor = cursorOf(&messages[len(messages)-1]).encode()
+	}
+	return page, nil
+}
+
+// GetMessagesAfter возвращает до limit сообщений комнаты с seq больше afterSeq в порядке seq.
+// Второе значение сообщает, что после возвращенных есть еще сообщения.
+func (rr *roomRepo) GetMessagesAfter(roomId uuid.UUID, afterSeq int64, limit int) ([]models.Message, bool, error) {
+	messages, err := rr.queryMessages(
+		"SELECT "+messageColumns+" FROM messages WHERE room_id = $1 AND seq > $2 AND "+notExpired+" ORDER BY seq ASC LIMIT $3",
+		limit+1,
+		roomId,
+		afterSeq,
+		limit+1,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+	return messages, hasMore, nil
+}
+
+// GetMessage возвращает сообщение комнаты по id
+func (rr *roomRepo) GetMessage(roomId, messageId uuid.UUID) (*models.Message, error) {
+	messages, err := rr.queryMessages(
+		"SELECT "+messageColumns+" FROM messages WHERE room_id = $1 AND id = $2 AND "+notExpired,
+		1,
+		roomId,
+		messageId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, ErrMessageNotFound
+	}
+	return &messages[0], nil
+}
+
+// EditMessage заменяет текст сообщения и сохраняет прежнюю версию в message_edits.
+// Строка сообщения блокируется, поэтому параллельные правки не теряют версии.
+// Удаленные сообщения не редактируются.
+func (rr *roomRepo) EditMessage(roomId, messageId uuid.UUID, content string) (*models.Message, error) {
+	ctx := context.Background()
+	tx, err := rr.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var prev models.MessageEdit
+	err = tx.QueryRow(
+		ctx,
+		"SELECT id, content, COALESCE(edited_at, created_at) FROM messages WHERE room_id = $1 AND id = $2 AND deleted_at IS NULL FOR UPDATE",
+		roomId,
+		messageId,
+	).Scan(&prev.MessageID, &prev.Content, &prev.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, err
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		"INSERT INTO message_edits (message_id, content, created_at) VALUES ($1, $2, $3)",
+		prev.MessageID,
+		prev.Content,
+		prev.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var msg models.Message
+	err = scanMessage(tx.QueryRow(
+		ctx,
+		"UPDATE messages SET content = $3, edited_at = NOW() WHERE room_id = $1 AND id = $2 RETURNING "+messageColumns,
+		roomId,
+		messageId,
+		content,
+	), &msg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// DeleteMessage помечает сообщение удаленным. Строка остается в таблице, чтобы не ломать
+// нумерацию и ответы на него, но текст больше не отдается.
+func (rr *roomRepo) DeleteMessage(roomId, messageId, actorId uuid.UUID) (*models.Message, error) {
+	ctx := context.Background()
+	tx, err := rr.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var msg models.Message
+	err = scanMessage(tx.QueryRow(
+		ctx,
+		"UPDATE messages SET deleted_at = NOW(), deleted_by = $3 WHERE room_id = $1 AND id = $2 AND deleted_at IS NULL RETURNING "+messageColumns,
+		roomId,
+		messageId,
+		actorId,
+	), &msg)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, err
+	}
+
+	// Удаленное сообщение открепляется, чтобы не занимать место в лимите закреплений
+	if _, err := tx.Exec(ctx, "DELETE FROM message_pins WHERE message_id = $1", messageId); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// GetMessageEdits возвращает прежние версии сообщения от старых к новым
+func (rr *roomRepo) GetMessageEdits(roomId, messageId uuid.UUID) ([]models.MessageEdit, error) {
+	rows, err := rr.Pool.Query(
+		context.Background(),
+		`SELECT e.message_id, e.content, e.created_at, e.replaced_at
+		FROM message_edits e
+		JOIN messages m ON m.id = e.message_id
+		WHERE m.room_id = $1 AND e.message_id = $2 AND m.deleted_at IS NULL
+		ORDER BY e.id`,
+		roomId,
+		messageId,
 	)
-	return err
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	edits := []models.MessageEdit{}
+	for rows.Next() {
+		var e models.MessageEdit
+		if err := rows.Scan(&e.MessageID, &e.Content, &e.CreatedAt, &e.ReplacedAt); err != nil {
+			return nil, err
+		}
+		edits = append(edits, e)
+	}
+	return edits, rows.Err()
 }
 
-// GetMessages возвращает список сообщений комнаты
-func (rr *roomRepo) GetMessages(roomId uuid.UUID) ([]models.Message, error) {
-	sql := "SELECT id, room_id, user_id, content, created_at FROM messages WHERE room_id = $1 ORDER BY created_at ASC"
-	rows, err := rr.Pool.Query(context.Background(), sql, roomId)
+func (rr *roomRepo) queryMessages(sql string, capacity int, args ...any) ([]models.Message, error) {
+	rows, err := rr.Pool.Query(context.Background(), sql, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var messages []models.Message
+	messages := make([]models.Message, 0, capacity)
 	for rows.Next() {
 		var msg models.Message
-		if err := rows.Scan(&msg.ID, &msg.RoomID, &msg.SenderID, &msg.Content, &msg.CreatedAt); err != nil {
+		if err := scanMessage(rows, &msg); err != nil {
 			return nil, err
 		}
 		messages = append(messages, msg)
@@ -63,6 +416,30 @@ func (rr *roomRepo) GetMessages(roomId uuid.UUID) ([]models.Message, error) {
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
-
 	return messages, nil
 }
+
+func scanMessage(row pgx.Row, msg *models.Message) error {
+	return row.Scan(messageFields(msg)...)
+}
+
+// messageFields возвращает приемники для колонок messageColumns, чтобы запросы
+// с дополнительными колонками могли сканировать сообщение вместе с ними
+func messageFields(msg *models.Message) []any {
+	return []any{
+		&msg.ID,
+		&msg.Seq,
+		&msg.RoomID,
+		&msg.SenderID,
+		&msg.Content,
+		&msg.CreatedAt,
+		&msg.ClientMsgID,
+		&msg.EditedAt,
+		&msg.DeletedAt,
+		&msg.DeletedBy,
+		&msg.ParentID,
+		&msg.ReplyCount,
+		&msg.LastReplyAt,
+		&msg.ExpiresAt,
+	}
+}
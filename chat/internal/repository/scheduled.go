@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrScheduledNotFound = errors.New("отложенное сообщение не найдено")
+	// ErrTooManyScheduled — у автора уже максимальное число отложенных сообщений в комнате
+	ErrTooManyScheduled = errors.New("слишком много отложенных сообщений")
+)
+
+// scheduledColumns — колонки отложенного сообщения в порядке scheduledFields
+const scheduledColumns = "id, room_id, user_id, content, parent_id, ttl, send_at, created_at, updated_at"
+
+func scheduledFields(sm *models.ScheduledMessage) []any {
+	return []any{
+		&sm.ID,
+		&sm.RoomID,
+		&sm.SenderID,
+		&sm.Content,
+		&sm.ParentID,
+		&sm.TTL,
+		&sm.SendAt,
+		&sm.CreatedAt,
+		&sm.UpdatedAt,
+	}
+}
+
+// SaveScheduled сохраняет отложенное сообщение, если у автора в комнате их меньше limit
+func (rr *roomRepo) SaveScheduled(sm *models.ScheduledMessage, limit int) error {
+	err := rr.Pool.QueryRow(
+		context.Background(),
+		`INSERT INTO scheduled_messages (id, room_id, user_id, content, parent_id, ttl, send_at)
+		SELECT $1, $2, $3, $4, $5, $6, $7
+		WHERE (SELECT COUNT(*) FROM scheduled_messages WHERE room_id = $2 AND user_id = $3) < $8
+		RETURNING created_at`,
+		sm.ID,
+		sm.RoomID,
+		sm.SenderID,
+		sm.Content,
+		sm.ParentID,
+		sm.TTL,
+		sm.SendAt,
+		limit,
+	).Scan(&sm.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrTooManyScheduled
+	}
+	return err
+}
+
+// GetScheduled возвращает неотправленные сообщения автора в порядке отправки.
+// Нулевой roomId — во всех комнатах.
+func (rr *roomRepo) GetScheduled(userId, roomId uuid.UUID) ([]models.ScheduledMessage, error) {
+	sql := "SELECT " + scheduledColumns + " FROM scheduled_messages WHERE user_id = $1"
+	args := []any{userId}
+	if roomId != uuid.Nil {
+		args = append(args, roomId)
+		sql += " AND room_id = $2"
+	}
+	sql += " ORDER BY send_at, id"
+
+	rows, err := rr.Pool.Query(context.Background(), sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scheduled := []models.ScheduledMessage{}
+	for rows.Next() {
+		var sm models.ScheduledMessage
+		if err := rows.Scan(scheduledFields(&sm)...); err != nil {
+			return nil, err
+		}
+		scheduled = append(scheduled, sm)
+	}
+	return scheduled, rows.Err()
+}
+
+// UpdateScheduled меняет текст и/или время отправки неотправленного сообщения автора.
+// nil-поля не меняются. Если планировщик уже забрал сообщение, возвращает ErrScheduledNotFound.
+func (rr *roomRepo) UpdateScheduled(id, userId uuid.UUID, content *string, sendAt *time.Time) (*models.ScheduledMessage, error) {
+	var sm models.ScheduledMessage
+	err := rr.Pool.QueryRow(
+		context.Background(),
+		`UPDATE scheduled_messages
+		SET content = COALESCE($3, content), send_at = COALESCE($4, send_at), updated_at = NOW()
+		WHERE id = $1 AND user_id = $2
+		RETURNING `+scheduledColumns,
+		id,
+		userId,
+		content,
+		sendAt,
+	).Scan(scheduledFields(&sm)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrScheduledNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sm, nil
+}
+
+// DeleteScheduled отменяет неотправленное сообщение автора
+func (rr *roomRepo) DeleteScheduled(id, userId uuid.UUID) error {
+	tag, err := rr.Pool.Exec(
+		context.Background(),
+		"DELETE FROM scheduled_messages WHERE id = $1 AND user_id = $2",
+		id,
+		userId,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrScheduledNotFound
+	}
+	return nil
+}
+
+// DispatchScheduled забирает до limit сообщений, время отправки которых наступило, и передает
+// каждое в send. Сообщения, для которых send вернул nil, удаляются; остальные остаются
+// до следующего вызова. Возвращает число удаленных сообщений.
+//
+// Строки блокируются с SKIP LOCKED до конца транзакции, поэтому несколько инстансов
+// не отправят одно сообщение дважды, а правка или отмена ждет, пока сообщение не будет
+// отправлено, и тогда уже не находит его. Если коммит не удался после публикации,
+// сообщение уйдет повторно с тем же ключом идемпотентности и не будет сохранено дважды.
+func (rr *roomRepo) DispatchScheduled(limit int, send func(sm *models.ScheduledMessage) error) (int, error) {
+	ctx := context.Background()
+	tx, err := rr.Pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(
+		ctx,
+		"SELECT "+scheduledColumns+` FROM scheduled_messages
+		WHERE send_at <= NOW()
+		ORDER BY send_at, id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED`,
+		limit,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	var due []models.ScheduledMessage
+	for rows.Next() {
+		var sm models.ScheduledMessage
+		if err := rows.Scan(scheduledFields(&sm)...); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, sm)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var done []uuid.UUID
+	for i := range due {
+		if err := send(&due[i]); err != nil {
+			continue
+		}
+		done = append(done, due[i].ID)
+	}
+	if len(done) == 0 {
+		return 0, nil
+	}
+
+	if _, err := tx.Exec(ctx, "DELETE FROM scheduled_messages WHERE id = ANY($1)", done); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return len(done), nil
+}
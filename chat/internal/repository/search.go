@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/google/uuid"
+)
+
+// Границы совпадений во фрагменте. Управляющие символы не встречаются в обычном тексте,
+// поэтому после экранирования фрагмента их можно безопасно заменить на <mark>.
+const (
+	highlightStart = "\x01"
+	highlightStop  = "\x02"
+)
+
+var headlineOptions = fmt.Sprintf(
+	`StartSel="%s", StopSel="%s", MaxWords=30, MinWords=10, MaxFragments=2, FragmentDelimiter=" … "`,
+	highlightStart,
+	highlightStop,
+)
+
+// SearchMessages ищет неудаленные сообщения по тексту в комнатах, где состоит userId.
+// Запрос разбирается websearch_to_tsquery: поддерживаются "фразы", OR и -исключения.
+// Результаты упорядочены от новых к старым.
+func (rr *roomRepo) SearchMessages(userId uuid.UUID, query models.SearchQuery) (*models.SearchPage, error) {
+	sql := "SELECT " + messageColumns + `, ts_headline('russian', content, websearch_to_tsquery('russian', $2), $3)
+		FROM messages
+		WHERE search_vector @@ websearch_to_tsquery('russian', $2)
+			AND deleted_at IS NULL
+			AND ` + notExpired + `
+			AND room_id IN (
+				SELECT ru.room_id FROM room_users ru
+				JOIN rooms r ON r.id = ru.room_id
+				WHERE ru.user_id = $1 AND r.deleted_at IS NULL
+			)`
+	args := []any{userId, query.Text, headlineOptions}
+
+	if query.RoomID != uuid.Nil {
+		args = append(args, query.RoomID)
+		sql += fmt.Sprintf(" AND room_id = $%d", len(args))
+	}
+	if query.SenderID != uuid.Nil {
+		args = append(args, query.SenderID)
+		sql += fmt.Sprintf(" AND user_id = $%d", len(args))
+	}
+	if !query.From.IsZero() {
+		args = append(args, query.From)
+		sql += fmt.Sprintf(" AND created_at >= $%d", len(args))
+	}
+	if !query.To.IsZero() {
+		args = append(args, query.To)
+		sql += fmt.Sprintf(" AND created_at < $%d", len(args))
+	}
+	if query.Cursor != "" {
+		cursor, err := decodeSearchCursor(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, cursor.CreatedAt, cursor.ID)
+		sql += fmt.Sprintf(" AND (created_at, id) < ($%d, $%d)", len(args)-1, len(args))
+	}
+
+	// Берем на один результат больше лимита, чтобы узнать, есть ли продолжение
+	args = append(args, query.Limit+1)
+	sql += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d", len(args))
+
+	rows, err := rr.Pool.Query(context.Background(), sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]models.SearchResult, 0, query.Limit+1)
+	for rows.Next() {
+		var res models.SearchResult
+		if err := rows.Scan(append(messageFields(&res.Message), &res.Snippet)...); err != nil {
+			return nil, err
+		}
+		res.Snippet = highlight(res.Snippet)
+		results = append(results, res)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	page := &models.SearchPage{Results: results}
+	if len(results) > query.Limit {
+		page.Results = results[:query.Limit]
+		page.NextCursor = searchCursorOf(&page.Results[query.Limit-1].Message).encode()
+	}
+	return page, nil
+}
+
+// highlight экранирует фрагмент для HTML и заменяет границы совпадений на <mark>
+func highlight(snippet string) string {
+	return strings.NewReplacer(
+		highlightStart, "<mark>",
+		highlightStop, "</mark>",
+	).Replace(html.EscapeString(snippet))
+}
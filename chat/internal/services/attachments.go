@@ -0,0 +1,215 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/andro-kes/Chat/chat/internal/repository"
+	"github.com/andro-kes/Chat/chat/logger"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultMaxAttachmentSize — максимальный размер вложения, если не задан MAX_ATTACHMENT_SIZE
+	DefaultMaxAttachmentSize = 10 << 20
+	// MaxMessageAttachments — сколько вложений можно приложить к одному сообщению
+	MaxMessageAttachments = 10
+	// maxAttachmentName — максимальная длина имени файла в байтах
+	maxAttachmentName = 255
+	// PendingAttachmentTTL — сколько живет вложение, которое не приложили к сообщению
+	PendingAttachmentTTL = 24 * time.Hour
+)
+
+var (
+	ErrAttachmentNotFound = repository.ErrAttachmentNotFound
+	ErrAttachmentTooLarge = errors.New("вложение слишком большое")
+	ErrAttachmentType     = errors.New("недопустимый тип вложения")
+	ErrInvalidAttachment  = errors.New("невалидное вложение")
+)
+
+// allowedMimeTypes — типы файлов, которые можно загрузить. Тип определяется
+// по содержимому (http.DetectContentType), а не по имени или заголовкам клиента.
+var allowedMimeTypes = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+	"application/zip": true,
+	"text/plain":      true,
+	"audio/mpeg":      true,
+	"audio/wave":      true,
+	"video/mp4":       true,
+	"video/webm":      true,
+}
+
+// UploadAttachment сохраняет файл в хранилище и его метаданные в БД.
+// Загружать могут участники с правом писать в комнату. Вложение остается
+// непривязанным, пока его id не придет в сообщении того же пользователя.
+func (cs *chatService) UploadAttachment(roomID, userID uuid.UUID, name string, r io.Reader) (*models.Attachment, error) {
+	if err := cs.Authorize(roomID, userID, PermPost); err != nil {
+		return nil, err
+	}
+
+	// Тип определяем по первым 512 байтам, затем возвращаем их в поток
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	head = head[:n]
+	if n == 0 {
+		return nil, ErrInvalidAttachment
+	}
+	mimeType := http.DetectContentType(head)
+	if mediaType, _, err := mime.ParseMediaType(mimeType); err != nil || !allowedMimeTypes[mediaType] {
+		return nil, ErrAttachmentType
+	}
+
+	a := &models.Attachment{
+		ID:         uuid.New(),
+		RoomID:     roomID,
+		UploaderID: userID,
+		Name:       attachmentName(name),
+		MimeType:   mimeType,
+	}
+	a.StorageKey = "attachments/" + roomID.String() + "/" + a.ID.String()
+
+	// Считаем размер и контрольную сумму на лету; лишний байт сверх лимита означает превышение
+	hash := sha256.New()
+	counter := &countingWriter{}
+	body := io.TeeReader(
+		io.LimitReader(io.MultiReader(bytes.NewReader(head), r), cs.AttachmentSizeLimit+1),
+		io.MultiWriter(hash, counter),
+	)
+
+	ctx := context.Background()
+	if err := cs.Storage.Put(ctx, a.StorageKey, body); err != nil {
+		return nil, err
+	}
+	if counter.n > cs.AttachmentSizeLimit {
+		cs.deleteBlob(a.StorageKey)
+		return nil, ErrAttachmentTooLarge
+	}
+	a.Size = counter.n
+	a.Checksum = hex.EncodeToString(hash.Sum(nil))
+
+	if err := cs.MessageRepo.SaveAttachment(a); err != nil {
+		cs.deleteBlob(a.StorageKey)
+		return nil, err
+	}
+	return a, nil
+}
+
+// ReapStaleAttachments удаляет до limit вложений, не приложенных к сообщению
+// за PendingAttachmentTTL, вместе с файлами. Возвращает число удаленных.
+func (cs *chatService) ReapStaleAttachments(limit int) (int, error) {
+	keys, err := cs.MessageRepo.DeleteStaleAttachments(PendingAttachmentTTL, limit)
+	if err != nil {
+		return 0, err
+	}
+	for _, key := range keys {
+		cs.deleteBlob(key)
+	}
+	return len(keys), nil
+}
+
+// MaxAttachmentSize возвращает лимит размера вложения в байтах
+func (cs *chatService) MaxAttachmentSize() int64 {
+	return cs.AttachmentSizeLimit
+}
+
+// OpenAttachment отдает участнику комнаты вложение и его содержимое. Непривязанное
+// к сообщению вложение видит только загрузивший его пользователь.
+func (cs *chatService) OpenAttachment(roomID, attachmentID, userID uuid.UUID) (*models.Attachment, io.ReadCloser, error) {
+	if err := cs.CheckAccess(roomID, userID); err != nil {
+		return nil, nil, err
+	}
+
+	a, err := cs.MessageRepo.GetAttachment(roomID, attachmentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if a.MessageID == nil && a.UploaderID != userID {
+		return nil, nil, ErrAttachmentNotFound
+	}
+
+	body, err := cs.Storage.Open(context.Background(), a.StorageKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return a, body, nil
+}
+
+// ResolveAttachments проверяет, что вложения для сообщения messageID загружены этим
+// пользователем в эту комнату и еще не приложены к другому сообщению.
+func (cs *chatService) ResolveAttachments(roomID, userID, messageID uuid.UUID, ids []uuid.UUID) ([]models.Attachment, error) {
+	if len(ids) > MaxMessageAttachments {
+		return nil, ErrInvalidAttachment
+	}
+
+	seen := make(map[uuid.UUID]struct{}, len(ids))
+	unique := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := seen[id]; !ok {
+			seen[id] = struct{}{}
+			unique = append(unique, id)
+		}
+	}
+
+	attachments, err := cs.MessageRepo.GetPendingAttachments(roomID, userID, messageID, unique)
+	if err != nil {
+		return nil, err
+	}
+	if len(attachments) != len(unique) {
+		return nil, ErrInvalidAttachment
+	}
+	return attachments, nil
+}
+
+func (cs *chatService) deleteBlob(key string) {
+	if err := cs.Storage.Delete(context.Background(), key); err != nil {
+		logger.Log.Warn("Не удалось удалить вложение из хранилища", zap.String("key", key), zap.Error(err))
+	}
+}
+
+// attachmentName оставляет от имени файла только базовое имя допустимой длины
+func attachmentName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, strings.ToValidUTF8(name, ""))
+	name = strings.TrimSpace(filepath.Base(strings.ReplaceAll(name, "\\", "/")))
+	if name == "" || name == "." || name == "/" {
+		return "file"
+	}
+	for len(name) > maxAttachmentName {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return name
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+// attachmentFixture — комната с загружающим пользователем и другим участником
+type attachmentFixture struct {
+	cs       *chatService
+	messages *fakeRoomRepo
+	storage  *fakeStorage
+	roomID   uuid.UUID
+	uploader uuid.UUID
+	member   uuid.UUID
+}
+
+func newAttachmentFixture() attachmentFixture {
+	chats := newFakeChatRepo()
+	f := attachmentFixture{
+		messages: &fakeRoomRepo{},
+		storage:  newFakeStorage(),
+		roomID:   uuid.New(),
+		uploader: uuid.New(),
+		member:   uuid.New(),
+	}
+	f.cs = &chatService{Repo: chats, MessageRepo: f.messages, Storage: f.storage, AttachmentSizeLimit: 64}
+	chats.addMember(f.roomID, f.uploader, models.RoleMember)
+	chats.addMember(f.roomID, f.member, models.RoleMember)
+	return f
+}
+
+func (f attachmentFixture) upload(t *testing.T, name string, body []byte) *models.Attachment {
+	t.Helper()
+	a, err := f.cs.UploadAttachment(f.roomID, f.uploader, name, bytes.NewReader(body))
+	require.NoError(t, err)
+	return a
+}
+
+func TestUploadAttachment(t *testing.T) {
+	f := newAttachmentFixture()
+	body := append(append([]byte(nil), pngHeader...), "data"...)
+
+	a := f.upload(t, "../photo.png", body)
+
+	sum := sha256.Sum256(body)
+	assert.Equal(t, "photo.png", a.Name)
+	assert.Equal(t, "image/png", a.MimeType)
+	assert.Equal(t, int64(len(body)), a.Size)
+	assert.Equal(t, hex.EncodeToString(sum[:]), a.Checksum)
+	assert.Nil(t, a.MessageID)
+	assert.True(t, f.storage.has(a.StorageKey))
+
+	_, err := f.messages.GetAttachment(f.roomID, a.ID)
+	assert.NoError(t, err)
+}
+
+func TestUploadAttachmentRejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		userID  func(f attachmentFixture) uuid.UUID
+		body    []byte
+		wantErr error
+	}{
+		{"не участник", func(attachmentFixture) uuid.UUID { return uuid.New() }, pngHeader, ErrAccessDenied},
+		{"пустой файл", nil, nil, ErrInvalidAttachment},
+		{"html запрещен", nil, []byte("<!DOCTYPE html><html></html>"), ErrAttachmentType},
+		{"исполняемый файл запрещен", nil, []byte("\x7fELF\x02\x01\x01\x00"), ErrAttachmentType},
+		{"больше лимита", nil, append(append([]byte(nil), pngHeader...), make([]byte, 64)...), ErrAttachmentTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newAttachmentFixture()
+			userID := f.uploader
+			if tt.userID != nil {
+				userID = tt.userID(f)
+			}
+
+			_, err := f.cs.UploadAttachment(f.roomID, userID, "file", bytes.NewReader(tt.body))
+
+			assert.ErrorIs(t, err, tt.wantErr)
+			// Ни метаданных, ни содержимого не остается
+			assert.Empty(t, f.messages.attachments)
+			assert.Empty(t, f.storage.objects)
+		})
+	}
+}
+
+func TestOpenAttachmentHidesPendingUploads(t *testing.T) {
+	f := newAttachmentFixture()
+	body := append(append([]byte(nil), pngHeader...), "data"...)
+	a := f.upload(t, "photo.png", body)
+
+	// Пока вложение не приложено к сообщению, его видит только загрузивший
+	_, rc, err := f.cs.OpenAttachment(f.roomID, a.ID, f.uploader)
+	require.NoError(t, err)
+	got, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, body, got)
+
+	_, _, err = f.cs.OpenAttachment(f.roomID, a.ID, f.member)
+	assert.ErrorIs(t, err, ErrAttachmentNotFound)
+
+	messageID := uuid.New()
+	f.messages.attachments[a.ID].MessageID = &messageID
+	_, _, err = f.cs.OpenAttachment(f.roomID, a.ID, f.member)
+	assert.NoError(t, err)
+
+	_, _, err = f.cs.OpenAttachment(f.roomID, a.ID, uuid.New())
+	assert.ErrorIs(t, err, ErrAccessDenied)
+	_, _, err = f.cs.OpenAttachment(uuid.New(), a.ID, f.uploader)
+	assert.ErrorIs(t, err, ErrAccessDenied)
+}
+
+func TestResolveAttachments(t *testing.T) {
+	f := newAttachmentFixture()
+	a := f.upload(t, "a.png", pngHeader)
+	b := f.upload(t, "b.png", pngHeader)
+	messageID := uuid.New()
+
+	// Повторы id схлопываются
+	got, err := f.cs.ResolveAttachments(f.roomID, f.uploader, messageID, []uuid.UUID{a.ID, b.ID, a.ID})
+	require.NoError(t, err)
+	assert.Len(t, got, 2)
+
+	// Чужое вложение приложить нельзя
+	_, err = f.cs.ResolveAttachments(f.roomID, f.member, messageID, []uuid.UUID{a.ID})
+	assert.ErrorIs(t, err, ErrInvalidAttachment)
+
+	// Вложение, уже приложенное к другому сообщению, тоже
+	other := uuid.New()
+	f.messages.attachments[b.ID].MessageID = &other
+	_, err = f.cs.ResolveAttachments(f.roomID, f.uploader, messageID, []uuid.UUID{b.ID})
+	assert.ErrorIs(t, err, ErrInvalidAttachment)
+
+	tooMany := make([]uuid.UUID, MaxMessageAttachments+1)
+	for i := range tooMany {
+		tooMany[i] = uuid.New()
+	}
+	_, err = f.cs.ResolveAttachments(f.roomID, f.uploader, messageID, tooMany)
+	assert.ErrorIs(t, err, ErrInvalidAttachment)
+}
+
+func TestAttachmentName(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"обычное имя", "report.pdf", "report.pdf"},
+		{"путь unix", "../../etc/passwd", "passwd"},
+		{"путь windows", `C:\Users\me\photo.png`, "photo.png"},
+		{"управляющие символы", "a\x00b\nc.txt", "abc.txt"},
+		{"пустое имя", "", "file"},
+		{"только пробелы", "   ", "file"},
+		{"точка", ".", "file"},
+		{"слэш", "/", "file"},
+		{"невалидный utf-8", "fo\xffo.txt", "foo.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, attachmentName(tt.in))
+		})
+	}
+}
+
+func TestAttachmentNameTruncatesByRunes(t *testing.T) {
+	name := attachmentName(strings.Repeat("я", maxAttachmentName))
+	assert.LessOrEqual(t, len(name), maxAttachmentName)
+	assert.Equal(t, strings.Repeat("я", maxAttachmentName/2), name)
+}
@@ -2,34 +2,168 @@ package services
 
 import (
 	"errors"
+	"io"
+	"os"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/andro-kes/Chat/chat/internal/protocol"
 	"github.com/andro-kes/Chat/chat/internal/repository"
+	"github.com/andro-kes/Chat/chat/internal/storage"
+	"github.com/andro-kes/Chat/chat/logger"
 	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrAccessDenied      = errors.New("нет доступа к комнате")
+	ErrAlreadyMember     = errors.New("пользователь уже состоит в комнате")
+	ErrOwnerMustStay     = errors.New("владелец не может покинуть комнату, не передав владение")
+	ErrInvalidRole       = errors.New("недопустимая роль")
+	ErrInvalidCursor     = repository.ErrInvalidCursor
+	ErrRoomExists        = repository.ErrRoomExists
+	ErrRoomNotFound      = repository.ErrRoomNotFound
+	ErrMemberNotFound    = repository.ErrMemberNotFound
+	ErrDuplicateMessage  = repository.ErrDuplicateMessage
+	ErrMessageNotFound   = repository.ErrMessageNotFound
+	ErrNotAuthor         = errors.New("изменить сообщение может только его автор")
+	ErrEditWindowExpired = errors.New("время на редактирование сообщения истекло")
+	ErrInvalidParent     = errors.New("ответить можно только на корневое сообщение комнаты")
+	ErrInvalidEmoji      = errors.New("недопустимая реакция")
+	ErrInvalidSearch     = errors.New("невалидный поисковый запрос")
+	ErrDirectRoom        = errors.New("действие недоступно в личной переписке")
+	ErrInvalidPeer       = errors.New("нельзя начать переписку с самим собой")
+	ErrUserNotFound      = errors.New("пользователь не найден")
+	ErrTooManyPins       = repository.ErrTooManyPins
 )
 
 type ChatService interface {
 	AddRoom(room RoomService) error
-	DeleteRoom(roomID uuid.UUID) error
+	DeactivateRoom(roomID uuid.UUID) error
 	IsActive(roomId uuid.UUID) bool
 	GetCurrentRoom(id uuid.UUID) (*models.Room, error)
-	CheckAccess(userId uuid.UUID) bool
-	CreateRoom(name string, adminID uuid.UUID) error
+	CheckAccess(roomID, userID uuid.UUID) error
+	CreateRoom(name string, adminID uuid.UUID) (*models.Room, error)
 	GetRoom(roomId uuid.UUID) (RoomService, error)
-	GetUserRooms(userId uuid.UUID) ([]models.Room, error)
+	GetUserRooms(userId uuid.UUID) (*models.RoomList, error)
+	OpenDirectRoom(userID, peerID uuid.UUID) (*models.Room, error)
+	SaveMessage(msg *models.Message) error
+	GetMessages(roomID, userID uuid.UUID, query models.MessageQuery) (*models.MessagePage, error)
+	GetMissedMessages(roomID, userID uuid.UUID, lastSeq int64, limit int) ([]models.Message, bool, error)
+	ConnectClient(roomID uuid.UUID, client *Client) (RoomService, error)
+	DisconnectClient(roomID uuid.UUID, client *Client)
+	AddMember(roomID, actorID, userID uuid.UUID) error
+	RemoveMember(roomID, actorID, userID uuid.UUID) error
+	LeaveRoom(roomID, userID uuid.UUID) error
+	GetMembers(roomID, actorID uuid.UUID) ([]models.RoomMember, error)
+	Authorize(roomID, userID uuid.UUID, perm Permission) error
+	SetMemberRole(roomID, actorID, userID uuid.UUID, role models.Role) error
+	TransferOwnership(roomID, actorID, newOwnerID uuid.UUID) error
+	RenameRoom(roomID, actorID uuid.UUID, name string) error
+	SetMessageTTL(roomID, actorID uuid.UUID, ttl int64) error
+	DeleteRoom(roomID, actorID uuid.UUID) error
+	EditMessage(roomID, messageID, userID uuid.UUID, content string) (*models.Message, error)
+	GetMessageEdits(roomID, messageID, userID uuid.UUID) ([]models.MessageEdit, error)
+	DeleteMessage(roomID, messageID, actorID uuid.UUID) (*models.Message, error)
+	CheckReplyParent(roomID, parentID uuid.UUID) error
+	GetThread(roomID, parentID, userID uuid.UUID, query models.MessageQuery) (*models.Message, *models.MessagePage, error)
+	AddReaction(roomID, messageID, userID uuid.UUID, emoji string) (bool, int, error)
+	RemoveReaction(roomID, messageID, userID uuid.UUID, emoji string) (bool, int, error)
+	PinMessage(roomID, messageID, actorID uuid.UUID) (bool, time.Time, error)
+	UnpinMessage(roomID, messageID, actorID uuid.UUID) (bool, error)
+	GetPins(roomID, userID uuid.UUID) ([]models.PinnedMessage, error)
+	ReapExpiredMessages(limit int) ([]models.Message, error)
+	ReapStaleAttachments(limit int) (int, error)
+	ScheduleMessage(sm *models.ScheduledMessage) error
+	GetScheduled(userID, roomID uuid.UUID) ([]models.ScheduledMessage, error)
+	EditScheduled(id, userID uuid.UUID, content *string, sendAt *time.Time) (*models.ScheduledMessage, error)
+	CancelScheduled(id, userID uuid.UUID) error
+	DispatchScheduled(limit int, publish func(msg models.Message) error) (int, error)
+	MarkRead(roomID, userID uuid.UUID, seq int64) (int64, bool, error)
+	SearchMessages(userID uuid.UUID, query models.SearchQuery) (*models.SearchPage, error)
+	UploadAttachment(roomID, userID uuid.UUID, name string, r io.Reader) (*models.Attachment, error)
+	OpenAttachment(roomID, attachmentID, userID uuid.UUID) (*models.Attachment, io.ReadCloser, error)
+	ResolveAttachments(roomID, userID, messageID uuid.UUID, ids []uuid.UUID) ([]models.Attachment, error)
+	MaxAttachmentSize() int64
+	SendToUser(userID uuid.UUID, frame protocol.Frame)
+	SetObserver(observer RoomObserver)
+}
+
+// RoomObserver получает уведомления о появлении и исчезновении активных комнат
+// и подключенных пользователей на текущем инстансе. Используется для привязки
+// очереди инстанса к комнатам и к адресным событиям пользователей.
+type RoomObserver interface {
+	RoomActivated(roomID uuid.UUID)
+	RoomDeactivated(roomID uuid.UUID)
+	UserConnected(userID uuid.UUID)
+	UserDisconnected(userID uuid.UUID)
 }
 
 type chatService struct {
 	Repo repository.ChatRepo
+	MessageRepo repository.RoomRepo
 	ActiveRooms map[uuid.UUID]RoomService
+	// ActiveUsers — соединения пользователей на инстансе во всех комнатах, для адресных событий
+	ActiveUsers map[uuid.UUID]map[*Client]struct{}
+	Observer RoomObserver
+	// EditWindow — сколько после отправки автор может редактировать сообщение, 0 — без ограничения
+	EditWindow time.Duration
+	// Storage — хранилище содержимого вложений, AttachmentSizeLimit — лимит размера файла в байтах
+	Storage storage.Storage
+	AttachmentSizeLimit int64
+	// Users — имена пользователей из сервиса авторизации
+	Users UserDirectory
 	Mu sync.Mutex 
 }
 
 func NewChatService() *chatService {
-	return &chatService{
+	cs := &chatService{
 		Repo:        repository.NewChatRepo(),
+		MessageRepo: repository.NewRoomRepo(),
 		ActiveRooms: make(map[uuid.UUID]RoomService),
+		ActiveUsers: make(map[uuid.UUID]map[*Client]struct{}),
+		Users:       authDirectory{},
+	}
+
+	// Окно редактирования можно задать в ENV: MESSAGE_EDIT_WINDOW, например 15m
+	if v := os.Getenv("MESSAGE_EDIT_WINDOW"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			cs.EditWindow = d
+		}
+	}
+
+	// Лимит размера вложения в байтах можно задать в ENV: MAX_ATTACHMENT_SIZE
+	cs.AttachmentSizeLimit = DefaultMaxAttachmentSize
+	if v := os.Getenv("MAX_ATTACHMENT_SIZE"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+			cs.AttachmentSizeLimit = n
+		}
+	}
+
+	st, err := storage.New()
+	if err != nil {
+		logger.Log.Fatal("Не удалось инициализировать хранилище вложений", zap.Error(err))
+	}
+	cs.Storage = st
+	return cs
+}
+
+// SetObserver устанавливает наблюдателя за активными комнатами
+// и уведомляет его о комнатах, которые уже активны
+func (cs *chatService) SetObserver(observer RoomObserver) {
+	cs.Mu.Lock()
+	defer cs.Mu.Unlock()
+	cs.Observer = observer
+	if observer == nil {
+		return
+	}
+	for id := range cs.ActiveRooms {
+		observer.RoomActivated(id)
+	}
+	for id := range cs.ActiveUsers {
+		observer.UserConnected(id)
 	}
 }
 
@@ -40,21 +174,193 @@ func (cs *chatService) AddRoom(room RoomService) error {
 	}
 	cs.Mu.Lock()
 	defer cs.Mu.Unlock()
-	cs.ActiveRooms[room.GetId()] = room
+	cs.activate(room)
 	return nil
 }
 
-// DeleteRoom удаляет комнату из активных
-func (cs *chatService) DeleteRoom(roomID uuid.UUID) error {
+// DeactivateRoom удаляет комнату из активных
+func (cs *chatService) DeactivateRoom(roomID uuid.UUID) error {
 	cs.Mu.Lock()
 	defer cs.Mu.Unlock()
 	if _, exists := cs.ActiveRooms[roomID]; !exists {
 		return errors.New("комната не найдена")
 	}
-	delete(cs.ActiveRooms, roomID)
+	cs.deactivate(roomID)
+	return nil
+}
+
+// ConnectClient регистрирует соединение пользователя в комнате, при необходимости активируя её.
+// Поиск комнаты и добавление пользователя выполняются под одной блокировкой,
+// чтобы комната не была деактивирована между этими шагами.
+func (cs *chatService) ConnectClient(roomID uuid.UUID, client *Client) (RoomService, error) {
+	cs.Mu.Lock()
+	defer cs.Mu.Unlock()
+
+	room, ok := cs.ActiveRooms[roomID]
+	if !ok {
+		room = NewRoomService(roomID)
+		cs.activate(room)
+	}
+	if err := room.AddUser(client); err != nil {
+		return nil, err
+	}
+
+	conns, ok := cs.ActiveUsers[client.UserID]
+	if !ok {
+		conns = make(map[*Client]struct{})
+		cs.ActiveUsers[client.UserID] = conns
+		if cs.Observer != nil {
+			cs.Observer.UserConnected(client.UserID)
+		}
+	}
+	conns[client] = struct{}{}
+	return room, nil
+}
+
+// DisconnectClient удаляет соединение из комнаты и деактивирует комнату,
+// если в ней не осталось подключений
+func (cs *chatService) DisconnectClient(roomID uuid.UUID, client *Client) {
+	cs.Mu.Lock()
+	defer cs.Mu.Unlock()
+
+	if conns, ok := cs.ActiveUsers[client.UserID]; ok {
+		delete(conns, client)
+		if len(conns) == 0 {
+			delete(cs.ActiveUsers, client.UserID)
+			if cs.Observer != nil {
+				cs.Observer.UserDisconnected(client.UserID)
+			}
+		}
+	}
+
+	room, ok := cs.ActiveRooms[roomID]
+	if !ok {
+		return
+	}
+	if !room.RemoveUser(client) {
+		cs.deactivate(roomID)
+	}
+}
+
+// SendToUser отправляет фрейм во все соединения пользователя на текущем инстансе,
+// в какой бы комнате они ни были открыты
+func (cs *chatService) SendToUser(userID uuid.UUID, frame protocol.Frame) {
+	cs.Mu.Lock()
+	clients := make([]*Client, 0, len(cs.ActiveUsers[userID]))
+	for c := range cs.ActiveUsers[userID] {
+		clients = append(clients, c)
+	}
+	cs.Mu.Unlock()
+
+	for _, c := range clients {
+		if err := c.Send(frame); err != nil {
+			logger.Log.Warn("Не удалось отправить фрейм пользователю",
+				zap.String("user_id", userID.String()),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// SaveMessage сохраняет сообщение в базе данных вместе с упоминаниями участников комнаты.
+// Повторная доставка того же сообщения возвращает ErrDuplicateMessage и ничего не сохраняет.
+func (cs *chatService) SaveMessage(msg *models.Message) error {
+	cs.resolveMentions(msg)
+	return cs.MessageRepo.SaveMessage(msg)
+}
+
+const (
+	// DefaultPageSize — размер страницы истории, если клиент его не указал
+	DefaultPageSize = 50
+	// MaxPageSize — максимальный размер страницы истории
+	MaxPageSize = 100
+	// MaxReplayMessages — сколько пропущенных сообщений досылается при переподключении
+	MaxReplayMessages = 200
+)
+
+// GetMessages возвращает страницу истории комнаты прямо из БД,
+// независимо от того, активна ли комната на инстансе
+func (cs *chatService) GetMessages(roomID, userID uuid.UUID, query models.MessageQuery) (*models.MessagePage, error) {
+	if err := cs.CheckAccess(roomID, userID); err != nil {
+		return nil, err
+	}
+	query.ParentID = uuid.Nil
+	if err := normalizeQuery(&query); err != nil {
+		return nil, err
+	}
+	page, err := cs.MessageRepo.GetMessagesPage(roomID, query)
+	if err != nil {
+		return nil, err
+	}
+	if err := cs.attachDetails(page.Messages, userID); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// attachDetails заполняет у сообщений реакции (с отметками viewerID) и вложения
+func (cs *chatService) attachDetails(messages []models.Message, viewerID uuid.UUID) error {
+	if err := cs.MessageRepo.AttachReactions(messages, viewerID); err != nil {
+		return err
+	}
+	return cs.MessageRepo.AttachFiles(messages)
+}
+
+// normalizeQuery проверяет курсоры и приводит размер страницы к допустимому
+func normalizeQuery(query *models.MessageQuery) error {
+	if query.Before != "" && query.After != "" {
+		return ErrInvalidCursor
+	}
+	query.Limit = pageLimit(query.Limit)
 	return nil
 }
 
+// pageLimit приводит размер страницы к допустимому: DefaultPageSize, если он не задан,
+// и не больше MaxPageSize
+func pageLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		return MaxPageSize
+	}
+	return limit
+}
+
+// GetMissedMessages возвращает пользователю до limit сообщений комнаты с номером больше lastSeq.
+// truncated = true, если пропущено больше limit сообщений и досылать их нужно постранично.
+func (cs *chatService) GetMissedMessages(roomID, userID uuid.UUID, lastSeq int64, limit int) ([]models.Message, bool, error) {
+	messages, truncated, err := cs.MessageRepo.GetMessagesAfter(roomID, lastSeq, limit)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := cs.attachDetails(messages, userID); err != nil {
+		return nil, false, err
+	}
+	return messages, truncated, nil
+}
+
+// activate добавляет комнату в активные. Уже активная комната не заменяется:
+// иначе её подключенные клиенты перестали бы получать рассылку. Вызывается под cs.Mu
+func (cs *chatService) activate(room RoomService) {
+	id := room.GetId()
+	if _, exists := cs.ActiveRooms[id]; exists {
+		return
+	}
+	cs.ActiveRooms[id] = room
+	if cs.Observer != nil {
+		cs.Observer.RoomActivated(id)
+	}
+}
+
+// deactivate удаляет комнату из активных. Вызывается под cs.Mu
+func (cs *chatService) deactivate(roomID uuid.UUID) {
+	delete(cs.ActiveRooms, roomID)
+	if cs.Observer != nil {
+		cs.Observer.RoomDeactivated(roomID)
+	}
+}
+
 // GetRoom возвращает комнату по ID или ошибку
 func (cs *chatService) GetRoom(roomId uuid.UUID) (RoomService, error) {
 	cs.Mu.Lock()
@@ -79,24 +385,184 @@ func (cs *chatService) IsActive(roomId uuid.UUID) bool {
 	return ok
 }
 
-// CheckAccess проверяет доступ пользователя
-func (rs *chatService) CheckAccess(userId uuid.UUID) bool {
-	return rs.Repo.CheckAccess(userId) == nil
+// CheckAccess проверяет, что пользователь состоит в комнате.
+// Возвращает ErrAccessDenied, если не состоит, и ошибку репозитория, если проверить не удалось.
+func (rs *chatService) CheckAccess(roomID, userID uuid.UUID) error {
+	isMember, err := rs.Repo.CheckAccess(roomID, userID)
+	if err != nil {
+		return err
+	}
+	if !isMember {
+		return ErrAccessDenied
+	}
+	return nil
+}
+
+// CreateRoom создает новую комнату, создатель становится её участником.
+// В активные комната попадает при первом подключении.
+func (rs *chatService) CreateRoom(name string, adminID uuid.UUID) (*models.Room, error) {
+	return rs.Repo.CreateRoom(name, adminID)
+}
+
+// GetUserRooms возвращает групповые комнаты и личные переписки пользователя
+// с непрочитанными сообщениями и упоминаниями
+func (cs *chatService) GetUserRooms(userId uuid.UUID) (*models.RoomList, error) {
+	rooms, err := cs.Repo.GetUserRooms(userId)
+	if err != nil {
+		return nil, err
+	}
+	direct, err := cs.GetDirectRooms(userId)
+	if err != nil {
+		return nil, err
+	}
+	return &models.RoomList{Rooms: rooms, Direct: direct}, nil
+}
+
+// AddMember добавляет пользователя в комнату с ролью member
+func (cs *chatService) AddMember(roomID, actorID, userID uuid.UUID) error {
+	if err := cs.Authorize(roomID, actorID, PermInvite); err != nil {
+		return err
+	}
+	if err := cs.checkGroupRoom(roomID); err != nil {
+		return err
+	}
+	added, err := cs.Repo.AddMember(roomID, userID)
+	if err != nil {
+		return err
+	}
+	if !added {
+		return ErrAlreadyMember
+	}
+	return nil
+}
+
+// RemoveMember исключает пользователя из комнаты. Исключать можно только участников
+// с ролью ниже своей; удаление самого себя равносильно выходу из комнаты.
+func (cs *chatService) RemoveMember(roomID, actorID, userID uuid.UUID) error {
+	if actorID == userID {
+		return cs.LeaveRoom(roomID, userID)
+	}
+
+	if _, err := cs.authorizeOver(roomID, actorID, userID, PermManageMembers); err != nil {
+		return err
+	}
+	return cs.Repo.RemoveMember(roomID, userID)
+}
+
+// LeaveRoom удаляет пользователя из участников комнаты.
+// Владелец должен сначала передать владение, из личной переписки выйти нельзя.
+func (cs *chatService) LeaveRoom(roomID, userID uuid.UUID) error {
+	role, err := cs.Repo.GetMemberRole(roomID, userID)
+	if err != nil {
+		return err
+	}
+	if role == models.RoleOwner {
+		return ErrOwnerMustStay
+	}
+	if err := cs.checkGroupRoom(roomID); err != nil {
+		return err
+	}
+	return cs.Repo.RemoveMember(roomID, userID)
 }
 
-// CreateRoom создает новую комнату и добавляет её в активные
-func (rs *chatService) CreateRoom(name string, adminID uuid.UUID) error {
-	if err := rs.Repo.CreateRoom(name, adminID); err != nil {
+// GetMembers возвращает участников комнаты. Список доступен только участникам.
+func (cs *chatService) GetMembers(roomID, actorID uuid.UUID) ([]models.RoomMember, error) {
+	if err := cs.CheckAccess(roomID, actorID); err != nil {
+		return nil, err
+	}
+	return cs.Repo.GetMembers(roomID)
+}
+
+// Authorize проверяет, что пользователь состоит в комнате и его роль разрешает действие
+func (cs *chatService) Authorize(roomID, userID uuid.UUID, perm Permission) error {
+	role, err := cs.Repo.GetMemberRole(roomID, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrMemberNotFound) {
+			return ErrAccessDenied
+		}
 		return err
 	}
-	newRoom := NewRoomService(uuid.New())
-	rs.Mu.Lock()
-	rs.ActiveRooms[newRoom.ID] = newRoom
-	rs.Mu.Unlock()
+	if !HasPermission(role, perm) {
+		return ErrAccessDenied
+	}
 	return nil
 }
 
-// GetUserRooms возвращает список комнат пользователя
-func (cs *chatService) GetUserRooms(userId uuid.UUID) ([]models.Room, error) {
-	return cs.Repo.GetUserRooms(userId)
-}
\ No newline at end of file
+// SetMemberRole назначает участнику роль. Назначать можно только роли ниже своей
+// и только участникам с ролью ниже своей; роль владельца передается через TransferOwnership.
+func (cs *chatService) SetMemberRole(roomID, actorID, userID uuid.UUID, role models.Role) error {
+	if role.Rank() == 0 || role == models.RoleOwner {
+		return ErrInvalidRole
+	}
+
+	actorRole, err := cs.authorizeOver(roomID, actorID, userID, PermManageRoles)
+	if err != nil {
+		return err
+	}
+	if role.Rank() >= actorRole.Rank() {
+		return ErrAccessDenied
+	}
+	return cs.Repo.SetMemberRole(roomID, userID, role)
+}
+
+// TransferOwnership передает владение комнатой другому участнику.
+// Выполнить может только текущий владелец, сам он становится администратором.
+func (cs *chatService) TransferOwnership(roomID, actorID, newOwnerID uuid.UUID) error {
+	role, err := cs.Repo.GetMemberRole(roomID, actorID)
+	if err != nil {
+		if errors.Is(err, repository.ErrMemberNotFound) {
+			return ErrAccessDenied
+		}
+		return err
+	}
+	if role != models.RoleOwner || actorID == newOwnerID {
+		return ErrAccessDenied
+	}
+	// Роль проверяется повторно в транзакции: владение могли передать параллельно
+	err = cs.Repo.TransferOwnership(roomID, actorID, newOwnerID)
+	if errors.Is(err, repository.ErrNotOwner) {
+		return ErrAccessDenied
+	}
+	return err
+}
+
+// RenameRoom меняет название комнаты
+func (cs *chatService) RenameRoom(roomID, actorID uuid.UUID, name string) error {
+	if err := cs.Authorize(roomID, actorID, PermChangeSettings); err != nil {
+		return err
+	}
+	return cs.Repo.RenameRoom(roomID, name)
+}
+
+// DeleteRoom удаляет комнату
+func (cs *chatService) DeleteRoom(roomID, actorID uuid.UUID) error {
+	if err := cs.Authorize(roomID, actorID, PermDeleteRoom); err != nil {
+		return err
+	}
+	return cs.Repo.DeleteRoom(roomID)
+}
+
+// authorizeOver проверяет право действия над другим участником:
+// у актора должно быть право perm и роль строго выше роли цели.
+// Возвращает роль актора.
+func (cs *chatService) authorizeOver(roomID, actorID, targetID uuid.UUID, perm Permission) (models.Role, error) {
+	actorRole, err := cs.Repo.GetMemberRole(roomID, actorID)
+	if err != nil {
+		if errors.Is(err, repository.ErrMemberNotFound) {
+			return "", ErrAccessDenied
+		}
+		return "", err
+	}
+	if !HasPermission(actorRole, perm) {
+		return "", ErrAccessDenied
+	}
+
+	targetRole, err := cs.Repo.GetMemberRole(roomID, targetID)
+	if err != nil {
+		return "", err
+	}
+	if targetRole.Rank() >= actorRole.Rank() {
+		return "", ErrAccessDenied
+	}
+	return actorRole, nil
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/andro-kes/Chat/chat/internal/protocol"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetMessagesNormalizesQuery(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     models.MessageQuery
+		wantLimit int
+		wantErr   error
+	}{
+		{"лимит по умолчанию", models.MessageQuery{}, DefaultPageSize, nil},
+		{"отрицательный лимит", models.MessageQuery{Limit: -5}, DefaultPageSize, nil},
+		{"лимит в пределах", models.MessageQuery{Limit: 10}, 10, nil},
+		{"ровно максимум", models.MessageQuery{Limit: MaxPageSize}, MaxPageSize, nil},
+		{"больше максимума", models.MessageQuery{Limit: MaxPageSize + 1}, MaxPageSize, nil},
+		{"только before", models.MessageQuery{Before: "a", Limit: 10}, 10, nil},
+		{"только after", models.MessageQuery{After: "a", Limit: 10}, 10, nil},
+		{"before и after вместе", models.MessageQuery{Before: "a", After: "b"}, 0, ErrInvalidCursor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chats, messages := newFakeChatRepo(), &fakeRoomRepo{}
+			cs := &chatService{Repo: chats, MessageRepo: messages}
+			roomID, userID := uuid.New(), uuid.New()
+			chats.addMember(roomID, userID, models.RoleMember)
+
+			_, err := cs.GetMessages(roomID, userID, tt.query)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Empty(t, messages.queries)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, messages.queries, 1)
+			assert.Equal(t, tt.wantLimit, messages.queries[0].Limit)
+			assert.Equal(t, tt.query.Before, messages.queries[0].Before)
+			assert.Equal(t, tt.query.After, messages.queries[0].After)
+		})
+	}
+}
+
+func TestGetMessagesRequiresMembership(t *testing.T) {
+	messages := &fakeRoomRepo{}
+	cs := &chatService{Repo: newFakeChatRepo(), MessageRepo: messages}
+
+	_, err := cs.GetMessages(uuid.New(), uuid.New(), models.MessageQuery{})
+	assert.ErrorIs(t, err, ErrAccessDenied)
+	assert.Empty(t, messages.queries)
+}
+
+// fakeObserver записывает уведомления об активных комнатах и пользователях
+type fakeObserver struct {
+	events []string
+}
+
+func (o *fakeObserver) RoomActivated(roomID uuid.UUID) {
+	o.events = append(o.events, "room+")
+}
+
+func (o *fakeObserver) RoomDeactivated(roomID uuid.UUID) {
+	o.events = append(o.events, "room-")
+}
+
+func (o *fakeObserver) UserConnected(userID uuid.UUID) {
+	o.events = append(o.events, "user+")
+}
+
+func (o *fakeObserver) UserDisconnected(userID uuid.UUID) {
+	o.events = append(o.events, "user-")
+}
+
+func newConnectedService() (*chatService, *fakeObserver) {
+	observer := &fakeObserver{}
+	cs := &chatService{
+		ActiveRooms: make(map[uuid.UUID]RoomService),
+		ActiveUsers: make(map[uuid.UUID]map[*Client]struct{}),
+		Observer:    observer,
+	}
+	return cs, observer
+}
+
+// Очередь инстанса привязывается к пользователю по первому соединению
+// и отвязывается по последнему, в какой бы комнате они ни были открыты
+func TestConnectClientTracksUsers(t *testing.T) {
+	cs, observer := newConnectedService()
+	first, _ := newTestClient(t)
+	second, _ := newTestClient(t)
+	second.UserID = first.UserID
+	roomA, roomB := uuid.New(), uuid.New()
+
+	_, err := cs.ConnectClient(roomA, first)
+	require.NoError(t, err)
+	_, err = cs.ConnectClient(roomB, second)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"room+", "user+", "room+"}, observer.events)
+
+	cs.DisconnectClient(roomA, first)
+	assert.Equal(t, []string{"room+", "user+", "room+", "room-"}, observer.events)
+	cs.DisconnectClient(roomB, second)
+	assert.Equal(t, []string{"room+", "user+", "room+", "room-", "user-", "room-"}, observer.events)
+	assert.Empty(t, cs.ActiveUsers)
+}
+
+func TestSendToUserReachesEveryConnection(t *testing.T) {
+	cs, _ := newConnectedService()
+	first, firstPeer := newTestClient(t)
+	second, secondPeer := newTestClient(t)
+	second.UserID = first.UserID
+	other, _ := newTestClient(t)
+	for _, c := range []*Client{first, second, other} {
+		go c.WritePump()
+		_, err := cs.ConnectClient(uuid.New(), c)
+		require.NoError(t, err)
+	}
+
+	cs.SendToUser(first.UserID, testFrame(t, "mention"))
+
+	for _, peer := range []*websocket.Conn{firstPeer, secondPeer} {
+		var f protocol.Frame
+		_ = peer.SetReadDeadline(time.Now().Add(time.Second))
+		require.NoError(t, peer.ReadJSON(&f))
+		assert.Equal(t, "mention", f.ID)
+	}
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/andro-kes/Chat/chat/internal/protocol"
+	"github.com/andro-kes/Chat/chat/logger"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+const (
+	// writeWait — максимальное время записи одного фрейма в сокет
+	writeWait = 10 * time.Second
+	// pongWait — сколько ждем pong (или любой фрейм) от клиента до разрыва соединения
+	pongWait = 60 * time.Second
+	// pingPeriod — период отправки ping, должен быть меньше pongWait
+	pingPeriod = pongWait * 9 / 10
+	// maxFrameSize — максимальный размер входящего фрейма в байтах
+	maxFrameSize = 64 * 1024
+	// sendBufferSize — размер очереди исходящих фреймов клиента
+	sendBufferSize = 64
+)
+
+var (
+	ErrClientClosed = errors.New("соединение клиента закрыто")
+	ErrSlowConsumer = errors.New("клиент не успевает читать сообщения")
+)
+
+// Client — WebSocket-соединение пользователя с собственной очередью исходящих фреймов.
+// Писать в сокет может только горутина WritePump, остальные кладут фреймы через Send,
+// поэтому медленный клиент не блокирует рассылку по комнате.
+//
+// На время досылки пропущенных сообщений клиента можно «придержать» (Hold):
+// живые фреймы копятся в pending и уходят после Release, чтобы не обогнать досылаемую историю.
+type Client struct {
+	UserID uuid.UUID
+	conn   *websocket.Conn
+	send   chan protocol.Frame
+	done   chan struct{}
+	once   sync.Once
+
+	mu      sync.Mutex
+	holding bool
+	pending []protocol.Frame
+}
+
+// NewClient оборачивает соединение и настраивает keepalive: каждый pong продлевает read deadline
+func NewClient(userID uuid.UUID, conn *websocket.Conn) *Client {
+	c := &Client{
+		UserID: userID,
+		conn:   conn,
+		send:   make(chan protocol.Frame, sendBufferSize),
+		done:   make(chan struct{}),
+	}
+
+	conn.SetReadLimit(maxFrameSize)
+	_ = conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	return c
+}
+
+// Send ставит фрейм в очередь на отправку, не блокируясь.
+// Если очередь переполнена, клиент считается медленным и отключается.
+func (c *Client) Send(f protocol.Frame) error {
+	select {
+	case <-c.done:
+		return ErrClientClosed
+	default:
+	}
+
+	// Неблокирующая отправка тоже под c.mu, чтобы не обогнать фреймы, которые отправляет Release
+	c.mu.Lock()
+	if c.holding {
+		if len(c.pending) >= sendBufferSize {
+			c.mu.Unlock()
+			return c.evict()
+		}
+		c.pending = append(c.pending, f)
+		c.mu.Unlock()
+		return nil
+	}
+
+	select {
+	case c.send <- f:
+		c.mu.Unlock()
+		return nil
+	default:
+		c.mu.Unlock()
+		return c.evict()
+	}
+}
+
+// Hold начинает копить фреймы из Send до вызова Release
+func (c *Client) Hold() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.holding = true
+}
+
+// Replay отправляет фрейм в обход накопителя. В отличие от Send ждет места в очереди,
+// но не дольше writeWait, поэтому длинная досылка не приводит к отключению.
+func (c *Client) Replay(f protocol.Frame) error {
+	return c.enqueueWait(f)
+}
+
+// Release отправляет накопленные фреймы, пропуская те, для которых skip вернул true
+// (например, сообщения, уже попавшие в досылку), и возвращает клиента в обычный режим.
+// Как и Send, не блокируется: если накопленное не помещается в очередь, клиент отключается.
+func (c *Client) Release(skip func(protocol.Frame) bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Под c.mu, чтобы новые фреймы из Send не обогнали накопленные. Ждать места
+	// в очереди здесь нельзя: Send из рассылки по комнате тоже берет c.mu.
+	for _, f := range c.pending {
+		if skip != nil && skip(f) {
+			continue
+		}
+		select {
+		case c.send <- f:
+		default:
+			c.pending = nil
+			return c.evict()
+		}
+	}
+	c.pending = nil
+	c.holding = false
+	return nil
+}
+
+func (c *Client) enqueueWait(f protocol.Frame) error {
+	timer := time.NewTimer(writeWait)
+	defer timer.Stop()
+
+	select {
+	case c.send <- f:
+		return nil
+	case <-c.done:
+		return ErrClientClosed
+	case <-timer.C:
+		return c.evict()
+	}
+}
+
+// evict отключает клиента, не успевающего читать сообщения
+func (c *Client) evict() error {
+	logger.Log.Warn("Переполнена очередь клиента, отключаем", zap.String("user_id", c.UserID.String()))
+	c.closeWith(websocket.CloseTryAgainLater, "slow consumer")
+	return ErrSlowConsumer
+}
+
+// ReadFrame читает следующий фрейм клиента. Любой входящий фрейм продлевает read deadline.
+func (c *Client) ReadFrame(f *protocol.Frame) error {
+	if err := c.conn.ReadJSON(f); err != nil {
+		return err
+	}
+	return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+}
+
+// WritePump отправляет фреймы из очереди и периодические ping.
+// Запускается в отдельной горутине на каждое соединение и завершается при закрытии клиента.
+func (c *Client) WritePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.Close()
+	}()
+
+	for {
+		select {
+		case f := <-c.send:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteJSON(f); err != nil {
+				logger.Log.Warn("Не удалось отправить фрейм клиенту", zap.String("user_id", c.UserID.String()), zap.Error(err))
+				return
+			}
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				logger.Log.Debug("Не удалось отправить ping", zap.String("user_id", c.UserID.String()), zap.Error(err))
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Close закрывает соединение клиента. Повторные вызовы безопасны.
+func (c *Client) Close() {
+	c.closeWith(websocket.CloseNormalClosure, "")
+}
+
+func (c *Client) closeWith(code int, reason string) {
+	c.once.Do(func() {
+		close(c.done)
+		// WriteControl можно вызывать параллельно с другими методами соединения
+		_ = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(writeWait))
+		_ = c.conn.Close()
+	})
+}
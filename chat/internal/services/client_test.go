@@ -0,0 +1,189 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andro-kes/Chat/chat/internal/protocol"
+	"github.com/andro-kes/Chat/chat/logger"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestMain(m *testing.M) {
+	logger.Log = zap.NewNop()
+	os.Exit(m.Run())
+}
+
+// wsPair возвращает серверную сторону WebSocket-соединения и подключенного к ней пира
+func wsPair(t *testing.T) (*websocket.Conn, *websocket.Conn) {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	conns := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	peer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = peer.Close() })
+
+	server := <-conns
+	t.Cleanup(func() { _ = server.Close() })
+	return server, peer
+}
+
+func newTestClient(t *testing.T) (*Client, *websocket.Conn) {
+	t.Helper()
+	server, peer := wsPair(t)
+	return NewClient(uuid.New(), server), peer
+}
+
+func testFrame(t *testing.T, id string) protocol.Frame {
+	t.Helper()
+	f, err := protocol.NewFrame(protocol.TypeSystem, id, nil)
+	require.NoError(t, err)
+	return f
+}
+
+// readClose читает фреймы пира до закрытия соединения и возвращает код закрытия
+func readClose(t *testing.T, peer *websocket.Conn) int {
+	t.Helper()
+	_ = peer.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		if _, _, err := peer.ReadMessage(); err != nil {
+			var closeErr *websocket.CloseError
+			require.ErrorAs(t, err, &closeErr)
+			return closeErr.Code
+		}
+	}
+}
+
+func TestClientSendEvictsSlowConsumer(t *testing.T) {
+	client, peer := newTestClient(t)
+
+	// WritePump не запущен: очередь только заполняется
+	for i := 0; i < sendBufferSize; i++ {
+		require.NoError(t, client.Send(testFrame(t, "f")))
+	}
+
+	assert.ErrorIs(t, client.Send(testFrame(t, "overflow")), ErrSlowConsumer)
+	assert.ErrorIs(t, client.Send(testFrame(t, "after")), ErrClientClosed)
+	assert.Equal(t, websocket.CloseTryAgainLater, readClose(t, peer))
+}
+
+func TestWritePumpDeliversInOrder(t *testing.T) {
+	client, peer := newTestClient(t)
+	pumpDone := make(chan struct{})
+	go func() {
+		client.WritePump()
+		close(pumpDone)
+	}()
+
+	for _, id := range []string{"1", "2", "3"} {
+		require.NoError(t, client.Send(testFrame(t, id)))
+	}
+
+	_ = peer.SetReadDeadline(time.Now().Add(time.Second))
+	for _, want := range []string{"1", "2", "3"} {
+		var f protocol.Frame
+		require.NoError(t, peer.ReadJSON(&f))
+		assert.Equal(t, want, f.ID)
+	}
+
+	client.Close()
+	select {
+	case <-pumpDone:
+	case <-time.After(time.Second):
+		t.Fatal("WritePump не завершился после Close")
+	}
+	assert.Equal(t, websocket.CloseNormalClosure, readClose(t, peer))
+	assert.ErrorIs(t, client.Send(testFrame(t, "closed")), ErrClientClosed)
+}
+
+func TestBroadcastEvictsSlowClientWithoutBlocking(t *testing.T) {
+	slow, slowPeer := newTestClient(t)
+	fast, fastPeer := newTestClient(t)
+	go fast.WritePump()
+
+	room := &roomService{
+		ID:          uuid.New(),
+		ActiveUsers: make(map[uuid.UUID]map[*Client]struct{}),
+	}
+	require.NoError(t, room.AddUser(slow))
+	require.NoError(t, room.AddUser(fast))
+	for i := 0; i < sendBufferSize; i++ {
+		require.NoError(t, slow.Send(testFrame(t, "backlog")))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		room.Broadcast(testFrame(t, "broadcast"))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Broadcast заблокировался на медленном клиенте")
+	}
+
+	room.Mu.RLock()
+	_, slowStays := room.ActiveUsers[slow.UserID]
+	_, fastStays := room.ActiveUsers[fast.UserID]
+	room.Mu.RUnlock()
+	assert.False(t, slowStays)
+	assert.True(t, fastStays)
+	assert.Equal(t, websocket.CloseTryAgainLater, readClose(t, slowPeer))
+
+	var f protocol.Frame
+	_ = fastPeer.SetReadDeadline(time.Now().Add(time.Second))
+	require.NoError(t, fastPeer.ReadJSON(&f))
+	assert.Equal(t, "broadcast", f.ID)
+}
+
+func messageFrame(t *testing.T, id string) protocol.Frame {
+	t.Helper()
+	f, err := protocol.NewFrame(protocol.TypeMessage, id, nil)
+	require.NoError(t, err)
+	return f
+}
+
+func TestReleaseSkipsReplayedAndKeepsOrder(t *testing.T) {
+	client, peer := newTestClient(t)
+	client.Hold()
+
+	// Пока идет досылка, живая рассылка приносит m2 и m3, m2 попадет и в досылку
+	require.NoError(t, client.Send(messageFrame(t, "m2")))
+	require.NoError(t, client.Send(testFrame(t, "sys")))
+	require.NoError(t, client.Send(messageFrame(t, "m3")))
+
+	replayed := map[string]bool{"m1": true, "m2": true}
+	require.NoError(t, client.Replay(messageFrame(t, "m1")))
+	require.NoError(t, client.Replay(messageFrame(t, "m2")))
+	require.NoError(t, client.Replay(testFrame(t, "done")))
+	require.NoError(t, client.Release(func(f protocol.Frame) bool {
+		return f.Type == protocol.TypeMessage && replayed[f.ID]
+	}))
+	require.NoError(t, client.Send(messageFrame(t, "m4")))
+	go client.WritePump()
+
+	_ = peer.SetReadDeadline(time.Now().Add(time.Second))
+	for _, want := range []string{"m1", "m2", "done", "sys", "m3", "m4"} {
+		var f protocol.Frame
+		require.NoError(t, peer.ReadJSON(&f))
+		assert.Equal(t, want, f.ID)
+	}
+}
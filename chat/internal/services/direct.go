@@ -0,0 +1,69 @@
+package services
+
+import (
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/andro-kes/Chat/chat/logger"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// OpenDirectRoom возвращает личную переписку пользователя с peerID. Комната у пары
+// одна и создается при первом сообщении; собеседник должен существовать в сервисе авторизации.
+// Name возвращенной комнаты — имя собеседника.
+func (cs *chatService) OpenDirectRoom(userID, peerID uuid.UUID) (*models.Room, error) {
+	if userID == peerID {
+		return nil, ErrInvalidPeer
+	}
+
+	names, err := cs.Users.Usernames([]uuid.UUID{peerID})
+	if err != nil {
+		return nil, err
+	}
+	name, ok := names[peerID]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+
+	room, err := cs.Repo.OpenDirectRoom(models.DirectRoomID(userID, peerID), userID, peerID)
+	if err != nil {
+		return nil, err
+	}
+	room.Name = name
+	return room, nil
+}
+
+// GetDirectRooms возвращает личные переписки пользователя. Названием переписки служит
+// имя собеседника; если сервис авторизации недоступен, список отдается без имен.
+func (cs *chatService) GetDirectRooms(userID uuid.UUID) ([]models.DirectRoom, error) {
+	rooms, err := cs.Repo.GetDirectRooms(userID)
+	if err != nil || len(rooms) == 0 {
+		return rooms, err
+	}
+
+	peers := make([]uuid.UUID, len(rooms))
+	for i := range rooms {
+		peers[i] = rooms[i].PeerID
+	}
+	names, err := cs.Users.Usernames(peers)
+	if err != nil {
+		logger.Log.Warn("Не удалось получить имена собеседников", zap.String("user_id", userID.String()), zap.Error(err))
+		return rooms, nil
+	}
+	for i := range rooms {
+		rooms[i].Name = names[rooms[i].PeerID]
+	}
+	return rooms, nil
+}
+
+// checkGroupRoom возвращает ErrDirectRoom, если комната — личная переписка:
+// состав участников такой комнаты не меняется
+func (cs *chatService) checkGroupRoom(roomID uuid.UUID) error {
+	room, err := cs.Repo.FindRoomByID(roomID)
+	if err != nil {
+		return err
+	}
+	if room.Kind == models.RoomDirect {
+		return ErrDirectRoom
+	}
+	return nil
+}
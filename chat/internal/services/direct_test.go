@@ -0,0 +1,62 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenDirectRoom(t *testing.T) {
+	alice, bob := uuid.New(), uuid.New()
+	cs := &chatService{
+		Repo:  newFakeChatRepo(),
+		Users: fakeUserDirectory{alice: "alice", bob: "bob"},
+	}
+
+	fromAlice, err := cs.OpenDirectRoom(alice, bob)
+	require.NoError(t, err)
+	fromBob, err := cs.OpenDirectRoom(bob, alice)
+	require.NoError(t, err)
+
+	// У пары одна комната, названием служит имя собеседника
+	assert.Equal(t, fromAlice.ID, fromBob.ID)
+	assert.Equal(t, models.DirectRoomID(alice, bob), fromAlice.ID)
+	assert.Equal(t, "bob", fromAlice.Name)
+	assert.Equal(t, "alice", fromBob.Name)
+	assert.NoError(t, cs.CheckAccess(fromAlice.ID, alice))
+	assert.NoError(t, cs.CheckAccess(fromAlice.ID, bob))
+}
+
+func TestOpenDirectRoomInvalidPeer(t *testing.T) {
+	alice := uuid.New()
+	cs := &chatService{
+		Repo:  newFakeChatRepo(),
+		Users: fakeUserDirectory{alice: "alice"},
+	}
+
+	_, err := cs.OpenDirectRoom(alice, alice)
+	assert.ErrorIs(t, err, ErrInvalidPeer)
+	_, err = cs.OpenDirectRoom(alice, uuid.New())
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+// Состав личной переписки не меняется: нельзя ни пригласить третьего, ни выйти
+func TestDirectRoomMembersFixed(t *testing.T) {
+	alice, bob := uuid.New(), uuid.New()
+	repo := newFakeChatRepo()
+	cs := &chatService{Repo: repo, Users: fakeUserDirectory{alice: "alice", bob: "bob"}}
+	room, err := cs.OpenDirectRoom(alice, bob)
+	require.NoError(t, err)
+
+	carol := uuid.New()
+	assert.ErrorIs(t, cs.AddMember(room.ID, alice, carol), ErrDirectRoom)
+	assert.ErrorIs(t, cs.LeaveRoom(room.ID, bob), ErrDirectRoom)
+
+	_, carolIn := repo.role(room.ID, carol)
+	_, bobIn := repo.role(room.ID, bob)
+	assert.False(t, carolIn)
+	assert.True(t, bobIn)
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/andro-kes/Chat/chat/logger"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	// MaxMessageTTL — наибольший срок жизни исчезающего сообщения
+	MaxMessageTTL = 7 * 24 * time.Hour
+	// ReapInterval — как часто инстанс удаляет истекшие сообщения. Сообщение исчезает
+	// не позже чем через ReapInterval после ExpiresAt.
+	ReapInterval = 5 * time.Second
+	// reapBatchSize — сколько истекших сообщений удаляется за одну транзакцию
+	reapBatchSize = 500
+)
+
+var ErrInvalidTTL = errors.New("недопустимый срок жизни сообщения")
+
+// MessageExpiry возвращает момент исчезновения сообщения, созданного в createdAt,
+// со сроком жизни ttl секунд. При ttl = 0 возвращает nil: срок берется из настроек комнаты.
+func MessageExpiry(createdAt time.Time, ttl int64) (*time.Time, error) {
+	if err := checkTTL(ttl); err != nil || ttl == 0 {
+		return nil, err
+	}
+	expiresAt := createdAt.Add(time.Duration(ttl) * time.Second)
+	return &expiresAt, nil
+}
+
+func checkTTL(ttl int64) error {
+	if ttl < 0 || ttl > int64(MaxMessageTTL/time.Second) {
+		return ErrInvalidTTL
+	}
+	return nil
+}
+
+// SetMessageTTL меняет срок жизни новых сообщений комнаты по умолчанию (в секундах, 0 — без срока)
+func (cs *chatService) SetMessageTTL(roomID, actorID uuid.UUID, ttl int64) error {
+	if err := checkTTL(ttl); err != nil {
+		return err
+	}
+	if err := cs.Authorize(roomID, actorID, PermChangeSettings); err != nil {
+		return err
+	}
+	return cs.Repo.SetMessageTTL(roomID, ttl)
+}
+
+// ReapExpiredMessages удаляет до limit истекших сообщений вместе с ответами в их тредах
+// и файлами вложений и возвращает «надгробия» всех удаленных сообщений для рассылки клиентам
+func (cs *chatService) ReapExpiredMessages(limit int) ([]models.Message, error) {
+	expired, keys, err := cs.MessageRepo.DeleteExpiredMessages(limit)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		cs.deleteBlob(key)
+	}
+
+	now := time.Now()
+	for i := range expired {
+		expired[i].DeletedAt = &now
+	}
+	return expired, nil
+}
+
+// ExpiryNotifier получает удаленные истекшие сообщения, чтобы разослать удаление клиентам
+type ExpiryNotifier func(expired []models.Message)
+
+// MessageReaper периодически удаляет истекшие сообщения и забытые неприложенные вложения.
+// Он работает на каждом инстансе: строки разбираются с блокировкой, поэтому каждое
+// сообщение удаляется и рассылается один раз.
+type MessageReaper struct {
+	service ChatService
+	notify  ExpiryNotifier
+
+	done chan struct{}
+	once sync.Once
+}
+
+// NewMessageReaper создает уборщика истекших сообщений. notify вызывается после каждой удаленной пачки.
+func NewMessageReaper(service ChatService, notify ExpiryNotifier) *MessageReaper {
+	return &MessageReaper{
+		service: service,
+		notify:  notify,
+		done:    make(chan struct{}),
+	}
+}
+
+// Start запускает уборку
+func (mr *MessageReaper) Start() {
+	go mr.loop()
+}
+
+// Stop останавливает уборку
+func (mr *MessageReaper) Stop() {
+	mr.once.Do(func() {
+		close(mr.done)
+	})
+}
+
+func (mr *MessageReaper) loop() {
+	ticker := time.NewTicker(ReapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			mr.reap()
+			mr.reapAttachments()
+		case <-mr.done:
+			return
+		}
+	}
+}
+
+// reap удаляет истекшие сообщения пачками, пока полная пачка говорит о том, что остались еще
+func (mr *MessageReaper) reap() {
+	for {
+		expired, err := mr.service.ReapExpiredMessages(reapBatchSize)
+		if err != nil {
+			logger.Log.Warn("Не удалось удалить истекшие сообщения", zap.Error(err))
+			return
+		}
+		if len(expired) > 0 {
+			mr.notify(expired)
+		}
+		if len(expired) < reapBatchSize {
+			return
+		}
+
+		select {
+		case <-mr.done:
+			return
+		default:
+		}
+	}
+}
+
+// reapAttachments удаляет неприложенные вложения старше PendingAttachmentTTL пачками
+func (mr *MessageReaper) reapAttachments() {
+	for {
+		n, err := mr.service.ReapStaleAttachments(reapBatchSize)
+		if err != nil {
+			logger.Log.Warn("Не удалось удалить неприложенные вложения", zap.Error(err))
+			return
+		}
+		if n < reapBatchSize {
+			return
+		}
+
+		select {
+		case <-mr.done:
+			return
+		default:
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckTTL(t *testing.T) {
+	maxTTL := int64(MaxMessageTTL / time.Second)
+
+	tests := []struct {
+		name    string
+		ttl     int64
+		wantErr bool
+	}{
+		{"без срока", 0, false},
+		{"секунда", 1, false},
+		{"час", 3600, false},
+		{"ровно максимум", maxTTL, false},
+		{"больше максимума", maxTTL + 1, true},
+		{"отрицательный", -1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkTTL(tt.ttl)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidTTL)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestMessageExpiry(t *testing.T) {
+	createdAt := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		ttl     int64
+		want    *time.Time
+		wantErr bool
+	}{
+		{"без срока — срок комнаты", 0, nil, false},
+		{"минута", 60, ptr(createdAt.Add(time.Minute)), false},
+		{"максимум", int64(MaxMessageTTL / time.Second), ptr(createdAt.Add(MaxMessageTTL)), false},
+		{"больше максимума", int64(MaxMessageTTL/time.Second) + 1, nil, true},
+		{"отрицательный", -60, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MessageExpiry(createdAt, tt.ttl)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidTTL)
+				assert.Nil(t, got)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestReapExpiredMessages(t *testing.T) {
+	roomID := uuid.New()
+	expired := []models.Message{{ID: uuid.New(), RoomID: roomID}, {ID: uuid.New(), RoomID: roomID}}
+	files := newFakeStorage()
+	files.objects["attachments/a"] = []byte("a")
+	files.objects["attachments/kept"] = []byte("kept")
+	messages := &fakeRoomRepo{
+		expired:     [][]models.Message{expired},
+		expiredKeys: [][]string{{"attachments/a"}},
+	}
+	cs := &chatService{MessageRepo: messages, Storage: files}
+
+	before := time.Now()
+	got, err := cs.ReapExpiredMessages(10)
+	require.NoError(t, err)
+
+	// Клиентам рассылаются «надгробия»
+	require.Len(t, got, 2)
+	for i, msg := range got {
+		assert.Equal(t, expired[i].ID, msg.ID)
+		require.NotNil(t, msg.DeletedAt)
+		assert.False(t, msg.DeletedAt.Before(before))
+	}
+	// Файлы вложений удаленных сообщений удаляются из хранилища, остальные остаются
+	assert.False(t, files.has("attachments/a"))
+	assert.True(t, files.has("attachments/kept"))
+
+	got, err = cs.ReapExpiredMessages(10)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+// fakeReapService отдает заранее заданные пачки истекших сообщений
+type fakeReapService struct {
+	ChatService
+
+	batches [][]models.Message
+	err     error
+	calls   int
+}
+
+func (s *fakeReapService) ReapExpiredMessages(limit int) ([]models.Message, error) {
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	if len(s.batches) == 0 {
+		return nil, nil
+	}
+	batch := s.batches[0]
+	s.batches = s.batches[1:]
+	return batch, nil
+}
+
+func expiredBatch(n int) []models.Message {
+	return make([]models.Message, n)
+}
+
+func TestMessageReaperBatches(t *testing.T) {
+	tests := []struct {
+		name      string
+		batches   [][]models.Message
+		wantCalls int
+		wantSizes []int
+	}{
+		{"нечего удалять", nil, 1, nil},
+		{"неполная пачка", [][]models.Message{expiredBatch(3)}, 1, []int{3}},
+		// Полная пачка значит, что истекшие сообщения, возможно, остались
+		{"полные пачки подряд", [][]models.Message{expiredBatch(reapBatchSize), expiredBatch(reapBatchSize), expiredBatch(1)}, 3, []int{reapBatchSize, reapBatchSize, 1}},
+		{"последняя пачка пустая", [][]models.Message{expiredBatch(reapBatchSize)}, 2, []int{reapBatchSize}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &fakeReapService{batches: tt.batches}
+			var sizes []int
+			mr := NewMessageReaper(svc, func(expired []models.Message) {
+				sizes = append(sizes, len(expired))
+			})
+
+			mr.reap()
+
+			assert.Equal(t, tt.wantCalls, svc.calls)
+			assert.Equal(t, tt.wantSizes, sizes)
+		})
+	}
+}
+
+func TestMessageReaperStops(t *testing.T) {
+	// Ошибка БД прерывает уборку до следующего тика
+	svc := &fakeReapService{err: errors.New("connection refused")}
+	mr := NewMessageReaper(svc, func([]models.Message) { t.Error("notify при ошибке") })
+	mr.reap()
+	assert.Equal(t, 1, svc.calls)
+
+	// После Stop очередная полная пачка не тянет за собой следующую
+	svc = &fakeReapService{batches: [][]models.Message{expiredBatch(reapBatchSize), expiredBatch(reapBatchSize)}}
+	mr = NewMessageReaper(svc, func([]models.Message) {})
+	mr.Stop()
+	mr.reap()
+	assert.Equal(t, 1, svc.calls)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
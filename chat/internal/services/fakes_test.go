@@ -0,0 +1,366 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/andro-kes/Chat/chat/internal/repository"
+	"github.com/andro-kes/Chat/chat/internal/storage"
+	"github.com/google/uuid"
+)
+
+// fakeChatRepo хранит участников комнат в памяти.
+// Методы, которые тесту не нужны, паникуют через встроенный nil-интерфейс.
+type fakeChatRepo struct {
+	repository.ChatRepo
+
+	mu    sync.Mutex
+	roles map[uuid.UUID]map[uuid.UUID]models.Role
+	// direct — комнаты личной переписки, остальные считаются групповыми
+	direct map[uuid.UUID]bool
+}
+
+func newFakeChatRepo() *fakeChatRepo {
+	return &fakeChatRepo{
+		roles:  make(map[uuid.UUID]map[uuid.UUID]models.Role),
+		direct: make(map[uuid.UUID]bool),
+	}
+}
+
+func (r *fakeChatRepo) addMember(roomID, userID uuid.UUID, role models.Role) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.roles[roomID] == nil {
+		r.roles[roomID] = make(map[uuid.UUID]models.Role)
+	}
+	r.roles[roomID][userID] = role
+}
+
+func (r *fakeChatRepo) role(roomID, userID uuid.UUID) (models.Role, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	role, ok := r.roles[roomID][userID]
+	return role, ok
+}
+
+func (r *fakeChatRepo) FindRoomByID(id uuid.UUID) (*models.Room, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.roles[id]; !ok {
+		return nil, repository.ErrRoomNotFound
+	}
+	room := &models.Room{ID: id, Kind: models.RoomGroup}
+	if r.direct[id] {
+		room.Kind = models.RoomDirect
+	}
+	return room, nil
+}
+
+func (r *fakeChatRepo) OpenDirectRoom(roomID, userID, peerID uuid.UUID) (*models.Room, error) {
+	r.mu.Lock()
+	r.direct[roomID] = true
+	r.mu.Unlock()
+	r.addMember(roomID, userID, models.RoleMember)
+	r.addMember(roomID, peerID, models.RoleMember)
+	return &models.Room{ID: roomID, Kind: models.RoomDirect}, nil
+}
+
+func (r *fakeChatRepo) AddMember(roomID, userID uuid.UUID) (bool, error) {
+	if _, ok := r.role(roomID, userID); ok {
+		return false, nil
+	}
+	r.addMember(roomID, userID, models.RoleMember)
+	return true, nil
+}
+
+func (r *fakeChatRepo) CheckAccess(roomID, userID uuid.UUID) (bool, error) {
+	_, ok := r.role(roomID, userID)
+	return ok, nil
+}
+
+func (r *fakeChatRepo) GetMemberRole(roomID, userID uuid.UUID) (models.Role, error) {
+	role, ok := r.role(roomID, userID)
+	if !ok {
+		return "", repository.ErrMemberNotFound
+	}
+	return role, nil
+}
+
+func (r *fakeChatRepo) SetMemberRole(roomID, userID uuid.UUID, role models.Role) error {
+	if _, ok := r.role(roomID, userID); !ok {
+		return repository.ErrMemberNotFound
+	}
+	r.addMember(roomID, userID, role)
+	return nil
+}
+
+func (r *fakeChatRepo) RemoveMember(roomID, userID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.roles[roomID][userID]; !ok {
+		return repository.ErrMemberNotFound
+	}
+	delete(r.roles[roomID], userID)
+	return nil
+}
+
+func (r *fakeChatRepo) TransferOwnership(roomID, fromID, toID uuid.UUID) error {
+	if _, ok := r.role(roomID, toID); !ok {
+		return repository.ErrMemberNotFound
+	}
+	r.addMember(roomID, fromID, models.RoleAdmin)
+	r.addMember(roomID, toID, models.RoleOwner)
+	return nil
+}
+
+// fakeUserDirectory отдает имена известных пользователей
+type fakeUserDirectory map[uuid.UUID]string
+
+func (d fakeUserDirectory) Usernames(ids []uuid.UUID) (map[uuid.UUID]string, error) {
+	names := make(map[uuid.UUID]string, len(ids))
+	for _, id := range ids {
+		if name, ok := d[id]; ok {
+			names[id] = name
+		}
+	}
+	return names, nil
+}
+
+func (d fakeUserDirectory) UserIDs(usernames []string) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	for id, name := range d {
+		for _, u := range usernames {
+			if strings.EqualFold(name, u) {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// unavailableDirectory имитирует недоступный сервис авторизации
+type unavailableDirectory struct {
+	UserDirectory
+}
+
+func (unavailableDirectory) UserIDs(usernames []string) ([]uuid.UUID, error) {
+	return nil, errors.New("auth unavailable")
+}
+
+// fakeRoomRepo хранит сообщения в памяти и запоминает запросы к истории
+type fakeRoomRepo struct {
+	repository.RoomRepo
+
+	mu          sync.Mutex
+	queries     []models.MessageQuery
+	searches    []models.SearchQuery
+	saved       []models.Message
+	messages    map[uuid.UUID]*models.Message
+	attachments map[uuid.UUID]*models.Attachment
+	pins        map[uuid.UUID]bool
+	// expired — пачки, которые по очереди отдает DeleteExpiredMessages, с ключами файлов вложений
+	expired     [][]models.Message
+	expiredKeys [][]string
+	// scheduled — очередь отложенных сообщений; commitErr имитирует сбой коммита после отправки
+	scheduled []models.ScheduledMessage
+	commitErr error
+}
+
+func (r *fakeRoomRepo) SaveMessage(msg *models.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.saved = append(r.saved, *msg)
+	return nil
+}
+
+func (r *fakeRoomRepo) addMessage(msg *models.Message) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.messages == nil {
+		r.messages = make(map[uuid.UUID]*models.Message)
+	}
+	r.messages[msg.ID] = msg
+}
+
+func (r *fakeRoomRepo) GetMessage(roomID, messageID uuid.UUID) (*models.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	msg, ok := r.messages[messageID]
+	if !ok || msg.RoomID != roomID {
+		return nil, repository.ErrMessageNotFound
+	}
+	copied := *msg
+	return &copied, nil
+}
+
+func (r *fakeRoomRepo) GetMessagesPage(roomID uuid.UUID, query models.MessageQuery) (*models.MessagePage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.queries = append(r.queries, query)
+	return &models.MessagePage{}, nil
+}
+
+// AttachReactions ничего не делает: реакции в тестах истории не проверяются
+func (r *fakeRoomRepo) AttachReactions(messages []models.Message, viewerID uuid.UUID) error {
+	return nil
+}
+
+// AttachFiles ничего не делает: вложения сообщений в тестах истории не проверяются
+func (r *fakeRoomRepo) AttachFiles(messages []models.Message) error {
+	return nil
+}
+
+func (r *fakeRoomRepo) SearchMessages(userID uuid.UUID, query models.SearchQuery) (*models.SearchPage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.searches = append(r.searches, query)
+	return &models.SearchPage{}, nil
+}
+
+func (r *fakeRoomRepo) SaveAttachment(a *models.Attachment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.attachments == nil {
+		r.attachments = make(map[uuid.UUID]*models.Attachment)
+	}
+	copied := *a
+	r.attachments[a.ID] = &copied
+	return nil
+}
+
+func (r *fakeRoomRepo) GetAttachment(roomID, attachmentID uuid.UUID) (*models.Attachment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	a, ok := r.attachments[attachmentID]
+	if !ok || a.RoomID != roomID {
+		return nil, repository.ErrAttachmentNotFound
+	}
+	copied := *a
+	return &copied, nil
+}
+
+func (r *fakeRoomRepo) GetPendingAttachments(roomID, uploaderID, messageID uuid.UUID, ids []uuid.UUID) ([]models.Attachment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []models.Attachment
+	for _, id := range ids {
+		a, ok := r.attachments[id]
+		if ok && a.RoomID == roomID && a.UploaderID == uploaderID && (a.MessageID == nil || *a.MessageID == messageID) {
+			found = append(found, *a)
+		}
+	}
+	return found, nil
+}
+
+// fakeStorage хранит объекты в памяти
+type fakeStorage struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeStorage() *fakeStorage {
+	return &fakeStorage{objects: make(map[string][]byte)}
+}
+
+func (s *fakeStorage) Put(ctx context.Context, key string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = data
+	return nil
+}
+
+func (s *fakeStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.objects[key]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *fakeStorage) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, key)
+	return nil
+}
+
+func (s *fakeStorage) has(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.objects[key]
+	return ok
+}
+
+func (r *fakeRoomRepo) PinMessage(roomID, messageID, userID uuid.UUID, limit int) (bool, time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pins == nil {
+		r.pins = make(map[uuid.UUID]bool)
+	}
+	if r.pins[messageID] {
+		return false, time.Time{}, nil
+	}
+	r.pins[messageID] = true
+	return true, time.Now(), nil
+}
+
+func (r *fakeRoomRepo) UnpinMessage(roomID, messageID uuid.UUID) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pinned := r.pins[messageID]
+	delete(r.pins, messageID)
+	return pinned, nil
+}
+
+func (r *fakeRoomRepo) DeleteExpiredMessages(limit int) ([]models.Message, []string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.expired) == 0 {
+		return nil, nil, nil
+	}
+	batch, keys := r.expired[0], r.expiredKeys[0]
+	r.expired, r.expiredKeys = r.expired[1:], r.expiredKeys[1:]
+	return batch, keys, nil
+}
+
+// DispatchScheduled повторяет контракт репозитория: отправленные сообщения снимаются
+// с очереди только при успешном коммите, неотправленные остаются
+func (r *fakeRoomRepo) DispatchScheduled(limit int, send func(sm *models.ScheduledMessage) error) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var kept []models.ScheduledMessage
+	done := 0
+	for i := range r.scheduled {
+		if i >= limit || send(&r.scheduled[i]) != nil {
+			kept = append(kept, r.scheduled[i])
+			continue
+		}
+		done++
+	}
+	if done == 0 {
+		return 0, nil
+	}
+	if r.commitErr != nil {
+		return 0, r.commitErr
+	}
+	r.scheduled = kept
+	return done, nil
+}
+
+func (r *fakeRoomRepo) queued() []models.ScheduledMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]models.ScheduledMessage(nil), r.scheduled...)
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/andro-kes/Chat/chat/logger"
+	"go.uber.org/zap"
+)
+
+// MaxMessageMentions — сколько разных имен из одного сообщения разрешается в упоминания
+const MaxMessageMentions = 20
+
+// mentionPattern — @имя в начале текста или после символа, не входящего в имя.
+// Так адрес почты вида name@example.com не считается упоминанием.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_.@-])@([\p{L}\p{N}_.-]+)`)
+
+// ParseMentions возвращает уникальные (без учета регистра) имена из @упоминаний текста
+// в порядке появления. Точки и дефисы в конце имени считаются пунктуацией.
+func ParseMentions(content string) []string {
+	seen := make(map[string]struct{})
+	var names []string
+	for _, m := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		name := strings.TrimRight(m[1], ".-")
+		if name == "" {
+			continue
+		}
+		key := strings.ToLower(name)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		names = append(names, name)
+		if len(names) == MaxMessageMentions {
+			break
+		}
+	}
+	return names
+}
+
+// resolveMentions находит через сервис авторизации пользователей, упомянутых в msg,
+// и записывает их в msg.Mentions. Упоминание не должно мешать доставке сообщения,
+// поэтому при недоступном сервисе сообщение сохраняется без упоминаний.
+func (cs *chatService) resolveMentions(msg *models.Message) {
+	msg.Mentions = nil
+	names := ParseMentions(msg.Content)
+	if len(names) == 0 {
+		return
+	}
+
+	ids, err := cs.Users.UserIDs(names)
+	if err != nil {
+		logger.Log.Warn("Не удалось разрешить упоминания", zap.String("message_id", msg.ID.String()), zap.Error(err))
+		return
+	}
+	for _, id := range ids {
+		if id != msg.SenderID {
+			msg.Mentions = append(msg.Mentions, id)
+		}
+	}
+}
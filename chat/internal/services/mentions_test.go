@@ -0,0 +1,80 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"без упоминаний", "привет всем", nil},
+		{"в начале текста", "@alice привет", []string{"alice"}},
+		{"после пробела", "привет, @bob!", []string{"bob"}},
+		{"кириллица", "@иван посмотри", []string{"иван"}},
+		{"точка в конце — пунктуация", "спасибо @alice.", []string{"alice"}},
+		{"точка внутри имени", "@john.doe смотри", []string{"john.doe"}},
+		{"дефис в конце", "@alice- ну", []string{"alice"}},
+		{"адрес почты не упоминание", "пиши на name@example.com", nil},
+		{"одна @ без имени", "встреча @ 10:00", nil},
+		{"повторы без учета регистра", "@Alice и @alice и @ALICE", []string{"Alice"}},
+		{"порядок появления", "@bob, @alice, @bob", []string{"bob", "alice"}},
+		{"после скобки", "(@alice)", []string{"alice"}},
+		{"двойная @", "@@alice", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ParseMentions(tt.content))
+		})
+	}
+}
+
+func TestParseMentionsLimit(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < MaxMessageMentions+5; i++ {
+		fmt.Fprintf(&b, "@user%d ", i)
+	}
+
+	names := ParseMentions(b.String())
+	assert.Len(t, names, MaxMessageMentions)
+	assert.Equal(t, "user0", names[0])
+}
+
+func TestSaveMessageResolvesMentions(t *testing.T) {
+	alice, bob, carol := uuid.New(), uuid.New(), uuid.New()
+	messages := &fakeRoomRepo{}
+	cs := &chatService{
+		MessageRepo: messages,
+		Users:       fakeUserDirectory{alice: "alice", bob: "bob", carol: "carol"},
+	}
+
+	// Упоминание самого себя не уведомляет, неизвестные имена пропускаются
+	msg := &models.Message{SenderID: alice, Content: "@Bob, @alice и @nobody, гляньте"}
+	require.NoError(t, cs.SaveMessage(msg))
+
+	assert.Equal(t, []uuid.UUID{bob}, msg.Mentions)
+	require.Len(t, messages.saved, 1)
+	assert.Equal(t, []uuid.UUID{bob}, messages.saved[0].Mentions)
+}
+
+// Недоступный сервис авторизации не мешает сохранению: сообщение сохраняется без упоминаний
+func TestSaveMessageWithoutDirectory(t *testing.T) {
+	messages := &fakeRoomRepo{}
+	cs := &chatService{MessageRepo: messages, Users: unavailableDirectory{}}
+
+	msg := &models.Message{SenderID: uuid.New(), Content: "@bob привет", Mentions: []uuid.UUID{uuid.New()}}
+	require.NoError(t, cs.SaveMessage(msg))
+
+	assert.Empty(t, msg.Mentions)
+	require.Len(t, messages.saved, 1)
+	assert.Empty(t, messages.saved[0].Mentions)
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/andro-kes/Chat/chat/internal/repository"
+	"github.com/google/uuid"
+)
+
+// EditMessage меняет текст сообщения. Редактировать может только автор, пока он может
+// писать в комнату и (если задано EditWindow) не истекло время на редактирование.
+// Прежний текст сохраняется в истории правок.
+func (cs *chatService) EditMessage(roomID, messageID, userID uuid.UUID, content string) (*models.Message, error) {
+	if err := cs.Authorize(roomID, userID, PermPost); err != nil {
+		return nil, err
+	}
+
+	msg, err := cs.getLiveMessage(roomID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.SenderID != userID {
+		return nil, ErrNotAuthor
+	}
+	if cs.EditWindow > 0 && time.Since(msg.CreatedAt) > cs.EditWindow {
+		return nil, ErrEditWindowExpired
+	}
+
+	return cs.MessageRepo.EditMessage(roomID, messageID, content)
+}
+
+// GetMessageEdits возвращает прежние версии сообщения участнику комнаты
+func (cs *chatService) GetMessageEdits(roomID, messageID, userID uuid.UUID) ([]models.MessageEdit, error) {
+	if err := cs.CheckAccess(roomID, userID); err != nil {
+		return nil, err
+	}
+	if _, err := cs.getLiveMessage(roomID, messageID); err != nil {
+		return nil, err
+	}
+	return cs.MessageRepo.GetMessageEdits(roomID, messageID)
+}
+
+// DeleteMessage удаляет сообщение и возвращает его «надгробие».
+// Свое сообщение может удалить любой участник комнаты, чужое — только роль
+// с правом PermDeleteOthersMessages (модератор и выше).
+func (cs *chatService) DeleteMessage(roomID, messageID, actorID uuid.UUID) (*models.Message, error) {
+	if err := cs.CheckAccess(roomID, actorID); err != nil {
+		return nil, err
+	}
+
+	msg, err := cs.getLiveMessage(roomID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.SenderID != actorID {
+		if err := cs.Authorize(roomID, actorID, PermDeleteOthersMessages); err != nil {
+			return nil, err
+		}
+	}
+
+	return cs.MessageRepo.DeleteMessage(roomID, messageID, actorID)
+}
+
+// CheckReplyParent проверяет, что на сообщение можно ответить в треде:
+// оно есть в комнате, не удалено и само не является ответом
+func (cs *chatService) CheckReplyParent(roomID, parentID uuid.UUID) error {
+	parent, err := cs.getLiveMessage(roomID, parentID)
+	if err != nil {
+		return err
+	}
+	if parent.ParentID != nil {
+		return ErrInvalidParent
+	}
+	return nil
+}
+
+// GetThread возвращает корневое сообщение треда и страницу ответов на него.
+// Тред удаленного сообщения остается доступным: корень отдается «надгробием».
+func (cs *chatService) GetThread(roomID, parentID, userID uuid.UUID, query models.MessageQuery) (*models.Message, *models.MessagePage, error) {
+	if err := cs.CheckAccess(roomID, userID); err != nil {
+		return nil, nil, err
+	}
+
+	parent, err := cs.MessageRepo.GetMessage(roomID, parentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if parent.ParentID != nil {
+		return nil, nil, ErrInvalidParent
+	}
+
+	query.ParentID = parentID
+	if err := normalizeQuery(&query); err != nil {
+		return nil, nil, err
+	}
+	page, err := cs.MessageRepo.GetMessagesPage(roomID, query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Реакции и вложения корня и ответов загружаем вместе
+	messages := append([]models.Message{*parent}, page.Messages...)
+	if err := cs.attachDetails(messages, userID); err != nil {
+		return nil, nil, err
+	}
+	*parent = messages[0]
+	copy(page.Messages, messages[1:])
+	return parent, page, nil
+}
+
+// maxEmojiLen — максимальная длина реакции в байтах, совпадает с размером колонки emoji
+const maxEmojiLen = 32
+
+// AddReaction ставит реакцию участника на неудаленное сообщение комнаты.
+// Возвращает false, если реакция уже стояла, и текущее число реакций этим эмодзи.
+func (cs *chatService) AddReaction(roomID, messageID, userID uuid.UUID, emoji string) (bool, int, error) {
+	if err := cs.checkReaction(roomID, messageID, userID, emoji); err != nil {
+		return false, 0, err
+	}
+	return cs.MessageRepo.AddReaction(messageID, userID, emoji)
+}
+
+// RemoveReaction снимает реакцию участника.
+// Возвращает false, если реакции не было, и текущее число реакций этим эмодзи.
+func (cs *chatService) RemoveReaction(roomID, messageID, userID uuid.UUID, emoji string) (bool, int, error) {
+	if err := cs.checkReaction(roomID, messageID, userID, emoji); err != nil {
+		return false, 0, err
+	}
+	return cs.MessageRepo.RemoveReaction(messageID, userID, emoji)
+}
+
+func (cs *chatService) checkReaction(roomID, messageID, userID uuid.UUID, emoji string) error {
+	if emoji == "" || len(emoji) > maxEmojiLen || !utf8.ValidString(emoji) || strings.ContainsFunc(emoji, unicode.IsSpace) {
+		return ErrInvalidEmoji
+	}
+	if err := cs.CheckAccess(roomID, userID); err != nil {
+		return err
+	}
+	_, err := cs.getLiveMessage(roomID, messageID)
+	return err
+}
+
+// MarkRead отмечает сообщения комнаты до seq включительно прочитанными участником.
+// Возвращает курсор чтения и true, если он сдвинулся и нужно разослать уведомление о прочтении.
+func (cs *chatService) MarkRead(roomID, userID uuid.UUID, seq int64) (int64, bool, error) {
+	current, changed, err := cs.Repo.MarkRead(roomID, userID, seq)
+	if errors.Is(err, repository.ErrMemberNotFound) {
+		return 0, false, ErrAccessDenied
+	}
+	return current, changed, err
+}
+
+// getLiveMessage возвращает сообщение комнаты; удаленное считается ненайденным
+func (cs *chatService) getLiveMessage(roomID, messageID uuid.UUID) (*models.Message, error) {
+	msg, err := cs.MessageRepo.GetMessage(roomID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.DeletedAt != nil {
+		return nil, ErrMessageNotFound
+	}
+	return msg, nil
+}
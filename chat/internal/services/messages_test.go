@@ -0,0 +1,90 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// threadFixture — комната с участником, корневым сообщением, ответом на него и удаленным корнем
+type threadFixture struct {
+	cs       *chatService
+	messages *fakeRoomRepo
+	roomID   uuid.UUID
+	userID   uuid.UUID
+	root     *models.Message
+	reply    *models.Message
+	deleted  *models.Message
+}
+
+func newThreadFixture() threadFixture {
+	chats := newFakeChatRepo()
+	f := threadFixture{
+		messages: &fakeRoomRepo{},
+		roomID:   uuid.New(),
+		userID:   uuid.New(),
+	}
+	f.cs = &chatService{Repo: chats, MessageRepo: f.messages}
+	chats.addMember(f.roomID, f.userID, models.RoleMember)
+
+	deletedAt := time.Now()
+	f.root = &models.Message{ID: uuid.New(), RoomID: f.roomID}
+	f.reply = &models.Message{ID: uuid.New(), RoomID: f.roomID, ParentID: &f.root.ID}
+	f.deleted = &models.Message{ID: uuid.New(), RoomID: f.roomID, DeletedAt: &deletedAt}
+	for _, msg := range []*models.Message{f.root, f.reply, f.deleted} {
+		f.messages.addMessage(msg)
+	}
+	return f
+}
+
+func TestCheckReplyParent(t *testing.T) {
+	f := newThreadFixture()
+
+	assert.NoError(t, f.cs.CheckReplyParent(f.roomID, f.root.ID))
+	// Треды одноуровневые: ответить на ответ нельзя
+	assert.ErrorIs(t, f.cs.CheckReplyParent(f.roomID, f.reply.ID), ErrInvalidParent)
+	assert.ErrorIs(t, f.cs.CheckReplyParent(f.roomID, f.deleted.ID), ErrMessageNotFound)
+	assert.ErrorIs(t, f.cs.CheckReplyParent(uuid.New(), f.root.ID), ErrMessageNotFound)
+}
+
+func TestGetThread(t *testing.T) {
+	f := newThreadFixture()
+
+	parent, _, err := f.cs.GetThread(f.roomID, f.root.ID, f.userID, models.MessageQuery{Limit: MaxPageSize + 1})
+	require.NoError(t, err)
+	assert.Equal(t, f.root.ID, parent.ID)
+	require.Len(t, f.messages.queries, 1)
+	assert.Equal(t, f.root.ID, f.messages.queries[0].ParentID)
+	assert.Equal(t, MaxPageSize, f.messages.queries[0].Limit)
+
+	// Тред удаленного сообщения доступен, корень отдается «надгробием»
+	parent, _, err = f.cs.GetThread(f.roomID, f.deleted.ID, f.userID, models.MessageQuery{})
+	require.NoError(t, err)
+	assert.NotNil(t, parent.DeletedAt)
+}
+
+func TestGetThreadRejected(t *testing.T) {
+	f := newThreadFixture()
+
+	_, _, err := f.cs.GetThread(f.roomID, f.reply.ID, f.userID, models.MessageQuery{})
+	assert.ErrorIs(t, err, ErrInvalidParent)
+	_, _, err = f.cs.GetThread(f.roomID, f.root.ID, uuid.New(), models.MessageQuery{})
+	assert.ErrorIs(t, err, ErrAccessDenied)
+	_, _, err = f.cs.GetThread(f.roomID, f.root.ID, f.userID, models.MessageQuery{Before: "a", After: "b"})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+	assert.Empty(t, f.messages.queries)
+}
+
+// Общая история не фильтруется по треду, даже если клиент передал parent_id
+func TestGetMessagesIgnoresParentID(t *testing.T) {
+	f := newThreadFixture()
+
+	_, err := f.cs.GetMessages(f.roomID, f.userID, models.MessageQuery{ParentID: f.root.ID})
+	require.NoError(t, err)
+	require.Len(t, f.messages.queries, 1)
+	assert.Equal(t, uuid.Nil, f.messages.queries[0].ParentID)
+}
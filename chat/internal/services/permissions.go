@@ -0,0 +1,64 @@
+package services
+
+import "github.com/andro-kes/Chat/chat/internal/models"
+
+// Permission — действие в комнате, требующее проверки роли
+type Permission int
+
+const (
+	// PermPost — отправка сообщений
+	PermPost Permission = iota
+	// PermInvite — добавление новых участников
+	PermInvite
+	// PermDeleteOthersMessages — удаление чужих сообщений
+	PermDeleteOthersMessages
+	// PermManageMembers — исключение участников с ролью ниже своей
+	PermManageMembers
+	// PermManageRoles — назначение ролей ниже своей
+	PermManageRoles
+	// PermChangeSettings — изменение настроек комнаты (название и т.п.)
+	PermChangeSettings
+	// PermDeleteRoom — удаление комнаты
+	PermDeleteRoom
+	// PermPinMessages — закрепление и открепление сообщений
+	PermPinMessages
+)
+
+// rolePermissions — матрица прав ролей. Передача владения проверяется отдельно:
+// её может выполнить только владелец.
+var rolePermissions = map[models.Role]map[Permission]bool{
+	models.RoleOwner: {
+		PermPost:                 true,
+		PermInvite:               true,
+		PermDeleteOthersMessages: true,
+		PermManageMembers:        true,
+		PermManageRoles:          true,
+		PermChangeSettings:       true,
+		PermDeleteRoom:           true,
+		PermPinMessages:          true,
+	},
+	models.RoleAdmin: {
+		PermPost:                 true,
+		PermInvite:               true,
+		PermDeleteOthersMessages: true,
+		PermManageMembers:        true,
+		PermManageRoles:          true,
+		PermChangeSettings:       true,
+		PermPinMessages:          true,
+	},
+	models.RoleModerator: {
+		PermPost:                 true,
+		PermInvite:               true,
+		PermDeleteOthersMessages: true,
+		PermManageMembers:        true,
+	},
+	models.RoleMember: {
+		PermPost:   true,
+		PermInvite: true,
+	},
+}
+
+// HasPermission проверяет, разрешено ли роли действие
+func HasPermission(role models.Role, perm Permission) bool {
+	return rolePermissions[role][perm]
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+var allPermissions = []Permission{
+	PermPost,
+	PermInvite,
+	PermDeleteOthersMessages,
+	PermManageMembers,
+	PermManageRoles,
+	PermChangeSettings,
+	PermDeleteRoom,
+	PermPinMessages,
+}
+
+var allRoles = []models.Role{models.RoleOwner, models.RoleAdmin, models.RoleModerator, models.RoleMember}
+
+func TestHasPermission(t *testing.T) {
+	tests := []struct {
+		perm Permission
+		name string
+		want map[models.Role]bool
+	}{
+		{PermPost, "post", map[models.Role]bool{models.RoleOwner: true, models.RoleAdmin: true, models.RoleModerator: true, models.RoleMember: true}},
+		{PermInvite, "invite", map[models.Role]bool{models.RoleOwner: true, models.RoleAdmin: true, models.RoleModerator: true, models.RoleMember: true}},
+		{PermDeleteOthersMessages, "delete others", map[models.Role]bool{models.RoleOwner: true, models.RoleAdmin: true, models.RoleModerator: true}},
+		{PermManageMembers, "manage members", map[models.Role]bool{models.RoleOwner: true, models.RoleAdmin: true, models.RoleModerator: true}},
+		{PermManageRoles, "manage roles", map[models.Role]bool{models.RoleOwner: true, models.RoleAdmin: true}},
+		{PermChangeSettings, "change settings", map[models.Role]bool{models.RoleOwner: true, models.RoleAdmin: true}},
+		{PermDeleteRoom, "delete room", map[models.Role]bool{models.RoleOwner: true}},
+		{PermPinMessages, "pin", map[models.Role]bool{models.RoleOwner: true, models.RoleAdmin: true}},
+	}
+	for _, tt := range tests {
+		for _, role := range allRoles {
+			t.Run(tt.name+"/"+string(role), func(t *testing.T) {
+				assert.Equal(t, tt.want[role], HasPermission(role, tt.perm))
+			})
+		}
+	}
+}
+
+func TestHasPermissionUnknownRole(t *testing.T) {
+	for _, role := range []models.Role{"", "guest", "OWNER"} {
+		for _, perm := range allPermissions {
+			assert.False(t, HasPermission(role, perm), "%q: %d", role, perm)
+		}
+	}
+}
+
+// Старшая роль может всё, что может младшая
+func TestHasPermissionFollowsRank(t *testing.T) {
+	for _, senior := range allRoles {
+		for _, junior := range allRoles {
+			if senior.Rank() <= junior.Rank() {
+				continue
+			}
+			for _, perm := range allPermissions {
+				if HasPermission(junior, perm) {
+					assert.True(t, HasPermission(senior, perm), "%s должен уметь то же, что %s: %d", senior, junior, perm)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"time"
+
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/google/uuid"
+)
+
+// MaxRoomPins — сколько сообщений можно закрепить в одной комнате
+const MaxRoomPins = 50
+
+// PinMessage закрепляет неудаленное сообщение комнаты. Закреплять могут владелец и администраторы.
+// Возвращает false, если сообщение уже было закреплено, и время закрепления.
+func (cs *chatService) PinMessage(roomID, messageID, actorID uuid.UUID) (bool, time.Time, error) {
+	if err := cs.Authorize(roomID, actorID, PermPinMessages); err != nil {
+		return false, time.Time{}, err
+	}
+	if _, err := cs.getLiveMessage(roomID, messageID); err != nil {
+		return false, time.Time{}, err
+	}
+	return cs.MessageRepo.PinMessage(roomID, messageID, actorID, MaxRoomPins)
+}
+
+// UnpinMessage открепляет сообщение. Возвращает false, если оно не было закреплено.
+// Открепить можно и удаленное сообщение.
+func (cs *chatService) UnpinMessage(roomID, messageID, actorID uuid.UUID) (bool, error) {
+	if err := cs.Authorize(roomID, actorID, PermPinMessages); err != nil {
+		return false, err
+	}
+	return cs.MessageRepo.UnpinMessage(roomID, messageID)
+}
+
+// GetPins возвращает закрепленные сообщения комнаты с реакциями и вложениями
+func (cs *chatService) GetPins(roomID, userID uuid.UUID) ([]models.PinnedMessage, error) {
+	if err := cs.CheckAccess(roomID, userID); err != nil {
+		return nil, err
+	}
+	pins, err := cs.MessageRepo.GetPins(roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]models.Message, len(pins))
+	for i := range pins {
+		messages[i] = pins[i].Message
+	}
+	if err := cs.attachDetails(messages, userID); err != nil {
+		return nil, err
+	}
+	for i := range pins {
+		pins[i].Message = messages[i]
+	}
+	return pins, nil
+}
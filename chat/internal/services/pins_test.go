@@ -0,0 +1,50 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPinMessage(t *testing.T) {
+	f := newThreadFixture()
+	admin := uuid.New()
+	f.cs.Repo.(*fakeChatRepo).addMember(f.roomID, admin, models.RoleAdmin)
+
+	pinned, _, err := f.cs.PinMessage(f.roomID, f.root.ID, admin)
+	require.NoError(t, err)
+	assert.True(t, pinned)
+
+	// Повторное закрепление не ошибка, но и не новое событие
+	pinned, _, err = f.cs.PinMessage(f.roomID, f.root.ID, admin)
+	require.NoError(t, err)
+	assert.False(t, pinned)
+
+	unpinned, err := f.cs.UnpinMessage(f.roomID, f.root.ID, admin)
+	require.NoError(t, err)
+	assert.True(t, unpinned)
+	unpinned, err = f.cs.UnpinMessage(f.roomID, f.root.ID, admin)
+	require.NoError(t, err)
+	assert.False(t, unpinned)
+}
+
+func TestPinMessageRejected(t *testing.T) {
+	f := newThreadFixture()
+	admin := uuid.New()
+	f.cs.Repo.(*fakeChatRepo).addMember(f.roomID, admin, models.RoleAdmin)
+
+	// Обычный участник закреплять не может
+	_, _, err := f.cs.PinMessage(f.roomID, f.root.ID, f.userID)
+	assert.ErrorIs(t, err, ErrAccessDenied)
+	_, err = f.cs.UnpinMessage(f.roomID, f.root.ID, f.userID)
+	assert.ErrorIs(t, err, ErrAccessDenied)
+
+	_, _, err = f.cs.PinMessage(f.roomID, f.deleted.ID, admin)
+	assert.ErrorIs(t, err, ErrMessageNotFound)
+	_, _, err = f.cs.PinMessage(f.roomID, uuid.New(), admin)
+	assert.ErrorIs(t, err, ErrMessageNotFound)
+	assert.Empty(t, f.messages.pins)
+}
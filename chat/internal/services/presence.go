@@ -0,0 +1,280 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/andro-kes/Chat/chat/internal/repository"
+	"github.com/andro-kes/Chat/chat/logger"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	// PresenceHeartbeat — как часто инстанс продлевает строки присутствия своих пользователей
+	PresenceHeartbeat = 20 * time.Second
+	// PresenceTTL — сколько строка присутствия живет без продления. Если инстанс упал,
+	// его пользователи станут offline не позже чем через PresenceTTL + PresenceHeartbeat.
+	PresenceTTL = 3 * PresenceHeartbeat
+	// MaxPresenceUsers — сколько пользователей можно запросить за раз
+	MaxPresenceUsers = 100
+)
+
+var ErrInvalidStatus = errors.New("невалидный статус присутствия")
+
+// PresenceNotifier получает изменившееся присутствие пользователя и его комнаты,
+// чтобы разослать событие участникам
+type PresenceNotifier func(roomIDs []uuid.UUID, presence models.Presence)
+
+// PresenceTracker сводит все соединения пользователя в один статус.
+// Соединения инстанса (по одному на открытую комнату) учитываются в памяти,
+// а в БД инстанс хранит только итоговый статус пользователя у себя,
+// поэтому общий статус складывается из строк всех инстансов.
+type PresenceTracker struct {
+	instanceID uuid.UUID
+	repo       repository.PresenceRepo
+	notify     PresenceNotifier
+
+	// mu защищает только состояние в памяти; запись в БД и рассылка идут без него
+	mu      sync.Mutex
+	clients map[uuid.UUID]*userPresence
+	// writes учитывает записи в БД, начатые до Stop
+	writes sync.WaitGroup
+
+	done chan struct{}
+	once sync.Once
+}
+
+// userPresence — соединения пользователя на инстансе и записанный в БД статус
+type userPresence struct {
+	// conns защищает PresenceTracker.mu
+	conns map[*Client]models.PresenceStatus
+	// write сериализует запись статуса пользователя в БД, чтобы строки
+	// не обновлялись в обратном порядке; stored защищает он же
+	write  sync.Mutex
+	stored models.PresenceStatus
+}
+
+// NewPresenceTracker создает трекер инстанса. notify вызывается при смене общего статуса пользователя.
+func NewPresenceTracker(notify PresenceNotifier) *PresenceTracker {
+	return &PresenceTracker{
+		instanceID: uuid.New(),
+		repo:       repository.NewPresenceRepo(),
+		notify:     notify,
+		clients:    make(map[uuid.UUID]*userPresence),
+		done:       make(chan struct{}),
+	}
+}
+
+// Start запускает продление строк инстанса и уборку строк упавших инстансов
+func (t *PresenceTracker) Start() {
+	go t.heartbeat()
+}
+
+// Stop останавливает трекер и удаляет строки инстанса. Пользователи, у которых
+// не осталось соединений на других инстансах, становятся offline.
+func (t *PresenceTracker) Stop() {
+	t.once.Do(func() {
+		t.mu.Lock()
+		close(t.done)
+		t.mu.Unlock()
+		// Дожидаемся начатых записей, иначе они вернут строки после удаления
+		t.writes.Wait()
+
+		userIDs, err := t.repo.RemoveInstance(t.instanceID)
+		if err != nil {
+			logger.Log.Warn("Не удалось удалить присутствие инстанса", zap.Error(err))
+			return
+		}
+		t.announceOffline(userIDs)
+	})
+}
+
+// Connect учитывает новое соединение пользователя, по умолчанию — online
+func (t *PresenceTracker) Connect(c *Client) {
+	t.update(c.UserID, func(conns map[*Client]models.PresenceStatus) {
+		conns[c] = models.PresenceOnline
+	})
+}
+
+// Disconnect перестает учитывать соединение
+func (t *PresenceTracker) Disconnect(c *Client) {
+	t.update(c.UserID, func(conns map[*Client]models.PresenceStatus) {
+		delete(conns, c)
+	})
+}
+
+// SetStatus меняет статус соединения: клиент сообщает away, когда пользователь
+// не смотрит на вкладку, и online, когда возвращается
+func (t *PresenceTracker) SetStatus(c *Client, status models.PresenceStatus) error {
+	if status != models.PresenceOnline && status != models.PresenceAway {
+		return ErrInvalidStatus
+	}
+	t.update(c.UserID, func(conns map[*Client]models.PresenceStatus) {
+		if _, ok := conns[c]; ok {
+			conns[c] = status
+		}
+	})
+	return nil
+}
+
+// GetPresence возвращает присутствие пользователей, которые состоят с viewerID
+// в общей комнате. Остальные в ответ не попадают.
+func (t *PresenceTracker) GetPresence(viewerID uuid.UUID, userIDs []uuid.UUID) ([]models.Presence, error) {
+	return t.repo.GetPresence(viewerID, userIDs, PresenceTTL)
+}
+
+// update применяет изменение к соединениям пользователя в памяти и, если статус пользователя
+// на инстансе изменился, записывает его в БД уже без общей блокировки.
+// Событие рассылается только при смене общего статуса.
+func (t *PresenceTracker) update(userID uuid.UUID, apply func(map[*Client]models.PresenceStatus)) {
+	t.mu.Lock()
+	// После Stop строки инстанса удалены, закрывающиеся соединения их не возвращают
+	select {
+	case <-t.done:
+		t.mu.Unlock()
+		return
+	default:
+	}
+
+	up := t.clients[userID]
+	if up == nil {
+		up = &userPresence{
+			conns:  make(map[*Client]models.PresenceStatus),
+			stored: models.PresenceOffline,
+		}
+		t.clients[userID] = up
+	}
+	apply(up.conns)
+	t.writes.Add(1)
+	t.mu.Unlock()
+
+	defer t.writes.Done()
+	changed, ok := t.store(userID, up)
+	if ok {
+		t.publish(changed)
+	}
+}
+
+// store записывает в БД текущий статус пользователя на инстансе, если он отличается
+// от записанного. Статус берется в момент записи, поэтому при нескольких изменениях
+// подряд последней записывается актуальная версия.
+func (t *PresenceTracker) store(userID uuid.UUID, up *userPresence) (models.Presence, bool) {
+	up.write.Lock()
+	defer up.write.Unlock()
+
+	t.mu.Lock()
+	after := localStatus(up.conns)
+	t.mu.Unlock()
+	defer t.forget(userID, up)
+
+	if after == up.stored {
+		return models.Presence{}, false
+	}
+
+	prev, err := t.current(userID)
+	if err != nil {
+		logger.Log.Warn("Не удалось получить присутствие", zap.String("user_id", userID.String()), zap.Error(err))
+	}
+
+	if after == models.PresenceOffline {
+		err = t.repo.RemoveSession(t.instanceID, userID)
+	} else {
+		err = t.repo.SetSession(t.instanceID, userID, after)
+	}
+	if err != nil {
+		logger.Log.Warn("Не удалось сохранить присутствие", zap.String("user_id", userID.String()), zap.Error(err))
+		return models.Presence{}, false
+	}
+	up.stored = after
+
+	cur, err := t.current(userID)
+	if err != nil {
+		logger.Log.Warn("Не удалось получить присутствие", zap.String("user_id", userID.String()), zap.Error(err))
+		return models.Presence{}, false
+	}
+	return cur, cur.Status != prev.Status
+}
+
+// forget убирает пользователя без соединений, чей offline уже записан.
+// Вызывается под up.write, поэтому запись по удаленной записи не начнется.
+func (t *PresenceTracker) forget(userID uuid.UUID, up *userPresence) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(up.conns) == 0 && up.stored == models.PresenceOffline && t.clients[userID] == up {
+		delete(t.clients, userID)
+	}
+}
+
+// current возвращает общий статус пользователя по всем инстансам
+func (t *PresenceTracker) current(userID uuid.UUID) (models.Presence, error) {
+	presence, err := t.repo.GetPresence(userID, []uuid.UUID{userID}, PresenceTTL)
+	if err != nil || len(presence) == 0 {
+		return models.Presence{UserID: userID, Status: models.PresenceOffline}, err
+	}
+	return presence[0], nil
+}
+
+func (t *PresenceTracker) publish(presence models.Presence) {
+	if t.notify == nil {
+		return
+	}
+	roomIDs, err := t.repo.GetUserRoomIDs(presence.UserID)
+	if err != nil {
+		logger.Log.Warn("Не удалось получить комнаты пользователя", zap.String("user_id", presence.UserID.String()), zap.Error(err))
+		return
+	}
+	t.notify(roomIDs, presence)
+}
+
+// announceOffline рассылает offline тем из пользователей, у кого не осталось живых строк
+func (t *PresenceTracker) announceOffline(userIDs []uuid.UUID) {
+	for _, userID := range userIDs {
+		presence, err := t.current(userID)
+		if err != nil {
+			logger.Log.Warn("Не удалось получить присутствие", zap.String("user_id", userID.String()), zap.Error(err))
+			continue
+		}
+		if presence.Status == models.PresenceOffline {
+			t.publish(presence)
+		}
+	}
+}
+
+func (t *PresenceTracker) heartbeat() {
+	ticker := time.NewTicker(PresenceHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := t.repo.TouchSessions(t.instanceID); err != nil {
+				logger.Log.Warn("Не удалось продлить присутствие", zap.Error(err))
+			}
+			// Строки упавших инстансов удаляет тот, кто первым их заметил
+			stale, err := t.repo.RemoveStaleSessions(PresenceTTL)
+			if err != nil {
+				logger.Log.Warn("Не удалось удалить устаревшее присутствие", zap.Error(err))
+				continue
+			}
+			t.announceOffline(stale)
+		case <-t.done:
+			return
+		}
+	}
+}
+
+// localStatus сводит статусы соединений пользователя на инстансе
+func localStatus(conns map[*Client]models.PresenceStatus) models.PresenceStatus {
+	if len(conns) == 0 {
+		return models.PresenceOffline
+	}
+	for _, status := range conns {
+		if status == models.PresenceOnline {
+			return models.PresenceOnline
+		}
+	}
+	return models.PresenceAway
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// roleFixture — комната с актором и целью заданных ролей
+type roleFixture struct {
+	cs     *chatService
+	repo   *fakeChatRepo
+	roomID uuid.UUID
+	actor  uuid.UUID
+	target uuid.UUID
+}
+
+func newRoleFixture(actorRole, targetRole models.Role) roleFixture {
+	f := roleFixture{
+		repo:   newFakeChatRepo(),
+		roomID: uuid.New(),
+		actor:  uuid.New(),
+		target: uuid.New(),
+	}
+	f.cs = &chatService{Repo: f.repo}
+	if actorRole != "" {
+		f.repo.addMember(f.roomID, f.actor, actorRole)
+	}
+	f.repo.addMember(f.roomID, f.target, targetRole)
+	return f
+}
+
+func TestSetMemberRole(t *testing.T) {
+	tests := []struct {
+		name       string
+		actorRole  models.Role
+		targetRole models.Role
+		newRole    models.Role
+		wantErr    error
+	}{
+		{"владелец назначает администратора", models.RoleOwner, models.RoleMember, models.RoleAdmin, nil},
+		{"администратор назначает модератора", models.RoleAdmin, models.RoleMember, models.RoleModerator, nil},
+		{"администратор понижает модератора", models.RoleAdmin, models.RoleModerator, models.RoleMember, nil},
+		{"администратор не назначает равную роль", models.RoleAdmin, models.RoleMember, models.RoleAdmin, ErrAccessDenied},
+		{"администратор не меняет роль администратора", models.RoleAdmin, models.RoleAdmin, models.RoleMember, ErrAccessDenied},
+		{"модератор не управляет ролями", models.RoleModerator, models.RoleMember, models.RoleModerator, ErrAccessDenied},
+		{"участник не управляет ролями", models.RoleMember, models.RoleMember, models.RoleModerator, ErrAccessDenied},
+		{"не участник", "", models.RoleMember, models.RoleModerator, ErrAccessDenied},
+		{"роль владельца только передачей", models.RoleOwner, models.RoleAdmin, models.RoleOwner, ErrInvalidRole},
+		{"неизвестная роль", models.RoleOwner, models.RoleMember, "guest", ErrInvalidRole},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newRoleFixture(tt.actorRole, tt.targetRole)
+
+			err := f.cs.SetMemberRole(f.roomID, f.actor, f.target, tt.newRole)
+
+			got, _ := f.repo.role(f.roomID, f.target)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Equal(t, tt.targetRole, got)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.newRole, got)
+		})
+	}
+}
+
+func TestRemoveMember(t *testing.T) {
+	tests := []struct {
+		name       string
+		actorRole  models.Role
+		targetRole models.Role
+		wantErr    error
+	}{
+		{"модератор исключает участника", models.RoleModerator, models.RoleMember, nil},
+		{"владелец исключает администратора", models.RoleOwner, models.RoleAdmin, nil},
+		{"модератор не исключает модератора", models.RoleModerator, models.RoleModerator, ErrAccessDenied},
+		{"администратор не исключает владельца", models.RoleAdmin, models.RoleOwner, ErrAccessDenied},
+		{"участник не исключает участника", models.RoleMember, models.RoleMember, ErrAccessDenied},
+		{"не участник", "", models.RoleMember, ErrAccessDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newRoleFixture(tt.actorRole, tt.targetRole)
+
+			err := f.cs.RemoveMember(f.roomID, f.actor, f.target)
+
+			_, stays := f.repo.role(f.roomID, f.target)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.True(t, stays)
+				return
+			}
+			require.NoError(t, err)
+			assert.False(t, stays)
+		})
+	}
+}
+
+func TestRemoveSelfLeavesRoom(t *testing.T) {
+	f := newRoleFixture(models.RoleOwner, models.RoleModerator)
+
+	require.NoError(t, f.cs.RemoveMember(f.roomID, f.target, f.target))
+	_, stays := f.repo.role(f.roomID, f.target)
+	assert.False(t, stays)
+
+	// Владелец не может уйти, не передав владение
+	assert.ErrorIs(t, f.cs.RemoveMember(f.roomID, f.actor, f.actor), ErrOwnerMustStay)
+	role, _ := f.repo.role(f.roomID, f.actor)
+	assert.Equal(t, models.RoleOwner, role)
+}
+
+func TestTransferOwnership(t *testing.T) {
+	f := newRoleFixture(models.RoleOwner, models.RoleMember)
+
+	require.NoError(t, f.cs.TransferOwnership(f.roomID, f.actor, f.target))
+
+	newOwner, _ := f.repo.role(f.roomID, f.target)
+	oldOwner, _ := f.repo.role(f.roomID, f.actor)
+	assert.Equal(t, models.RoleOwner, newOwner)
+	assert.Equal(t, models.RoleAdmin, oldOwner)
+
+	// Бывший владелец больше не может передать владение, новый — может
+	assert.ErrorIs(t, f.cs.TransferOwnership(f.roomID, f.actor, f.target), ErrAccessDenied)
+	assert.NoError(t, f.cs.TransferOwnership(f.roomID, f.target, f.actor))
+}
+
+func TestTransferOwnershipDenied(t *testing.T) {
+	tests := []struct {
+		name      string
+		actorRole models.Role
+		toSelf    bool
+	}{
+		{"администратор", models.RoleAdmin, false},
+		{"участник", models.RoleMember, false},
+		{"не участник", "", false},
+		{"самому себе", models.RoleOwner, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newRoleFixture(tt.actorRole, models.RoleMember)
+			to := f.target
+			if tt.toSelf {
+				to = f.actor
+			}
+
+			assert.ErrorIs(t, f.cs.TransferOwnership(f.roomID, f.actor, to), ErrAccessDenied)
+			role, _ := f.repo.role(f.roomID, f.target)
+			assert.Equal(t, models.RoleMember, role)
+		})
+	}
+}
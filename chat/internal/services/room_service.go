@@ -1,29 +1,27 @@
 package services
 
 import (
-	"errors"
 	"sync"
 
-	"github.com/andro-kes/Chat/chat/internal/models"
-	"github.com/andro-kes/Chat/chat/internal/repository"
 	"github.com/andro-kes/Chat/chat/logger"
+	"github.com/andro-kes/Chat/chat/internal/protocol"
 	"github.com/google/uuid"
-	"github.com/gorilla/websocket"
 	"go.uber.org/zap"
 )
 
 type RoomService interface {
-	SendMessage(msg *models.Message) error
-	AddUser(userID uuid.UUID, conn *websocket.Conn) error
-	RemoveUser(userID uuid.UUID) bool
-	GetMessages() ([]models.Message, error)
+	Broadcast(frame protocol.Frame)
+	DisconnectUser(userID uuid.UUID)
+	DisconnectAll()
+	AddUser(client *Client) error
+	RemoveUser(client *Client) bool
 	GetId() uuid.UUID
 }
 
 type roomService struct {
 	ID        uuid.UUID
-	ActiveUsers map[uuid.UUID]*websocket.Conn
-	Repo      repository.RoomRepo
+	// ActiveUsers хранит все соединения пользователя: одну комнату можно открыть с нескольких устройств
+	ActiveUsers map[uuid.UUID]map[*Client]struct{}
 	Mu        sync.RWMutex
 }
 
@@ -31,72 +29,95 @@ type roomService struct {
 func NewRoomService(roomId uuid.UUID) *roomService {
 	return &roomService{
 		ID:          roomId,
-		ActiveUsers: make(map[uuid.UUID]*websocket.Conn),
-		Repo:        repository.NewRoomRepo(),
+		ActiveUsers: make(map[uuid.UUID]map[*Client]struct{}),
 	}
 }
 
-// AddUser добавляет пользователя в комнату
-func (rs *roomService) AddUser(userID uuid.UUID, conn *websocket.Conn) error {
+// AddUser добавляет соединение пользователя в комнату
+func (rs *roomService) AddUser(client *Client) error {
 	rs.Mu.Lock()
 	defer rs.Mu.Unlock()
 
-	if _, ok := rs.ActiveUsers[userID]; ok {
-		return nil
+	conns, ok := rs.ActiveUsers[client.UserID]
+	if !ok {
+		conns = make(map[*Client]struct{})
+		rs.ActiveUsers[client.UserID] = conns
 	}
-
-	rs.ActiveUsers[userID] = conn
+	conns[client] = struct{}{}
 	return nil
 }
 
-// RemoveUser удаляет пользователя из комнаты
-func (rs *roomService) RemoveUser(userID uuid.UUID) bool {
+// RemoveUser удаляет из комнаты только переданное соединение пользователя.
+// Возвращает false, если в комнате не осталось ни одного соединения.
+func (rs *roomService) RemoveUser(client *Client) bool {
 	rs.Mu.Lock()
 	defer rs.Mu.Unlock()
-	delete(rs.ActiveUsers, userID)
+
+	if conns, ok := rs.ActiveUsers[client.UserID]; ok {
+		delete(conns, client)
+		if len(conns) == 0 {
+			delete(rs.ActiveUsers, client.UserID)
+		}
+	}
 
 	return len(rs.ActiveUsers) != 0
 }
 
-// SendMessage срассылает сообщение всем пользователям
-func (rs *roomService) SendMessage(msg *models.Message) error {
-	if err := rs.Repo.SaveMessage(msg); err != nil {
-		logger.Log.Error("Не удалось сохранить сообщение", zap.Error(err))
-		return err
-	}
-
-	// Сериализуем объект сообщения один раз
-	// но при отправке по websocket используем WriteJSON(msg)
-	// чтобы клиент получил структуру
-	// Копируем список подключений под RLock, затем отпускаем замок и пишем
+// Broadcast ставит фрейм в очередь каждого клиента комнаты на текущем инстансе.
+// Send не блокируется, поэтому медленный клиент не задерживает остальных:
+// переполнивший очередь клиент отключается и удаляется из комнаты.
+func (rs *roomService) Broadcast(frame protocol.Frame) {
+	// Копируем список подключений под RLock, затем отпускаем замок и отправляем
 	rs.Mu.RLock()
-	conns := make([]*websocket.Conn, 0, len(rs.ActiveUsers))
-	userIDs := make([]uuid.UUID, 0, len(rs.ActiveUsers))
-	for uid, c := range rs.ActiveUsers {
-		conns = append(conns, c)
-		userIDs = append(userIDs, uid)
+	clients := make([]*Client, 0, len(rs.ActiveUsers))
+	for _, conns := range rs.ActiveUsers {
+		for c := range conns {
+			clients = append(clients, c)
+		}
 	}
 	rs.Mu.RUnlock()
 
-	for i, conn := range conns {
-		if err := conn.WriteJSON(msg); err != nil {
-			logger.Log.Warn("Не удалось отправить сообщение пользователю",
-				zap.String("user_id", userIDs[i].String()),
+	for _, client := range clients {
+		if err := client.Send(frame); err != nil {
+			logger.Log.Warn("Не удалось отправить фрейм пользователю",
+				zap.String("user_id", client.UserID.String()),
 				zap.Error(err),
 			)
-			ok := rs.RemoveUser(userIDs[i])
-			if !ok {
-				return errors.New("в комнате не осталось активных пользователей")
-			}
+			// Соединение уже закрыто, обработчик освободит комнату после выхода из цикла чтения
+			rs.RemoveUser(client)
 		}
 	}
+}
 
-	return nil
+// DisconnectUser закрывает все соединения пользователя с комнатой на текущем инстансе.
+// Сами соединения удаляются из комнаты обработчиками после выхода из цикла чтения.
+func (rs *roomService) DisconnectUser(userID uuid.UUID) {
+	rs.Mu.RLock()
+	clients := make([]*Client, 0, len(rs.ActiveUsers[userID]))
+	for c := range rs.ActiveUsers[userID] {
+		clients = append(clients, c)
+	}
+	rs.Mu.RUnlock()
+
+	for _, c := range clients {
+		c.Close()
+	}
 }
 
-// GetMessages возвращает список сообщений комнаты
-func (rs *roomService) GetMessages() ([]models.Message, error) {
-	return rs.Repo.GetMessages(rs.ID)
+// DisconnectAll закрывает все соединения с комнатой на текущем инстансе
+func (rs *roomService) DisconnectAll() {
+	rs.Mu.RLock()
+	clients := make([]*Client, 0, len(rs.ActiveUsers))
+	for _, conns := range rs.ActiveUsers {
+		for c := range conns {
+			clients = append(clients, c)
+		}
+	}
+	rs.Mu.RUnlock()
+
+	for _, c := range clients {
+		c.Close()
+	}
 }
 
 // GetId возвращает id комнаты
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/andro-kes/Chat/chat/internal/repository"
+	"github.com/andro-kes/Chat/chat/logger"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	// MaxScheduleAhead — на сколько вперед можно запланировать сообщение
+	MaxScheduleAhead = 365 * 24 * time.Hour
+	// MaxScheduledPerRoom — сколько неотправленных сообщений автор может держать в одной комнате
+	MaxScheduledPerRoom = 100
+	// ScheduleInterval — как часто инстанс проверяет, не пора ли отправить отложенные сообщения
+	ScheduleInterval = time.Second
+	// dispatchBatchSize — сколько отложенных сообщений отправляется за одну транзакцию
+	dispatchBatchSize = 100
+)
+
+var (
+	ErrInvalidSendAt     = errors.New("время отправки должно быть в будущем, но не дальше чем через год")
+	ErrScheduledNotFound = repository.ErrScheduledNotFound
+	ErrTooManyScheduled  = repository.ErrTooManyScheduled
+)
+
+// ScheduleMessage планирует отправку сообщения в sm.SendAt. Автор должен иметь право
+// писать в комнату; ответ в треде допустим только на существующее корневое сообщение.
+// Заполняет sm.ID и sm.CreatedAt.
+func (cs *chatService) ScheduleMessage(sm *models.ScheduledMessage) error {
+	if err := checkSendAt(sm.SendAt); err != nil {
+		return err
+	}
+	if err := checkTTL(sm.TTL); err != nil {
+		return err
+	}
+	if err := cs.Authorize(sm.RoomID, sm.SenderID, PermPost); err != nil {
+		return err
+	}
+	if sm.ParentID != nil {
+		if err := cs.CheckReplyParent(sm.RoomID, *sm.ParentID); err != nil {
+			return err
+		}
+	}
+
+	sm.ID = uuid.New()
+	return cs.MessageRepo.SaveScheduled(sm, MaxScheduledPerRoom)
+}
+
+// GetScheduled возвращает неотправленные сообщения автора; нулевой roomID — во всех комнатах
+func (cs *chatService) GetScheduled(userID, roomID uuid.UUID) ([]models.ScheduledMessage, error) {
+	return cs.MessageRepo.GetScheduled(userID, roomID)
+}
+
+// EditScheduled меняет текст и/или время отправки неотправленного сообщения автора; nil-поля не меняются
+func (cs *chatService) EditScheduled(id, userID uuid.UUID, content *string, sendAt *time.Time) (*models.ScheduledMessage, error) {
+	if sendAt != nil {
+		if err := checkSendAt(*sendAt); err != nil {
+			return nil, err
+		}
+	}
+	return cs.MessageRepo.UpdateScheduled(id, userID, content, sendAt)
+}
+
+// CancelScheduled отменяет неотправленное сообщение автора
+func (cs *chatService) CancelScheduled(id, userID uuid.UUID) error {
+	return cs.MessageRepo.DeleteScheduled(id, userID)
+}
+
+// DispatchScheduled отправляет через publish до limit сообщений, время которых наступило.
+// Возвращает, сколько сообщений снято с очереди (отправлено или отброшено).
+func (cs *chatService) DispatchScheduled(limit int, publish func(msg models.Message) error) (int, error) {
+	return cs.MessageRepo.DispatchScheduled(limit, func(sm *models.ScheduledMessage) error {
+		return cs.sendScheduled(sm, publish)
+	})
+}
+
+// sendScheduled публикует отложенное сообщение. Если автор больше не может писать в комнату
+// или корень треда удален, сообщение отбрасывается; при прочих ошибках остается до следующей попытки.
+func (cs *chatService) sendScheduled(sm *models.ScheduledMessage, publish func(msg models.Message) error) error {
+	err := cs.Authorize(sm.RoomID, sm.SenderID, PermPost)
+	if err == nil && sm.ParentID != nil {
+		err = cs.CheckReplyParent(sm.RoomID, *sm.ParentID)
+	}
+	if errors.Is(err, ErrAccessDenied) || errors.Is(err, ErrMessageNotFound) || errors.Is(err, ErrInvalidParent) {
+		logger.Log.Info(
+			"Отложенное сообщение отброшено",
+			zap.String("scheduled_id", sm.ID.String()),
+			zap.String("room_id", sm.RoomID.String()),
+			zap.Error(err),
+		)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	expiresAt, err := MessageExpiry(now, sm.TTL)
+	if err != nil {
+		return err
+	}
+	msg := models.Message{
+		ID:          models.MessageIDFor(sm.RoomID, sm.ID),
+		CreatedAt:   now,
+		SenderID:    sm.SenderID,
+		RoomID:      sm.RoomID,
+		Content:     sm.Content,
+		ClientMsgID: sm.ID,
+		ParentID:    sm.ParentID,
+		ExpiresAt:   expiresAt,
+	}
+	if err := publish(msg); err != nil {
+		logger.Log.Warn("Не удалось опубликовать отложенное сообщение", zap.String("scheduled_id", sm.ID.String()), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func checkSendAt(sendAt time.Time) error {
+	now := time.Now()
+	if !sendAt.After(now) || sendAt.After(now.Add(MaxScheduleAhead)) {
+		return ErrInvalidSendAt
+	}
+	return nil
+}
+
+// MessageScheduler периодически отправляет отложенные сообщения, время которых наступило.
+// Он работает на каждом инстансе: сообщения разбираются с блокировкой строк,
+// поэтому каждое отправляется один раз.
+type MessageScheduler struct {
+	service ChatService
+	publish func(msg models.Message) error
+
+	done chan struct{}
+	once sync.Once
+}
+
+// NewMessageScheduler создает планировщик. publish отправляет сообщение в очередь на сохранение.
+func NewMessageScheduler(service ChatService, publish func(msg models.Message) error) *MessageScheduler {
+	return &MessageScheduler{
+		service: service,
+		publish: publish,
+		done:    make(chan struct{}),
+	}
+}
+
+// Start запускает планировщик
+func (ms *MessageScheduler) Start() {
+	go ms.loop()
+}
+
+// Stop останавливает планировщик
+func (ms *MessageScheduler) Stop() {
+	ms.once.Do(func() {
+		close(ms.done)
+	})
+}
+
+func (ms *MessageScheduler) loop() {
+	ticker := time.NewTicker(ScheduleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ms.dispatch()
+		case <-ms.done:
+			return
+		}
+	}
+}
+
+// dispatch отправляет наступившие сообщения пачками, пока полная пачка говорит о том, что остались еще
+func (ms *MessageScheduler) dispatch() {
+	for {
+		n, err := ms.service.DispatchScheduled(dispatchBatchSize, ms.publish)
+		if err != nil {
+			logger.Log.Warn("Не удалось отправить отложенные сообщения", zap.Error(err))
+			return
+		}
+		if n < dispatchBatchSize {
+			return
+		}
+
+		select {
+		case <-ms.done:
+			return
+		default:
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckSendAt(t *testing.T) {
+	tests := []struct {
+		name    string
+		offset  time.Duration
+		zero    bool
+		wantErr bool
+	}{
+		{"через минуту", time.Minute, false, false},
+		{"почти через год", MaxScheduleAhead - time.Minute, false, false},
+		{"в прошлом", -time.Minute, false, true},
+		{"дальше года", MaxScheduleAhead + time.Minute, false, true},
+		{"нулевое время", 0, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sendAt time.Time
+			if !tt.zero {
+				sendAt = time.Now().Add(tt.offset)
+			}
+			err := checkSendAt(sendAt)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidSendAt)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// scheduleFixture — комната с автором и очередью отложенных сообщений
+type scheduleFixture struct {
+	cs       *chatService
+	chats    *fakeChatRepo
+	messages *fakeRoomRepo
+	roomID   uuid.UUID
+	sender   uuid.UUID
+	// published — что ушло в очередь на сохранение
+	published []models.Message
+}
+
+func newScheduleFixture(contents ...string) *scheduleFixture {
+	f := &scheduleFixture{
+		chats:    newFakeChatRepo(),
+		messages: &fakeRoomRepo{},
+		roomID:   uuid.New(),
+		sender:   uuid.New(),
+	}
+	f.cs = &chatService{Repo: f.chats, MessageRepo: f.messages}
+	f.chats.addMember(f.roomID, f.sender, models.RoleMember)
+	for _, content := range contents {
+		f.messages.scheduled = append(f.messages.scheduled, models.ScheduledMessage{
+			ID:       uuid.New(),
+			RoomID:   f.roomID,
+			SenderID: f.sender,
+			Content:  content,
+			SendAt:   time.Now().Add(-time.Second),
+		})
+	}
+	return f
+}
+
+func (f *scheduleFixture) publish(msg models.Message) error {
+	f.published = append(f.published, msg)
+	return nil
+}
+
+func TestDispatchScheduledSendsOnce(t *testing.T) {
+	f := newScheduleFixture("первое", "второе")
+	scheduled := f.messages.queued()
+
+	n, err := f.cs.DispatchScheduled(dispatchBatchSize, f.publish)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Empty(t, f.messages.queued())
+
+	// Повторный проход ничего не отправляет
+	n, err = f.cs.DispatchScheduled(dispatchBatchSize, f.publish)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	require.Len(t, f.published, 2)
+	for i, msg := range f.published {
+		sm := scheduled[i]
+		assert.Equal(t, models.MessageIDFor(f.roomID, sm.ID), msg.ID)
+		assert.Equal(t, sm.ID, msg.ClientMsgID)
+		assert.Equal(t, f.sender, msg.SenderID)
+		assert.Equal(t, sm.Content, msg.Content)
+		assert.Nil(t, msg.ExpiresAt)
+	}
+}
+
+func TestDispatchScheduledKeepsUnsent(t *testing.T) {
+	f := newScheduleFixture("первое")
+	brokerDown := func(models.Message) error { return errors.New("channel closed") }
+
+	n, err := f.cs.DispatchScheduled(dispatchBatchSize, brokerDown)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	assert.Len(t, f.messages.queued(), 1)
+
+	// Когда брокер снова доступен, сообщение уходит
+	n, err = f.cs.DispatchScheduled(dispatchBatchSize, f.publish)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Len(t, f.published, 1)
+	assert.Empty(t, f.messages.queued())
+}
+
+func TestDispatchScheduledRepublishesAfterCommitFailure(t *testing.T) {
+	f := newScheduleFixture("первое")
+	f.messages.commitErr = errors.New("connection reset")
+
+	_, err := f.cs.DispatchScheduled(dispatchBatchSize, f.publish)
+	require.Error(t, err)
+	assert.Len(t, f.messages.queued(), 1)
+
+	f.messages.commitErr = nil
+	n, err := f.cs.DispatchScheduled(dispatchBatchSize, f.publish)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	// Повторная публикация несет тот же ID и ключ идемпотентности: консьюмер не сохранит ее дважды
+	require.Len(t, f.published, 2)
+	first, second := f.published[0], f.published[1]
+	assert.Equal(t, first.ID, second.ID)
+	assert.Equal(t, first.ClientMsgID, second.ClientMsgID)
+}
+
+func TestDispatchScheduledDropsWhenSenderLeft(t *testing.T) {
+	f := newScheduleFixture("первое")
+	require.NoError(t, f.chats.RemoveMember(f.roomID, f.sender))
+
+	n, err := f.cs.DispatchScheduled(dispatchBatchSize, f.publish)
+	require.NoError(t, err)
+
+	// Сообщение снято с очереди, но не опубликовано
+	assert.Equal(t, 1, n)
+	assert.Empty(t, f.messages.queued())
+	assert.Empty(t, f.published)
+}
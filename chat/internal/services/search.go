@@ -0,0 +1,26 @@
+package services
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/google/uuid"
+)
+
+// MaxSearchLength — максимальная длина поискового запроса в символах
+const MaxSearchLength = 256
+
+// SearchMessages ищет сообщения по тексту во всех комнатах пользователя.
+// Фильтр по комнате, где пользователь не состоит, просто не дает результатов.
+func (cs *chatService) SearchMessages(userID uuid.UUID, query models.SearchQuery) (*models.SearchPage, error) {
+	query.Text = strings.TrimSpace(query.Text)
+	if query.Text == "" || utf8.RuneCountInString(query.Text) > MaxSearchLength {
+		return nil, ErrInvalidSearch
+	}
+	if !query.From.IsZero() && !query.To.IsZero() && !query.From.Before(query.To) {
+		return nil, ErrInvalidSearch
+	}
+	query.Limit = pageLimit(query.Limit)
+	return cs.MessageRepo.SearchMessages(userID, query)
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andro-kes/Chat/chat/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchMessagesNormalizesQuery(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     models.SearchQuery
+		wantText  string
+		wantLimit int
+	}{
+		{"пробелы по краям", models.SearchQuery{Text: "  привет  "}, "привет", DefaultPageSize},
+		{"лимит в пределах", models.SearchQuery{Text: "привет", Limit: 10}, "привет", 10},
+		{"больше максимума", models.SearchQuery{Text: "привет", Limit: MaxPageSize + 1}, "привет", MaxPageSize},
+		{"максимальная длина в символах", models.SearchQuery{Text: strings.Repeat("я", MaxSearchLength)}, strings.Repeat("я", MaxSearchLength), DefaultPageSize},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages := &fakeRoomRepo{}
+			cs := &chatService{MessageRepo: messages}
+
+			_, err := cs.SearchMessages(uuid.New(), tt.query)
+			require.NoError(t, err)
+			require.Len(t, messages.searches, 1)
+			assert.Equal(t, tt.wantText, messages.searches[0].Text)
+			assert.Equal(t, tt.wantLimit, messages.searches[0].Limit)
+		})
+	}
+}
+
+func TestSearchMessagesInvalid(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name  string
+		query models.SearchQuery
+	}{
+		{"пустой текст", models.SearchQuery{}},
+		{"только пробелы", models.SearchQuery{Text: "   "}},
+		{"слишком длинный", models.SearchQuery{Text: strings.Repeat("я", MaxSearchLength+1)}},
+		{"пустой интервал", models.SearchQuery{Text: "привет", From: now, To: now}},
+		{"from позже to", models.SearchQuery{Text: "привет", From: now, To: now.Add(-time.Hour)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages := &fakeRoomRepo{}
+			cs := &chatService{MessageRepo: messages}
+
+			_, err := cs.SearchMessages(uuid.New(), tt.query)
+			assert.ErrorIs(t, err, ErrInvalidSearch)
+			assert.Empty(t, messages.searches)
+		})
+	}
+}
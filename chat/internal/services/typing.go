@@ -0,0 +1,68 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// TypingInterval — как часто пользователь может сообщать о наборе текста в одной комнате
+	TypingInterval = 3 * time.Second
+	// TypingTTL — сколько клиенты показывают «печатает...» без повторного события.
+	// Больше TypingInterval, чтобы при непрерывном наборе индикатор не мигал.
+	TypingTTL = 6 * time.Second
+)
+
+type typingKey struct {
+	RoomID uuid.UUID
+	UserID uuid.UUID
+}
+
+// TypingThrottle ограничивает частоту событий набора текста на инстансе.
+// Состояние хранится только в памяти: события эфемерны и не попадают в БД.
+type TypingThrottle struct {
+	interval  time.Duration
+	mu        sync.Mutex
+	last      map[typingKey]time.Time
+	lastSweep time.Time
+}
+
+// NewTypingThrottle создает ограничитель, пропускающий одно событие на пользователя и комнату за interval
+func NewTypingThrottle(interval time.Duration) *TypingThrottle {
+	return &TypingThrottle{
+		interval:  interval,
+		last:      make(map[typingKey]time.Time),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow сообщает, можно ли сейчас разослать событие набора текста пользователя в комнату
+func (t *TypingThrottle) Allow(roomID, userID uuid.UUID) bool {
+	now := time.Now()
+	key := typingKey{RoomID: roomID, UserID: userID}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.sweep(now)
+	if last, ok := t.last[key]; ok && now.Sub(last) < t.interval {
+		return false
+	}
+	t.last[key] = now
+	return true
+}
+
+// sweep удаляет устаревшие записи, чтобы карта не росла. Вызывается под t.mu
+func (t *TypingThrottle) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < 10*t.interval {
+		return
+	}
+	for key, last := range t.last {
+		if now.Sub(last) >= t.interval {
+			delete(t.last, key)
+		}
+	}
+	t.lastSweep = now
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTypingThrottle(t *testing.T) {
+	room, otherRoom := uuid.New(), uuid.New()
+	user, otherUser := uuid.New(), uuid.New()
+
+	tests := []struct {
+		name   string
+		roomID uuid.UUID
+		userID uuid.UUID
+		want   bool
+	}{
+		{"первое событие проходит", room, user, true},
+		{"повтор в интервале отбрасывается", room, user, false},
+		{"другой пользователь в той же комнате", room, otherUser, true},
+		{"тот же пользователь в другой комнате", otherRoom, user, true},
+		{"повтор другого пользователя отбрасывается", room, otherUser, false},
+	}
+
+	throttle := NewTypingThrottle(time.Hour)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, throttle.Allow(tt.roomID, tt.userID))
+		})
+	}
+}
+
+func TestTypingThrottleAfterInterval(t *testing.T) {
+	const interval = 20 * time.Millisecond
+	throttle := NewTypingThrottle(interval)
+	room, user := uuid.New(), uuid.New()
+
+	assert.True(t, throttle.Allow(room, user))
+	assert.False(t, throttle.Allow(room, user))
+
+	time.Sleep(interval)
+	assert.True(t, throttle.Allow(room, user))
+}
+
+func TestTypingThrottleSweep(t *testing.T) {
+	const interval = 5 * time.Millisecond
+	throttle := NewTypingThrottle(interval)
+	for i := 0; i < 3; i++ {
+		throttle.Allow(uuid.New(), uuid.New())
+	}
+
+	// Через 10 интервалов очередное событие удаляет устаревшие записи
+	time.Sleep(10 * interval)
+	throttle.Allow(uuid.New(), uuid.New())
+
+	throttle.mu.Lock()
+	defer throttle.mu.Unlock()
+	assert.Len(t, throttle.last, 1)
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"github.com/andro-kes/Chat/chat/grpc"
+	"github.com/google/uuid"
+)
+
+// usersBatchSize — сколько пользователей запрашивается у сервиса авторизации за один вызов
+const usersBatchSize = 100
+
+// UserDirectory отдает данные пользователей, которые хранит сервис авторизации
+type UserDirectory interface {
+	// Usernames возвращает имена пользователей по id; неизвестных пользователей в результате нет
+	Usernames(ids []uuid.UUID) (map[uuid.UUID]string, error)
+	// UserIDs возвращает id пользователей с переданными именами без учета регистра
+	UserIDs(usernames []string) ([]uuid.UUID, error)
+}
+
+// authDirectory — UserDirectory поверх gRPC сервиса авторизации
+type authDirectory struct{}
+
+func (authDirectory) Usernames(ids []uuid.UUID) (map[uuid.UUID]string, error) {
+	res := make(map[uuid.UUID]string, len(ids))
+	for start := 0; start < len(ids); start += usersBatchSize {
+		batch := ids[start:min(start+usersBatchSize, len(ids))]
+		raw := make([]string, len(batch))
+		for i, id := range batch {
+			raw[i] = id.String()
+		}
+
+		names, err := grpc.Usernames(raw)
+		if err != nil {
+			return nil, err
+		}
+		for id, name := range names {
+			if uid, err := uuid.Parse(id); err == nil {
+				res[uid] = name
+			}
+		}
+	}
+	return res, nil
+}
+
+func (authDirectory) UserIDs(usernames []string) ([]uuid.UUID, error) {
+	if len(usernames) == 0 {
+		return nil, nil
+	}
+
+	raw, err := grpc.UserIDsByUsername(usernames)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, 0, len(raw))
+	for _, v := range raw {
+		if id, err := uuid.Parse(v); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
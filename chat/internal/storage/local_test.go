@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalStoragePath(t *testing.T) {
+	root := t.TempDir()
+	ls := &localStorage{root: root}
+
+	tests := []struct {
+		name    string
+		key     string
+		want    string
+		wantErr bool
+	}{
+		{"обычный ключ", "attachments/room/id", filepath.Join(root, "attachments", "room", "id"), false},
+		{"лишние сегменты схлопываются", "attachments/./room//id", filepath.Join(root, "attachments", "room", "id"), false},
+		{"возврат внутри root", "attachments/../other/id", filepath.Join(root, "other", "id"), false},
+		{"файл с точками в имени", "attachments/..id", filepath.Join(root, "attachments", "..id"), false},
+		{"пустой ключ", "", "", true},
+		{"корень", ".", "", true},
+		{"родительский каталог", "..", "", true},
+		{"выход за root", "../secret", "", true},
+		{"выход после нормализации", "attachments/../../secret", "", true},
+		{"абсолютный путь", "/etc/passwd", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ls.path(tt.key)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLocalStorageRoundTrip(t *testing.T) {
+	ls, err := NewLocal(t.TempDir())
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, ls.Put(ctx, "attachments/room/id", strings.NewReader("данные")))
+
+	r, err := ls.Open(ctx, "attachments/room/id")
+	require.NoError(t, err)
+	body, err := io.ReadAll(r)
+	require.NoError(t, r.Close())
+	require.NoError(t, err)
+	assert.Equal(t, "данные", string(body))
+
+	require.NoError(t, ls.Delete(ctx, "attachments/room/id"))
+	_, err = ls.Open(ctx, "attachments/room/id")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Повторное удаление не ошибка
+	assert.NoError(t, ls.Delete(ctx, "attachments/room/id"))
+	// Ключ за пределами root отклоняется
+	assert.Error(t, ls.Put(ctx, "../escape", strings.NewReader("x")))
+}
@@ -0,0 +1,38 @@
+// Package storage хранит содержимое вложений. Метаданные вложений лежат в Postgres,
+// здесь — только байты под ключом, который выдает сервис.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+)
+
+var ErrNotFound = errors.New("объект не найден в хранилище")
+
+// Storage — хранилище файлов. Ключи — относительные пути через «/», например attachments/<room>/<id>.
+type Storage interface {
+	// Put сохраняет содержимое r под ключом key. Объект появляется целиком или не появляется вовсе.
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Open открывает объект на чтение; ErrNotFound, если объекта нет
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete удаляет объект; отсутствие объекта ошибкой не считается
+	Delete(ctx context.Context, key string) error
+}
+
+// New создает хранилище по ENV. Сейчас поддерживается только локальная файловая система:
+// ATTACHMENTS_STORAGE=local (по умолчанию), каталог — ATTACHMENTS_DIR.
+// Другие бэкенды (например, S3-совместимые) подключаются реализацией Storage.
+func New() (Storage, error) {
+	switch kind := os.Getenv("ATTACHMENTS_STORAGE"); kind {
+	case "", "local":
+		dir := os.Getenv("ATTACHMENTS_DIR")
+		if dir == "" {
+			dir = "data/attachments"
+		}
+		return NewLocal(dir)
+	default:
+		return nil, errors.New("неизвестное хранилище вложений: " + kind)
+	}
+}